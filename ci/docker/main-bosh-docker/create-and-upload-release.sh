@@ -25,10 +25,10 @@ pushd "${src_dir}/src/go/src/github.com/cloudfoundry/bosh-release-acceptance-tes
 popd > /dev/null
 
 pushd ${BOSH_DEPLOYMENT_PATH} > /dev/null
-  inner_bosh_dir="/tmp/inner-bosh/director/$node_number"
+  inner_bosh_dir="${inner_bosh_root:-/tmp/inner-bosh/director}/$node_number"
   node_number=$1
   if [[ -n "$node_number" ]]; then
-    inner_bosh_dir="/tmp/inner-bosh/director/${node_number}"
+    inner_bosh_dir="${inner_bosh_root:-/tmp/inner-bosh/director}/${node_number}"
   fi
 
   mkdir -p ${inner_bosh_dir}
@@ -4,11 +4,11 @@ set -e
 
 pushd ${BOSH_DEPLOYMENT_PATH} > /dev/null
   node_number=$1
-  inner_bosh_dir="/tmp/inner-bosh/director"
+  inner_bosh_dir="${inner_bosh_root:-/tmp/inner-bosh/director}"
   deployment_name="bosh"
 
   if [[ -n "$node_number" ]]; then
-    inner_bosh_dir="/tmp/inner-bosh/director/${node_number}"
+    inner_bosh_dir="${inner_bosh_root:-/tmp/inner-bosh/director}/${node_number}"
     deployment_name="bosh-$node_number"
   fi
 
@@ -7,7 +7,7 @@ src_dir="${script_dir}/../../../"
 node_number=${1}
 
 pushd ${BOSH_DEPLOYMENT_PATH} > /dev/null
-  inner_bosh_dir="/tmp/inner-bosh/director/$node_number"
+  inner_bosh_dir="${inner_bosh_root:-/tmp/inner-bosh/director}/$node_number"
   mkdir -p ${inner_bosh_dir}
 
   export BOSH_DIRECTOR_IP="10.245.0.$((10+$node_number))"
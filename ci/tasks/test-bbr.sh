@@ -43,6 +43,8 @@ DOCKER_HOST="$(bosh int /tmp/local-bosh/director/bosh-director.yml --path /insta
 export DOCKER_HOST
 
 export BBR_RELEASE_PATH="$( echo $PWD/bbr-compiled-release/*.tgz )"
+export BRATS_ARTIFACTS_PATH="${PWD}/bbr-artifacts"
+export BRATS_REPORTS_PATH="${BRATS_ARTIFACTS_PATH}/reports"
 
 bosh -n update-cloud-config \
   "${BOSH_DEPLOYMENT_PATH}/docker/cloud-config.yml" \
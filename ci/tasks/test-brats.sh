@@ -24,6 +24,8 @@ CANDIDATE_STEMCELL_TARBALL_PATH="$(realpath "${src_dir}"/stemcell/*.tgz)"
 export CANDIDATE_STEMCELL_TARBALL_PATH
 export BOSH_DEPLOYMENT_PATH="/usr/local/bosh-deployment"
 export BOSH_DNS_ADDON_OPS_FILE_PATH="${BOSH_DEPLOYMENT_PATH}/experimental/dns-addon-with-api-certificates.yml"
+export BRATS_ARTIFACTS_PATH="${PWD}/brats-artifacts"
+export BRATS_REPORTS_PATH="${BRATS_ARTIFACTS_PATH}/reports"
 
 export OUTER_BOSH_ENV_PATH="/tmp/local-bosh/director/env"
 
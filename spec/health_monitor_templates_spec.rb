@@ -188,6 +188,7 @@ describe 'health_monitor.yml.erb' do
               'pagerduty' => {
                 'service_key' => 'abcde',
                 'http_proxy' => 'http://localhost:3142',
+                'api_uri' => 'http://localhost:8080/create_event.json',
               },
             })
         end
@@ -200,6 +201,19 @@ describe 'health_monitor.yml.erb' do
           expect(plugin['events']).to be_a(Array)
           expect(plugin['options']['service_key']).to eq('abcde')
           expect(plugin['options']['http_proxy']).to eq('http://localhost:3142')
+          expect(plugin['options']['api_uri']).to eq('http://localhost:8080/create_event.json')
+        end
+
+        context 'without an api_uri' do
+          before do
+            deployment_manifest_fragment['properties']['hm']['pagerduty'].delete('api_uri')
+          end
+
+          it 'leaves the plugin on the public PagerDuty endpoint' do
+            plugin = parsed_yaml['plugins'][3]
+            expect(plugin['name']).to eq('pagerduty')
+            expect(plugin['options']).to_not have_key('api_uri')
+          end
         end
       end
 
@@ -316,6 +330,31 @@ describe 'health_monitor.yml.erb' do
   end
 end
 
+describe 'health_monitor_ctl.erb' do
+  let(:properties) { { 'properties' => { 'hm' => {} } } }
+
+  let(:template) { File.read(File.join(File.dirname(__FILE__), '../jobs/health_monitor/templates/health_monitor_ctl.erb')) }
+
+  subject(:rendered_template) do
+    binding = Bosh::Template::EvaluationContext.new(properties, nil).get_binding
+    ERB.new(template).result(binding)
+  end
+
+  it 'leaves the DataDog client on its default API host' do
+    expect(rendered_template).to_not include('DATADOG_HOST')
+  end
+
+  context 'when hm.datadog.api_host is set' do
+    before do
+      properties['properties']['hm']['datadog'] = { 'api_host' => 'http://10.0.0.1:8082' }
+    end
+
+    it 'exports it as DATADOG_HOST' do
+      expect(rendered_template).to include(%(export DATADOG_HOST="http://10.0.0.1:8082"\n))
+    end
+  end
+end
+
 describe 'tls' do
   describe 'nats_server_ca.pem.erb' do
     it_should_behave_like 'a rendered file' do
@@ -372,3 +411,17 @@ describe 'tls' do
     end
   end
 end
+
+describe 'health monitor job spec' do
+  let(:spec_yaml) { YAML.load_file(File.join(File.dirname(__FILE__), '../jobs/health_monitor/spec')) }
+
+  it 'has no default for hm.pagerduty.api_uri, so the plugin uses the public PagerDuty endpoint' do
+    expect(spec_yaml['properties']).to have_key('hm.pagerduty.api_uri')
+    expect(spec_yaml['properties']['hm.pagerduty.api_uri']).to_not have_key('default')
+  end
+
+  it 'has no default for hm.datadog.api_host, so the DataDog client uses its own' do
+    expect(spec_yaml['properties']).to have_key('hm.datadog.api_host')
+    expect(spec_yaml['properties']['hm.datadog.api_host']).to_not have_key('default')
+  end
+end
@@ -38,7 +38,7 @@ module Bosh::Monitor
 
         EventMachine.defer do
           begin
-            send_http_post_sync_request(API_URI, request)
+            send_http_post_sync_request(options["api_uri"] || API_URI, request)
           rescue => e
             logger.error("Error sending pagerduty event: #{e}")
           end
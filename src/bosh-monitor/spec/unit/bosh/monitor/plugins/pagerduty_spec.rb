@@ -71,4 +71,22 @@ describe Bhm::Plugins::Pagerduty do
     end
   end
 
+  it "sends events to the configured API URI" do
+    uri = "http://localhost:8080/generic/2010-04-15/create_event.json"
+    plugin = Bhm::Plugins::Pagerduty.new(@options.merge("api_uri" => uri))
+
+    alert = Bhm::Events::Base.create!(:alert, alert_payload)
+
+    EM.run do
+      plugin.run
+
+      allow(EventMachine).to receive(:defer) { |&arg| arg.call }
+
+      expect(plugin).to receive(:send_http_post_sync_request).with(uri, anything)
+
+      plugin.process(alert)
+      EM.stop
+    end
+  end
+
 end
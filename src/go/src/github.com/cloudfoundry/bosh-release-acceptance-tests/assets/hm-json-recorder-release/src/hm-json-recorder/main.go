@@ -0,0 +1,93 @@
+// Command hm-json-recorder is a health monitor JSON plugin that appends every
+// event it receives on stdin to a file as newline-delimited JSON, along with
+// when and by which process it was received. Every start is recorded too, so
+// that restarts after a crash show up.
+//
+// The suites cross-compile it into the release before creating it, see
+// bratsutils.BuildHMJSONRecorder.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// record mirrors bratsutils.HMJSONPluginRecord.
+type record struct {
+	PID        int             `json:"pid"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Started    bool            `json:"started,omitempty"`
+	Event      json.RawMessage `json:"event,omitempty"`
+	Invalid    string          `json:"invalid,omitempty"`
+}
+
+func main() {
+	output := flag.String("output", "", "file to append the events to")
+	flag.Parse()
+
+	if *output == "" {
+		fmt.Fprintln(os.Stderr, "-output is required")
+		os.Exit(2)
+	}
+
+	if err := run(*output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(output string) error {
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := write(file, record{Started: true}); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		r := record{}
+		if json.Valid(line) {
+			r.Event = append(json.RawMessage{}, line...)
+		} else {
+			r.Invalid = string(line)
+		}
+
+		if err := write(file, r); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// write appends r unbuffered, so the file is complete whenever the process
+// gets killed.
+func write(file *os.File, r record) error {
+	r.PID = os.Getpid()
+	r.ReceivedAt = time.Now().UTC()
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
@@ -17,7 +17,7 @@ const BLOBSTORE_ACCESS_LOG = "/var/vcap/sys/log/blobstore/blobstore_access.log"
 
 func TestBBR(t *testing.T) {
 	RegisterFailHandler(Fail)
-	RunSpecs(t, "BBR Suite")
+	bratsutils.RunSpecsWithReports(t, "BBR Suite")
 }
 
 var (
@@ -27,9 +27,10 @@ var (
 )
 
 var _ = SynchronizedBeforeSuite(func() []byte {
-	bbrReleasePath = bratsutils.AssertEnvExists("BBR_RELEASE_PATH")
-
 	bratsutils.Bootstrap()
+	bratsutils.RequireConfig(bratsutils.ConfigBBRReleasePath)
+	bbrReleasePath = bratsutils.SuiteConfig().BBRReleasePath
+
 	bratsutils.CreateAndUploadBOSHRelease()
 
 	session := bratsutils.OuterBosh("-n", "upload-release", bbrReleasePath)
@@ -43,9 +44,16 @@ var _ = SynchronizedBeforeSuite(func() []byte {
 	return nil
 }, func(data []byte) {
 	bratsutils.Bootstrap()
-	bbrBinaryPath = bratsutils.AssertEnvExists("BBR_BINARY_PATH")
-	bbrReleasePath = bratsutils.AssertEnvExists("BBR_RELEASE_PATH")
-	candidateWardenLinuxStemcellPath = bratsutils.AssertEnvExists("CANDIDATE_STEMCELL_TARBALL_PATH")
+	bratsutils.RequireConfig(
+		bratsutils.ConfigBBRBinaryPath,
+		bratsutils.ConfigBBRReleasePath,
+		bratsutils.ConfigCandidateStemcellTarballPath,
+	)
+
+	suiteConfig := bratsutils.SuiteConfig()
+	bbrBinaryPath = suiteConfig.BBRBinaryPath
+	bbrReleasePath = suiteConfig.BBRReleasePath
+	candidateWardenLinuxStemcellPath = suiteConfig.CandidateStemcellTarballPath
 })
 
 func bbr(args ...string) *gexec.Session {
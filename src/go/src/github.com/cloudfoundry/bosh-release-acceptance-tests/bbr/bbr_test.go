@@ -1,8 +1,6 @@
 package bbr_test
 
 import (
-	"io/ioutil"
-
 	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -27,9 +25,7 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 	)
 
 	BeforeEach(func() {
-		var err error
-		tmpCertDir, err = ioutil.TempDir("", "db_tls")
-		Expect(err).ToNot(HaveOccurred())
+		tmpCertDir = bratsutils.TempDir("db_tls")
 
 		dbConfig = nil
 
@@ -59,23 +55,23 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 
 			By("create syslog deployment", func() {
 				bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
-				bratsutils.UploadRelease("https://bosh.io/d/github.com/cloudfoundry/syslog-release?v=11")
+				bratsutils.UploadRelease(bratsutils.ResolveArtifact("syslog@11"))
 
 				session := bratsutils.Bosh("-n", "deploy", syslogManifestPath,
 					"-d", "syslog-deployment",
 					"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
 				)
-				Eventually(session, 10*time.Minute).Should(gexec.Exit(0))
+				bratsutils.ExpectDeployExit(session, "syslog-deployment", 10*time.Minute, 0)
 			})
 
 			By("create os-conf deployment", func() {
-				bratsutils.UploadRelease("https://bosh.io/d/github.com/cloudfoundry/os-conf-release?v=12")
+				bratsutils.UploadRelease(bratsutils.ResolveArtifact("os-conf@12"))
 
 				session := bratsutils.Bosh("-n", "deploy", osConfManifestPath,
 					"-d", "os-conf-deployment",
 					"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
 				)
-				Eventually(session, 10*time.Minute).Should(gexec.Exit(0))
+				bratsutils.ExpectDeployExit(session, "os-conf-deployment", 10*time.Minute, 0)
 			})
 
 			By("bbr creates a backup", func() {
@@ -132,7 +128,7 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 					"-d", "os-conf-deployment",
 					"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
 				)
-				Eventually(session, 10*time.Minute).Should(gexec.Exit(0))
+				bratsutils.ExpectDeployExit(session, "os-conf-deployment", 10*time.Minute, 0)
 			})
 
 			By("validate deployments", func() {
@@ -162,7 +158,7 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 		It("can backup and restore (reattaches to underlying deployment)", func() {
 			By("Set up a deployment that uses the syslog release", func() {
 				bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
-				bratsutils.UploadRelease("https://bosh.io/d/github.com/cloudfoundry/syslog-release?v=11")
+				bratsutils.UploadRelease(bratsutils.ResolveArtifact("syslog@11"))
 
 				manifestPath := bratsutils.AssetPath("syslog-manifest.yml")
 				session := bratsutils.Bosh("-n", "deploy", manifestPath,
@@ -170,7 +166,7 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 					"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
 				)
 
-				Eventually(session, 10*time.Minute).Should(gexec.Exit(0))
+				bratsutils.ExpectDeployExit(session, "syslog-deployment", 10*time.Minute, 0)
 			})
 
 			By("bbr creates a backup", func() {
@@ -227,13 +223,13 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 					bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
 
 					By("create syslog deployment", func() {
-						bratsutils.UploadRelease("https://bosh.io/d/github.com/cloudfoundry/syslog-release?v=11")
+						bratsutils.UploadRelease(bratsutils.ResolveArtifact("syslog@11"))
 
 						session := bratsutils.Bosh("-n", "deploy", syslogManifestPath,
 							"-d", "syslog-deployment",
 							"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
 						)
-						Eventually(session, 15*time.Minute).Should(gexec.Exit(0))
+						bratsutils.ExpectDeployExit(session, "syslog-deployment", 15*time.Minute, 0)
 					})
 
 					By("creating a backup", func() {
@@ -276,6 +272,8 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 			Context("RDS", func() {
 				Context("Mysql", func() {
 					BeforeEach(func() {
+						bratsutils.SkipUnlessConfigured(bratsutils.ExternalDBConfigFields("rds_mysql", false)...)
+
 						dbConfig = bratsutils.LoadExternalDBConfig("rds_mysql", false, tmpCertDir)
 						bratsutils.CreateDB(dbConfig)
 
@@ -287,6 +285,8 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 
 				Context("Postgres", func() {
 					BeforeEach(func() {
+						bratsutils.SkipUnlessConfigured(bratsutils.ExternalDBConfigFields("rds_postgres", false)...)
+
 						dbConfig = bratsutils.LoadExternalDBConfig("rds_postgres", false, tmpCertDir)
 						bratsutils.CreateDB(dbConfig)
 
@@ -300,6 +300,8 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 			Context("Google Cloud SQL", func() {
 				Context("Mysql", func() {
 					BeforeEach(func() {
+						bratsutils.SkipUnlessConfigured(bratsutils.ExternalDBConfigFields("gcp_mysql", true)...)
+
 						dbConfig = bratsutils.LoadExternalDBConfig("gcp_mysql", true, tmpCertDir)
 						bratsutils.CreateDB(dbConfig)
 
@@ -311,6 +313,8 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 
 				Context("Postgres", func() {
 					BeforeEach(func() {
+						bratsutils.SkipUnlessConfigured(bratsutils.ExternalDBConfigFields("gcp_postgres", true)...)
+
 						dbConfig = bratsutils.LoadExternalDBConfig("gcp_postgres", true, tmpCertDir)
 						bratsutils.CreateDB(dbConfig)
 
@@ -353,7 +357,7 @@ var _ = Describe("Bosh Backup and Restore BBR", func() {
 
 			It("restores the blobstore files with the correct permissions/ownership", func() {
 				By("Upload a release", func() {
-					bratsutils.UploadRelease("https://bosh.io/d/github.com/cloudfoundry/syslog-release?v=11")
+					bratsutils.UploadRelease(bratsutils.ResolveArtifact("syslog@11"))
 				})
 
 				By("Store directory/file structure before we do backup", func() {
@@ -0,0 +1,306 @@
+package bratsutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// HMAlert is an alert as the health monitor plugins serialize it.
+type HMAlert struct {
+	Kind       string `json:"kind"`
+	ID         string `json:"id"`
+	Severity   int    `json:"severity"`
+	Category   string `json:"category"`
+	Title      string `json:"title"`
+	Summary    string `json:"summary"`
+	Source     string `json:"source"`
+	Deployment string `json:"deployment"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// Job returns the instance group of an agent alert, whose source looks like
+// "deployment: job(instance-id) [id=..., index=..., cid=...]", and an empty
+// string for any other alert.
+func (a HMAlert) Job() string {
+	return alertSourceJob(a.Source)
+}
+
+func alertSourceJob(source string) string {
+	prefix := strings.SplitN(source, "(", 2)[0]
+	parts := strings.SplitN(prefix, ": ", 2)
+	if len(parts) != 2 || len(prefix) == len(source) {
+		return ""
+	}
+	return parts[1]
+}
+
+// ReceivedRequest is a request one of the HTTP receivers served.
+type ReceivedRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   []byte
+}
+
+// httpReceiver records every request it serves and answers them with
+// respond, which stands in for the API of the real service.
+type httpReceiver struct {
+	server  *httptest.Server
+	respond func(http.ResponseWriter, ReceivedRequest)
+
+	mu       sync.Mutex
+	requests []ReceivedRequest
+}
+
+// newHTTPReceiver listens on a free port of host. httptest only ever listens
+// on the loopback interface, which jobs on other VMs can't reach.
+func newHTTPReceiver(host string, respond func(http.ResponseWriter, ReceivedRequest)) (*httpReceiver, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Listening on '%s'", host)
+	}
+
+	r := &httpReceiver{respond: respond}
+	r.server = httptest.NewUnstartedServer(http.HandlerFunc(r.serve))
+	r.server.Listener.Close()
+	r.server.Listener = listener
+	r.server.Start()
+	return r, nil
+}
+
+func (r *httpReceiver) serve(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	received := ReceivedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Body:   body,
+	}
+
+	r.mu.Lock()
+	r.requests = append(r.requests, received)
+	r.mu.Unlock()
+
+	r.respond(w, received)
+}
+
+func (r *httpReceiver) Port() int {
+	return r.server.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func (r *httpReceiver) Close() error {
+	r.server.Close()
+	return nil
+}
+
+// URL returns the receiver's base URL as seen by a client that reaches it
+// through host.
+func (r *httpReceiver) URL(host string) string {
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, fmt.Sprintf("%d", r.Port())))
+}
+
+// Requests returns every request served so far.
+func (r *httpReceiver) Requests() []ReceivedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ReceivedRequest{}, r.requests...)
+}
+
+// Reset forgets every request served so far.
+func (r *httpReceiver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = nil
+}
+
+// decodeRequests hands the body of every POST to path to decode. Bodies it
+// fails to decode are skipped.
+func (r *httpReceiver) decodeRequests(path string, decode func([]byte) error) {
+	for _, request := range r.Requests() {
+		if request.Method != "POST" || request.Path != path {
+			continue
+		}
+		decode(request.Body)
+	}
+}
+
+func writeReceiverJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+const PagerDutyEventsPath = "/generic/2010-04-15/create_event.json"
+
+// PagerDutyEvent is a request to PagerDuty's generic events API. The health
+// monitor puts the whole alert in the details.
+type PagerDutyEvent struct {
+	ServiceKey  string  `json:"service_key"`
+	EventType   string  `json:"event_type"`
+	IncidentKey string  `json:"incident_key"`
+	Description string  `json:"description"`
+	Details     HMAlert `json:"details"`
+}
+
+// PagerDutyReceiver stands in for PagerDuty's generic events API.
+type PagerDutyReceiver struct {
+	*httpReceiver
+}
+
+func NewPagerDutyReceiver(host string) (*PagerDutyReceiver, error) {
+	r, err := newHTTPReceiver(host, func(w http.ResponseWriter, request ReceivedRequest) {
+		if request.Path != PagerDutyEventsPath {
+			http.NotFound(w, nil)
+			return
+		}
+
+		var event PagerDutyEvent
+		if err := json.Unmarshal(request.Body, &event); err != nil {
+			writeReceiverJSON(w, http.StatusBadRequest, map[string]string{"status": "invalid event", "message": err.Error()})
+			return
+		}
+
+		writeReceiverJSON(w, http.StatusOK, map[string]string{
+			"status":       "success",
+			"message":      "Event processed",
+			"incident_key": event.IncidentKey,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PagerDutyReceiver{r}, nil
+}
+
+// EventsURL returns the URL to point hm.pagerduty.api_uri at.
+func (r *PagerDutyReceiver) EventsURL(host string) string {
+	return r.URL(host) + PagerDutyEventsPath
+}
+
+// Events returns the well-formed events received so far.
+func (r *PagerDutyReceiver) Events() []PagerDutyEvent {
+	var events []PagerDutyEvent
+	r.decodeRequests(PagerDutyEventsPath, func(body []byte) error {
+		var event PagerDutyEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+	return events
+}
+
+const (
+	DatadogSeriesPath = "/api/v1/series"
+	DatadogEventsPath = "/api/v1/events"
+)
+
+// DatadogSeries is one metric of a request to Datadog's series API. Points
+// are [timestamp, value] pairs.
+type DatadogSeries struct {
+	Metric string      `json:"metric"`
+	Points [][]float64 `json:"points"`
+	Type   string      `json:"type"`
+	Host   string      `json:"host"`
+	Tags   []string    `json:"tags"`
+}
+
+// DatadogEvent is a request to Datadog's events API.
+type DatadogEvent struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	DateHappened   int64    `json:"date_happened"`
+	Priority       string   `json:"priority"`
+	AlertType      string   `json:"alert_type"`
+	Tags           []string `json:"tags"`
+	Host           string   `json:"host"`
+	AggregationKey string   `json:"aggregation_key"`
+}
+
+// DatadogReceiver stands in for the series and events APIs of Datadog, the
+// only ones the health monitor uses.
+type DatadogReceiver struct {
+	*httpReceiver
+}
+
+func NewDatadogReceiver(host string) (*DatadogReceiver, error) {
+	r, err := newHTTPReceiver(host, func(w http.ResponseWriter, request ReceivedRequest) {
+		var body interface{}
+		switch request.Path {
+		case DatadogSeriesPath:
+			body = &struct {
+				Series []DatadogSeries `json:"series"`
+			}{}
+		case DatadogEventsPath:
+			body = &DatadogEvent{}
+		default:
+			http.NotFound(w, nil)
+			return
+		}
+
+		if request.Query.Get("api_key") == "" {
+			writeReceiverJSON(w, http.StatusForbidden, map[string][]string{"errors": {"API key required"}})
+			return
+		}
+		if err := json.Unmarshal(request.Body, body); err != nil {
+			writeReceiverJSON(w, http.StatusBadRequest, map[string][]string{"errors": {err.Error()}})
+			return
+		}
+
+		if event, ok := body.(*DatadogEvent); ok {
+			writeReceiverJSON(w, http.StatusAccepted, map[string]interface{}{"status": "ok", "event": event})
+			return
+		}
+		writeReceiverJSON(w, http.StatusAccepted, map[string]string{"status": "ok"})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &DatadogReceiver{r}, nil
+}
+
+// Series returns the metrics of the well-formed series requests received so
+// far.
+func (r *DatadogReceiver) Series() []DatadogSeries {
+	var series []DatadogSeries
+	r.decodeRequests(DatadogSeriesPath, func(body []byte) error {
+		var request struct {
+			Series []DatadogSeries `json:"series"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return err
+		}
+		series = append(series, request.Series...)
+		return nil
+	})
+	return series
+}
+
+// Events returns the well-formed events received so far.
+func (r *DatadogReceiver) Events() []DatadogEvent {
+	var events []DatadogEvent
+	r.decodeRequests(DatadogEventsPath, func(body []byte) error {
+		var event DatadogEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+	return events
+}
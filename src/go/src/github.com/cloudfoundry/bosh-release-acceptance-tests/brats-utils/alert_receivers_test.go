@@ -0,0 +1,141 @@
+package bratsutils_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("alert receivers", func() {
+	post := func(url, body string) (int, string) {
+		response, err := http.Post(url, "application/json", strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		defer response.Body.Close()
+
+		responseBody, err := ioutil.ReadAll(response.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return response.StatusCode, string(responseBody)
+	}
+
+	Describe("HMAlert", func() {
+		It("takes the job of agent alerts from their source", func() {
+			alert := bratsutils.HMAlert{Source: "syslog-deployment: syslog_storer(4b1c8c4e-7f0e-4d6b-a3a7-5c2a8c3ec9f1) [id=agent-1, index=0, cid=vm-1]"}
+			Expect(alert.Job()).To(Equal("syslog_storer"))
+
+			Expect(bratsutils.HMAlert{Source: "director"}.Job()).To(BeEmpty())
+		})
+	})
+
+	Describe("PagerDutyReceiver", func() {
+		var receiver *bratsutils.PagerDutyReceiver
+
+		BeforeEach(func() {
+			var err error
+			receiver, err = bratsutils.NewPagerDutyReceiver("127.0.0.1")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			receiver.Close()
+		})
+
+		It("records events and answers like PagerDuty", func() {
+			status, body := post(receiver.EventsURL("127.0.0.1"), `{
+				"service_key": "key",
+				"event_type": "trigger",
+				"incident_key": "alert-1",
+				"description": "Alert: process is not running",
+				"details": {"kind": "alert", "id": "alert-1", "severity": 1, "title": "syslog_storer (10.0.0.5) - Does not exist - restart", "deployment": "syslog-deployment", "created_at": 1500000000}
+			}`)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(ContainSubstring(`"incident_key":"alert-1"`))
+
+			Expect(receiver.Events()).To(Equal([]bratsutils.PagerDutyEvent{{
+				ServiceKey:  "key",
+				EventType:   "trigger",
+				IncidentKey: "alert-1",
+				Description: "Alert: process is not running",
+				Details: bratsutils.HMAlert{
+					Kind:       "alert",
+					ID:         "alert-1",
+					Severity:   1,
+					Title:      "syslog_storer (10.0.0.5) - Does not exist - restart",
+					Deployment: "syslog-deployment",
+					CreatedAt:  1500000000,
+				},
+			}}))
+		})
+
+		It("rejects malformed events and other paths", func() {
+			status, _ := post(receiver.EventsURL("127.0.0.1"), "not json")
+			Expect(status).To(Equal(http.StatusBadRequest))
+
+			status, _ = post(receiver.URL("127.0.0.1")+"/v2/enqueue", "{}")
+			Expect(status).To(Equal(http.StatusNotFound))
+
+			Expect(receiver.Requests()).To(HaveLen(2))
+			Expect(receiver.Events()).To(BeEmpty())
+		})
+
+		It("forgets requests on reset", func() {
+			post(receiver.EventsURL("127.0.0.1"), `{"event_type": "trigger"}`)
+			receiver.Reset()
+
+			Expect(receiver.Requests()).To(BeEmpty())
+		})
+	})
+
+	Describe("DatadogReceiver", func() {
+		var receiver *bratsutils.DatadogReceiver
+
+		BeforeEach(func() {
+			var err error
+			receiver, err = bratsutils.NewDatadogReceiver("127.0.0.1")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			receiver.Close()
+		})
+
+		It("records series and events", func() {
+			status, _ := post(receiver.URL("127.0.0.1")+bratsutils.DatadogSeriesPath+"?api_key=key", `{"series": [
+				{"metric": "bosh.healthmonitor.system.healthy", "points": [[1500000000, 1.0]], "type": "gauge", "host": null, "tags": ["job:syslog_storer", "env:brats"]}
+			]}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+
+			status, body := post(receiver.URL("127.0.0.1")+bratsutils.DatadogEventsPath+"?api_key=key", `{
+				"title": "Does not exist", "text": "syslog_storer is not running @pagerduty-brats", "date_happened": 1500000000,
+				"priority": "normal", "alert_type": "error", "tags": ["source:syslog-deployment: syslog_storer(abc)", "deployment:syslog-deployment"]
+			}`)
+			Expect(status).To(Equal(http.StatusAccepted))
+			Expect(body).To(ContainSubstring(`"status":"ok"`))
+
+			Expect(receiver.Series()).To(Equal([]bratsutils.DatadogSeries{{
+				Metric: "bosh.healthmonitor.system.healthy",
+				Points: [][]float64{{1500000000, 1}},
+				Type:   "gauge",
+				Tags:   []string{"job:syslog_storer", "env:brats"},
+			}}))
+			Expect(receiver.Events()).To(Equal([]bratsutils.DatadogEvent{{
+				Title:        "Does not exist",
+				Text:         "syslog_storer is not running @pagerduty-brats",
+				DateHappened: 1500000000,
+				Priority:     "normal",
+				AlertType:    "error",
+				Tags:         []string{"source:syslog-deployment: syslog_storer(abc)", "deployment:syslog-deployment"},
+			}}))
+			Expect(receiver.Requests()[0].Query.Get("api_key")).To(Equal("key"))
+		})
+
+		It("rejects requests without an API key", func() {
+			status, _ := post(receiver.URL("127.0.0.1")+bratsutils.DatadogEventsPath, `{"title": "Does not exist"}`)
+			Expect(status).To(Equal(http.StatusForbidden))
+		})
+	})
+})
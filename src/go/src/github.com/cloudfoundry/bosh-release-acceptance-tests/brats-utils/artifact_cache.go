@@ -0,0 +1,258 @@
+package bratsutils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/onsi/gomega"
+)
+
+// ArtifactLock pins the releases and stemcells the suites upload, keyed by a
+// logical name such as syslog@11.
+type ArtifactLock struct {
+	Artifacts map[string]LockedArtifact `yaml:"artifacts"`
+}
+
+type LockedArtifact struct {
+	URL string `yaml:"url"`
+
+	// SHA1 is the one bosh.io lists for the artifact. Every entry needs
+	// one, so that nothing is ever uploaded unchecked.
+	SHA1 string `yaml:"sha1"`
+}
+
+func LoadArtifactLock(path string) (*ArtifactLock, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading artifact lock '%s'", path)
+	}
+
+	lock := &ArtifactLock{}
+	if err := yaml.UnmarshalStrict(contents, lock); err != nil {
+		return nil, bosherr.WrapErrorf(err, "Parsing artifact lock '%s'", path)
+	}
+
+	for _, name := range lock.Names() {
+		if err := lock.Artifacts[name].validate(); err != nil {
+			return nil, bosherr.WrapErrorf(err, "Artifact '%s' in lock '%s'", name, path)
+		}
+	}
+	return lock, nil
+}
+
+func (a LockedArtifact) validate() error {
+	if a.URL == "" {
+		return bosherr.Error("Expected a URL")
+	}
+	if !sha1Pattern.MatchString(a.SHA1) {
+		return bosherr.Errorf("Expected a SHA1 of 40 hex digits, got '%s'", a.SHA1)
+	}
+	return nil
+}
+
+var sha1Pattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func (l *ArtifactLock) Names() []string {
+	var names []string
+	for name := range l.Artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ArtifactCache resolves locked artifacts to tarballs in a local directory,
+// so that the suites can run without internet access.
+type ArtifactCache struct {
+	dir        string
+	lock       *ArtifactLock
+	httpClient *http.Client
+}
+
+func NewArtifactCache(dir string, lock *ArtifactLock, httpClient *http.Client) *ArtifactCache {
+	return &ArtifactCache{dir: dir, lock: lock, httpClient: httpClient}
+}
+
+// Path returns the cached tarball for the artifact after checking it against
+// the lock. It never downloads anything.
+func (c *ArtifactCache) Path(name string) (string, error) {
+	locked, err := c.locked(name)
+	if err != nil {
+		return "", err
+	}
+
+	path := c.tarballPath(name)
+	found, err := fileExists(path)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Checking cache for artifact '%s'", name)
+	}
+	if !found {
+		return "", bosherr.Errorf("Artifact '%s' is not in the cache at '%s', prefetch it from '%s'", name, path, locked.URL)
+	}
+
+	actual, err := fileSHA1(path)
+	if err != nil {
+		return "", err
+	}
+	if actual != locked.SHA1 {
+		return "", bosherr.Errorf("Artifact '%s' at '%s' has SHA1 '%s', expected '%s' from the lock", name, path, actual, locked.SHA1)
+	}
+
+	return path, nil
+}
+
+// Prefetch downloads every named artifact that is not cached yet, or all of
+// them when no names are given, and checks each against the lock.
+func (c *ArtifactCache) Prefetch(names ...string) error {
+	if len(names) == 0 {
+		names = c.lock.Names()
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return bosherr.WrapErrorf(err, "Creating artifact cache '%s'", c.dir)
+	}
+
+	for _, name := range names {
+		locked, err := c.locked(name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := c.Path(name); err == nil {
+			continue
+		}
+
+		actual, err := c.download(name, locked.URL)
+		if err != nil {
+			return err
+		}
+
+		if actual != locked.SHA1 {
+			os.Remove(c.tarballPath(name))
+			return bosherr.Errorf("Downloaded artifact '%s' from '%s' has SHA1 '%s', expected '%s' from the lock", name, locked.URL, actual, locked.SHA1)
+		}
+	}
+
+	return nil
+}
+
+func (c *ArtifactCache) locked(name string) (LockedArtifact, error) {
+	locked, found := c.lock.Artifacts[name]
+	if !found {
+		return LockedArtifact{}, bosherr.Errorf("Artifact '%s' is not in the lock", name)
+	}
+	if locked.SHA1 == "" {
+		return LockedArtifact{}, bosherr.Errorf("Artifact '%s' has no SHA1 in the lock", name)
+	}
+	return locked, nil
+}
+
+func (c *ArtifactCache) tarballPath(name string) string {
+	return filepath.Join(c.dir, name+".tgz")
+}
+
+// download writes to a temporary file first so that an interrupted download
+// never looks like a cached tarball.
+func (c *ArtifactCache) download(name, url string) (string, error) {
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Downloading artifact '%s' from '%s'", name, url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", bosherr.Errorf("Downloading artifact '%s' from '%s': status %d", name, url, resp.StatusCode)
+	}
+
+	tempFile, err := ioutil.TempFile(c.dir, name)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Creating download file for artifact '%s'", name)
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(io.MultiWriter(tempFile, hash), resp.Body); err != nil {
+		return "", bosherr.WrapErrorf(err, "Downloading artifact '%s' from '%s'", name, url)
+	}
+	if err := tempFile.Close(); err != nil {
+		return "", bosherr.WrapErrorf(err, "Writing artifact '%s'", name)
+	}
+
+	if err := os.Rename(tempFile.Name(), c.tarballPath(name)); err != nil {
+		return "", bosherr.WrapErrorf(err, "Moving artifact '%s' into the cache", name)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func fileSHA1(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Opening '%s'", path)
+	}
+	defer file.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", bosherr.WrapErrorf(err, "Reading '%s'", path)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+var (
+	artifactLockOnce sync.Once
+	artifactLock     *ArtifactLock
+)
+
+// ArtifactLockPath is the lock in the assets unless configured otherwise.
+func ArtifactLockPath() string {
+	if path := SuiteConfig().ArtifactLockPath; path != "" {
+		return path
+	}
+	return AssetPath("artifacts.lock.yml")
+}
+
+// ResolveArtifact returns what to upload for a locked release or stemcell:
+// the cached tarball when artifact_cache_path is configured, and its URL
+// otherwise.
+func ResolveArtifact(name string) string {
+	artifactLockOnce.Do(func() {
+		var err error
+		artifactLock, err = LoadArtifactLock(ArtifactLockPath())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	cacheDir := SuiteConfig().ArtifactCachePath
+	if cacheDir == "" {
+		locked, found := artifactLock.Artifacts[name]
+		Expect(found).To(BeTrue(), fmt.Sprintf("Artifact '%s' is not in the lock", name))
+		return locked.URL
+	}
+
+	path, err := NewArtifactCache(cacheDir, artifactLock, http.DefaultClient).Path(name)
+	Expect(err).ToNot(HaveOccurred())
+	return path
+}
+
+// ResolveArtifactURL is ResolveArtifact for manifests, which take URLs rather
+// than paths, such as releases co-located on the inner director.
+func ResolveArtifactURL(name string) string {
+	resolved := ResolveArtifact(name)
+	if SuiteConfig().ArtifactCachePath == "" {
+		return resolved
+	}
+	return "file://" + resolved
+}
@@ -0,0 +1,168 @@
+package bratsutils_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ArtifactCache", func() {
+	const (
+		tarball     = "syslog release tarball"
+		tarballSHA1 = "22b99884fed47eaa38dcb508ec13b5eab2a6c477"
+	)
+
+	var (
+		cacheDir  string
+		server    *httptest.Server
+		downloads int
+		lock      *bratsutils.ArtifactLock
+		cache     *bratsutils.ArtifactCache
+	)
+
+	BeforeEach(func() {
+		var err error
+		cacheDir, err = ioutil.TempDir("", "artifact-cache")
+		Expect(err).ToNot(HaveOccurred())
+
+		downloads = 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/syslog" {
+				http.NotFound(w, r)
+				return
+			}
+			downloads++
+			w.Write([]byte(tarball))
+		}))
+
+		lock = &bratsutils.ArtifactLock{Artifacts: map[string]bratsutils.LockedArtifact{
+			"syslog@11":  {URL: server.URL + "/syslog", SHA1: tarballSHA1},
+			"os-conf@12": {URL: server.URL + "/os-conf", SHA1: "abc"},
+		}}
+		cache = bratsutils.NewArtifactCache(cacheDir, lock, http.DefaultClient)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(cacheDir)
+	})
+
+	Describe("Path", func() {
+		It("fails for artifacts that are not locked", func() {
+			_, err := cache.Path("dns@1")
+			Expect(err).To(MatchError("Artifact 'dns@1' is not in the lock"))
+		})
+
+		It("fails for artifacts without a SHA1", func() {
+			lock.Artifacts["syslog@11"] = bratsutils.LockedArtifact{URL: server.URL + "/syslog"}
+
+			_, err := cache.Path("syslog@11")
+			Expect(err).To(MatchError("Artifact 'syslog@11' has no SHA1 in the lock"))
+		})
+
+		It("fails clearly when the artifact was not prefetched", func() {
+			_, err := cache.Path("os-conf@12")
+			Expect(err).To(MatchError(ContainSubstring("Artifact 'os-conf@12' is not in the cache")))
+			Expect(err).To(MatchError(ContainSubstring(server.URL + "/os-conf")))
+		})
+
+		It("rejects tarballs that do not match the lock", func() {
+			err := ioutil.WriteFile(filepath.Join(cacheDir, "os-conf@12.tgz"), []byte("something else"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = cache.Path("os-conf@12")
+			Expect(err).To(MatchError(ContainSubstring("expected 'abc' from the lock")))
+		})
+	})
+
+	Describe("Prefetch", func() {
+		It("downloads artifacts and serves them from the cache", func() {
+			Expect(cache.Prefetch("syslog@11")).To(Succeed())
+
+			path, err := cache.Path("syslog@11")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(path).To(Equal(filepath.Join(cacheDir, "syslog@11.tgz")))
+
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal(tarball))
+		})
+
+		It("does not download artifacts that are already cached", func() {
+			Expect(cache.Prefetch("syslog@11")).To(Succeed())
+			Expect(cache.Prefetch("syslog@11")).To(Succeed())
+			Expect(downloads).To(Equal(1))
+		})
+
+		It("rejects downloads that do not match the lock", func() {
+			lock.Artifacts["syslog@11"] = bratsutils.LockedArtifact{URL: server.URL + "/syslog", SHA1: "abc"}
+
+			err := cache.Prefetch("syslog@11")
+			Expect(err).To(MatchError(ContainSubstring("has SHA1 '" + tarballSHA1 + "', expected 'abc'")))
+
+			_, err = os.Stat(filepath.Join(cacheDir, "syslog@11.tgz"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("refuses artifacts without a SHA1", func() {
+			lock.Artifacts["syslog@11"] = bratsutils.LockedArtifact{URL: server.URL + "/syslog"}
+
+			Expect(cache.Prefetch("syslog@11")).To(MatchError("Artifact 'syslog@11' has no SHA1 in the lock"))
+			Expect(downloads).To(BeZero())
+		})
+
+		It("fails when the download fails", func() {
+			err := cache.Prefetch()
+			Expect(err).To(MatchError(ContainSubstring("Downloading artifact 'os-conf@12'")))
+		})
+	})
+
+	Describe("LoadArtifactLock", func() {
+		writeLock := func(contents string) string {
+			path := filepath.Join(cacheDir, "artifacts.lock.yml")
+			Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+			return path
+		}
+
+		It("loads locked artifacts", func() {
+			loaded, err := bratsutils.LoadArtifactLock(writeLock(`---
+artifacts:
+  syslog@11: {url: "https://example.com/syslog", sha1: "` + tarballSHA1 + `"}
+  os-conf@12: {url: "https://example.com/os-conf", sha1: "` + tarballSHA1 + `"}
+`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded.Names()).To(Equal([]string{"os-conf@12", "syslog@11"}))
+			Expect(loaded.Artifacts["syslog@11"]).To(Equal(bratsutils.LockedArtifact{URL: "https://example.com/syslog", SHA1: tarballSHA1}))
+		})
+
+		It("rejects artifacts without a SHA1", func() {
+			_, err := bratsutils.LoadArtifactLock(writeLock(`---
+artifacts:
+  syslog@11: {url: "https://example.com/syslog", sha1: ""}
+`))
+			Expect(err).To(MatchError(ContainSubstring("Artifact 'syslog@11' in lock")))
+			Expect(err).To(MatchError(ContainSubstring("Expected a SHA1 of 40 hex digits, got ''")))
+		})
+
+		It("rejects artifacts without a URL", func() {
+			_, err := bratsutils.LoadArtifactLock(writeLock(`---
+artifacts:
+  syslog@11: {sha1: "` + tarballSHA1 + `"}
+`))
+			Expect(err).To(MatchError(ContainSubstring("Expected a URL")))
+		})
+	})
+
+	It("loads the lock in the assets", func() {
+		loaded, err := bratsutils.LoadArtifactLock("../assets/artifacts.lock.yml")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded.Names()).To(ConsistOf("os-conf@12", "syslog@11"))
+	})
+})
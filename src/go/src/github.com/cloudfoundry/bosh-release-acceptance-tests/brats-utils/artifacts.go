@@ -0,0 +1,130 @@
+package bratsutils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"github.com/onsi/ginkgo/config"
+
+	. "github.com/onsi/ginkgo"
+)
+
+var unsafeArtifactChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ArtifactDir is the directory for one spec's artifacts, named after the
+// parallel node and the spec so that concurrent failures never collide.
+func ArtifactDir(root string, node int, specText string) string {
+	name := unsafeArtifactChars.ReplaceAllString(specText, "_")
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	return filepath.Join(root, fmt.Sprintf("node-%d", node), name)
+}
+
+// FailureArtifacts gathers what is needed to debug a failed spec: the
+// director's logs and rendered config, and the debug logs of its most recent
+// tasks.
+type FailureArtifacts struct {
+	Dir           string
+	InnerDirector InnerDirector
+	Director      TaskDirector
+	TaskLimit     int
+}
+
+// Collect keeps going when one kind of artifact cannot be fetched, and
+// reports everything that went wrong at the end.
+func (a FailureArtifacts) Collect() error {
+	if err := os.MkdirAll(a.Dir, 0755); err != nil {
+		return bosherr.WrapErrorf(err, "Creating artifact directory '%s'", a.Dir)
+	}
+
+	var errs []error
+
+	if err := a.InnerDirector.CollectLogs(filepath.Join(a.Dir, "logs")); err != nil {
+		errs = append(errs, bosherr.WrapError(err, "Collecting director logs"))
+	}
+
+	if a.Director != nil {
+		if err := a.collectTasks(filepath.Join(a.Dir, "tasks")); err != nil {
+			errs = append(errs, bosherr.WrapError(err, "Collecting task logs"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return bosherr.NewMultiError(errs...)
+	}
+	return nil
+}
+
+func (a FailureArtifacts) collectTasks(dest string) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return bosherr.WrapErrorf(err, "Creating '%s'", dest)
+	}
+
+	tasks, err := a.Director.Tasks(director.TasksFilter{Limit: a.TaskLimit, All: true})
+	if err != nil {
+		return bosherr.WrapError(err, "Listing recent tasks")
+	}
+
+	for _, task := range tasks {
+		for _, outputType := range []string{director.TaskOutputDebug, director.TaskOutputEvent} {
+			output, err := a.Director.TaskOutput(task.ID, outputType)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Fetching %s output of task %d", outputType, task.ID)
+			}
+
+			path := filepath.Join(dest, fmt.Sprintf("%d.%s.log", task.ID, outputType))
+			if err := ioutil.WriteFile(path, []byte(output), 0644); err != nil {
+				return bosherr.WrapErrorf(err, "Writing '%s'", path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// collectedArtifactsFor is the spec whose artifacts were collected last, so
+// that a spec is collected once however many hooks ask.
+var collectedArtifactsFor string
+
+// CollectFailureArtifacts is meant to be registered with a top-level
+// AfterEach. Those run after the nested ones, so StopInnerBosh collects too,
+// while the director still exists. It does nothing unless the spec failed
+// and artifacts_path is configured, and never fails the spec itself.
+func CollectFailureArtifacts() {
+	description := CurrentGinkgoTestDescription()
+	root := SuiteConfig().ArtifactsPath
+
+	if !description.Failed || root == "" || innerDirector == nil || !innerDirector.Exists() {
+		return
+	}
+	if collectedArtifactsFor == description.FullTestText {
+		return
+	}
+	collectedArtifactsFor = description.FullTestText
+
+	defer StartPhase(PhaseTeardown)()
+
+	artifacts := FailureArtifacts{
+		Dir:           ArtifactDir(root, config.GinkgoConfig.ParallelNode, description.FullTestText),
+		InnerDirector: innerDirector,
+		TaskLimit:     10,
+	}
+
+	client, err := newDirectorClient()
+	if err != nil {
+		fmt.Fprintf(GinkgoWriter, "Skipping task logs, cannot reach the director: %s\n", err)
+	} else {
+		artifacts.Director = client
+	}
+
+	if err := artifacts.Collect(); err != nil {
+		fmt.Fprintf(GinkgoWriter, "Collecting failure artifacts: %s\n", err)
+	}
+	fmt.Fprintf(GinkgoWriter, "Failure artifacts written to %s\n", artifacts.Dir)
+}
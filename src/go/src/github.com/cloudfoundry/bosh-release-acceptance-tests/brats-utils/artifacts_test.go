@@ -0,0 +1,100 @@
+package bratsutils_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeInnerDirector struct {
+	bratsutils.InnerDirector
+
+	collectErr error
+}
+
+func (f *fakeInnerDirector) CollectLogs(dest string) error {
+	if f.collectErr != nil {
+		return f.collectErr
+	}
+
+	Expect(os.MkdirAll(filepath.Join(dest, "director"), 0755)).To(Succeed())
+	return ioutil.WriteFile(filepath.Join(dest, "director", "director.debug.log"), []byte("director log"), 0644)
+}
+
+var _ = Describe("FailureArtifacts", func() {
+	var (
+		root      string
+		artifacts bratsutils.FailureArtifacts
+		tasks     *fakeTaskDirector
+	)
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "artifacts")
+		Expect(err).ToNot(HaveOccurred())
+
+		tasks = &fakeTaskDirector{
+			debugLog: "task debug log",
+			polls:    []taskPoll{{events: "task events"}},
+			tasks:    []director.Task{{ID: 3}, {ID: 4}},
+		}
+
+		artifacts = bratsutils.FailureArtifacts{
+			Dir:           filepath.Join(root, "spec"),
+			InnerDirector: &fakeInnerDirector{},
+			Director:      tasks,
+			TaskLimit:     5,
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("collects the director logs and recent task logs", func() {
+		Expect(artifacts.Collect()).To(Succeed())
+
+		Expect(tasks.tasksFilter).To(Equal(director.TasksFilter{Limit: 5, All: true}))
+
+		contents, err := ioutil.ReadFile(filepath.Join(root, "spec", "logs", "director", "director.debug.log"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(Equal("director log"))
+
+		contents, err = ioutil.ReadFile(filepath.Join(root, "spec", "tasks", "4.debug.log"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(Equal("task debug log"))
+
+		contents, err = ioutil.ReadFile(filepath.Join(root, "spec", "tasks", "3.event.log"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(Equal("task events"))
+	})
+
+	It("still collects task logs when the director logs cannot be fetched", func() {
+		artifacts.InnerDirector = &fakeInnerDirector{collectErr: errors.New("ssh failed")}
+
+		err := artifacts.Collect()
+		Expect(err).To(MatchError(ContainSubstring("ssh failed")))
+
+		_, err = os.Stat(filepath.Join(root, "spec", "tasks", "3.debug.log"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Describe("ArtifactDir", func() {
+		It("nests the spec under its parallel node", func() {
+			dir := bratsutils.ArtifactDir("/artifacts", 2, "Blobstore SSL with allow_http true allows http connections")
+			Expect(dir).To(Equal("/artifacts/node-2/Blobstore_SSL_with_allow_http_true_allows_http_connections"))
+		})
+
+		It("replaces characters that do not belong in paths", func() {
+			dir := bratsutils.ArtifactDir("/artifacts", 1, "BBR database backup (mysql/tls): restores")
+			Expect(dir).To(Equal("/artifacts/node-1/BBR_database_backup_mysql_tls_restores"))
+		})
+	})
+})
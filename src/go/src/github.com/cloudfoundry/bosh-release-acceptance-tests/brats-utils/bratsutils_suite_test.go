@@ -0,0 +1,13 @@
+package bratsutils_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestBratsUtils(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "BratsUtils Suite")
+}
@@ -0,0 +1,140 @@
+package bratsutils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// CEFEvent is a record in ArcSight's Common Event Format, which both the
+// director's audit log and the blobstore's access log write.
+type CEFEvent struct {
+	Version       int
+	DeviceVendor  string
+	DeviceProduct string
+	DeviceVersion string
+	SignatureID   string
+	Name          string
+	Severity      string
+
+	Extension map[string]string
+}
+
+// Labeled returns the value of the custom field, like cs1, whose label
+// field, like cs1Label, is the given label.
+func (e CEFEvent) Labeled(label string) (string, bool) {
+	for key, value := range e.Extension {
+		if strings.HasSuffix(key, "Label") && value == label {
+			field, found := e.Extension[strings.TrimSuffix(key, "Label")]
+			return field, found
+		}
+	}
+	return "", false
+}
+
+// cefExtensionKey matches the start of a key-value pair in the extension.
+// CEF keys are camel case. Insisting on that, rather than taking any word
+// followed by an equals sign, keeps the director's list of HTTP headers in
+// cs2, whose upper case names it doesn't escape, in one value.
+var cefExtensionKey = regexp.MustCompile(`^[a-z][A-Za-z0-9_.]*=`)
+
+// ParseCEF parses the CEF record in a log line, ignoring whatever the
+// logger put in front of it.
+func ParseCEF(line string) (CEFEvent, error) {
+	start := strings.Index(line, "CEF:")
+	if start < 0 {
+		return CEFEvent{}, bosherr.Errorf("Expected a CEF record in '%s'", line)
+	}
+	rest := strings.TrimRight(line[start+len("CEF:"):], "\r\n")
+
+	var header []string
+	var field strings.Builder
+	var extension string
+fields:
+	for i := 0; i < len(rest); i++ {
+		switch {
+		case rest[i] == '\\' && i+1 < len(rest) && (rest[i+1] == '|' || rest[i+1] == '\\'):
+			i++
+			field.WriteByte(rest[i])
+		case rest[i] == '|':
+			header = append(header, field.String())
+			field.Reset()
+			if len(header) == 7 {
+				extension = rest[i+1:]
+				break fields
+			}
+		default:
+			field.WriteByte(rest[i])
+		}
+	}
+	if len(header) < 7 {
+		return CEFEvent{}, bosherr.Errorf("Expected 7 header fields in CEF record '%s'", line[start:])
+	}
+
+	version, err := strconv.Atoi(header[0])
+	if err != nil {
+		return CEFEvent{}, bosherr.WrapErrorf(err, "Parsing CEF version '%s'", header[0])
+	}
+
+	return CEFEvent{
+		Version:       version,
+		DeviceVendor:  header[1],
+		DeviceProduct: header[2],
+		DeviceVersion: header[3],
+		SignatureID:   header[4],
+		Name:          header[5],
+		Severity:      header[6],
+		Extension:     parseCEFExtension(extension),
+	}, nil
+}
+
+func parseCEFExtension(extension string) map[string]string {
+	pairs := map[string]string{}
+
+	var key string
+	var value []string
+	flush := func() {
+		if key != "" {
+			pairs[key] = unescapeCEFValue(strings.Join(value, " "))
+		}
+	}
+
+	for _, word := range strings.Split(extension, " ") {
+		if cefExtensionKey.MatchString(word) {
+			flush()
+			equals := strings.Index(word, "=")
+			key, value = word[:equals], []string{word[equals+1:]}
+		} else if key != "" {
+			value = append(value, word)
+		}
+	}
+	flush()
+
+	return pairs
+}
+
+var cefValueEscapes = strings.NewReplacer(`\\`, `\`, `\=`, `=`, `\n`, "\n", `\r`, "\r")
+
+func unescapeCEFValue(value string) string {
+	return cefValueEscapes.Replace(value)
+}
+
+// ParseCEFLog parses every line of a log that has a CEF record, e.g. the
+// director's audit log, which also has the JSON of every event.
+func ParseCEFLog(content string) ([]CEFEvent, error) {
+	var events []CEFEvent
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.Contains(line, "CEF:") {
+			continue
+		}
+
+		event, err := ParseCEF(line)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,90 @@
+package bratsutils_test
+
+import (
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CEF", func() {
+	It("parses the blobstore's access log format", func() {
+		event, err := bratsutils.ParseCEF("CEF:0|CloudFoundry|BOSH|-|blobstore_api|/brats/blob|1|" +
+			"requestClientApplication=agent requestMethod=PUT src=10.0.0.1 spt=52000 " +
+			"cs1=Basic cs1Label=authType cs2=201 cs2Label=responseStatus")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(event).To(Equal(bratsutils.CEFEvent{
+			Version:       0,
+			DeviceVendor:  "CloudFoundry",
+			DeviceProduct: "BOSH",
+			DeviceVersion: "-",
+			SignatureID:   "blobstore_api",
+			Name:          "/brats/blob",
+			Severity:      "1",
+			Extension: map[string]string{
+				"requestClientApplication": "agent",
+				"requestMethod":            "PUT",
+				"src":                      "10.0.0.1",
+				"spt":                      "52000",
+				"cs1":                      "Basic",
+				"cs1Label":                 "authType",
+				"cs2":                      "201",
+				"cs2Label":                 "responseStatus",
+			},
+		}))
+
+		status, found := event.Labeled("responseStatus")
+		Expect(found).To(BeTrue())
+		Expect(status).To(Equal("201"))
+
+		_, found = event.Labeled("statusReason")
+		Expect(found).To(BeFalse())
+	})
+
+	It("parses the director's audit log format behind the logger's prefix", func() {
+		event, err := bratsutils.ParseCEF("I, [2018-06-01T10:00:00.123456 #1234] [0x2b0a]  INFO -- DirectorAudit: " +
+			"CEF:0|CloudFoundry|BOSH|1.0000.0|director_api|/deployments|7|" +
+			"requestMethod=GET src=10.0.0.1 spt=25556 shost=director " +
+			"cs1=10.245.0.3,fd7a::3 cs1Label=ips " +
+			"cs2=HOST=10.245.0.3&X_REAL_IP=10.0.0.1&USER_AGENT=Go-http-client/1.1 cs2Label=httpHeaders " +
+			"cs3=none cs3Label=authType cs4=401 cs4Label=responseStatus " +
+			`cs5=Not authorized: '/deployments' cs5Label=statusReason` + "\n")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(event.DeviceVersion).To(Equal("1.0000.0"))
+		Expect(event.Severity).To(Equal("7"))
+		Expect(event.Extension).To(HaveKeyWithValue("cs2", "HOST=10.245.0.3&X_REAL_IP=10.0.0.1&USER_AGENT=Go-http-client/1.1"))
+		reason, found := event.Labeled("statusReason")
+		Expect(found).To(BeTrue())
+		Expect(reason).To(Equal("Not authorized: '/deployments'"))
+	})
+
+	It("unescapes header fields and extension values", func() {
+		event, err := bratsutils.ParseCEF(`CEF:0|Vendor\|Inc|BOSH|-|sig|C:\\path|1|msg=a\=b\nc key=last`)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(event.DeviceVendor).To(Equal("Vendor|Inc"))
+		Expect(event.Name).To(Equal(`C:\path`))
+		Expect(event.Extension).To(Equal(map[string]string{"msg": "a=b\nc", "key": "last"}))
+	})
+
+	It("rejects records with too few header fields", func() {
+		_, err := bratsutils.ParseCEF("CEF:0|CloudFoundry|BOSH")
+		Expect(err).To(MatchError(ContainSubstring("Expected 7 header fields")))
+
+		_, err = bratsutils.ParseCEF("not a CEF record")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("parses only the lines of a log that have CEF records", func() {
+		events, err := bratsutils.ParseCEFLog(
+			`I, [...]  INFO -- DirectorAudit: {"id":"1","action":"create"}` + "\n" +
+				"I, [...]  INFO -- DirectorAudit: CEF:0|CloudFoundry|BOSH|1|director_api|/info|1|requestMethod=GET\n" +
+				"I, [...]  INFO -- DirectorAudit: CEF:0|CloudFoundry|BOSH|1|director_api|/deployments|1|requestMethod=GET\n")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(events).To(HaveLen(2))
+		Expect(events[1].Name).To(Equal("/deployments"))
+	})
+})
@@ -0,0 +1,343 @@
+package bratsutils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/onsi/ginkgo"
+)
+
+// ConfigPathEnv names the environment variable pointing at an optional YAML
+// file with the suite configuration. Environment variables always win over
+// values from the file.
+const ConfigPathEnv = "BRATS_CONFIG_PATH"
+
+type ExternalDBSettings struct {
+	Host              string `yaml:"host"`
+	User              string `yaml:"user"`
+	Password          string `yaml:"password"`
+	CA                string `yaml:"ca"`
+	ClientCertificate string `yaml:"client_certificate"`
+	ClientPrivateKey  string `yaml:"client_private_key"`
+}
+
+type Config struct {
+	BoshBinaryPath               string `yaml:"bosh_binary_path"`
+	BoshEnvironment              string `yaml:"bosh_environment"`
+	BoshDeploymentPath           string `yaml:"bosh_deployment_path"`
+	BoshDirectorReleasePath      string `yaml:"bosh_director_release_path"`
+	BoshRelease                  string `yaml:"bosh_release"`
+	StemcellOS                   string `yaml:"stemcell_os"`
+	CandidateStemcellTarballPath string `yaml:"candidate_stemcell_tarball_path"`
+	DNSReleasePath               string `yaml:"dns_release_path"`
+	BoshDNSAddonOpsFilePath      string `yaml:"bosh_dns_addon_ops_file_path"`
+	BBRBinaryPath                string `yaml:"bbr_binary_path"`
+	BBRReleasePath               string `yaml:"bbr_release_path"`
+
+	// InnerDirector selects how the director under test runs, either
+	// "script" (the default) or "local".
+	InnerDirector            string `yaml:"inner_director"`
+	InnerDirectorScriptsPath string `yaml:"inner_director_scripts_path"`
+	BoshSrcPath              string `yaml:"bosh_src_path"`
+
+	// InnerDirectorRoot holds a directory per slot with the inner director's
+	// vars store and CLI wrapper, /tmp/inner-bosh/director by default.
+	InnerDirectorRoot string `yaml:"inner_director_root"`
+
+	// ArtifactsPath is where logs of failed specs are collected; nothing is
+	// collected without it.
+	ArtifactsPath string `yaml:"artifacts_path"`
+
+	// ReportsPath is where JUnit and JSON reports are written; there are
+	// none without it.
+	ReportsPath string `yaml:"reports_path"`
+
+	// ArtifactCachePath makes the suites upload releases and stemcells from
+	// this directory instead of downloading them.
+	ArtifactCachePath string `yaml:"artifact_cache_path"`
+	ArtifactLockPath  string `yaml:"artifact_lock_path"`
+
+	// ResourceSlots is the range of slots, written "first-last", that suites
+	// on this host lease inner director IPs, database names and the like
+	// from, within 1-90. Suites sharing ResourceLeasePath never get the same
+	// slot.
+	ResourceSlots     string `yaml:"resource_slots"`
+	ResourceLeasePath string `yaml:"resource_lease_path"`
+
+	// ExternalDBs is keyed by DBaaS name, e.g. rds_mysql or gcp_postgres.
+	ExternalDBs map[string]*ExternalDBSettings `yaml:"external_dbs"`
+}
+
+// ConfigField identifies one configuration value by its key in the config
+// file and the environment variable that overrides it.
+type ConfigField struct {
+	Key   string
+	Env   string
+	value func(*Config) *string
+}
+
+func (f ConfigField) String() string {
+	return fmt.Sprintf("%s (%s)", f.Key, f.Env)
+}
+
+var (
+	ConfigBoshBinaryPath               = ConfigField{"bosh_binary_path", "BOSH_BINARY_PATH", func(c *Config) *string { return &c.BoshBinaryPath }}
+	ConfigBoshEnvironment              = ConfigField{"bosh_environment", "BOSH_ENVIRONMENT", func(c *Config) *string { return &c.BoshEnvironment }}
+	ConfigBoshDeploymentPath           = ConfigField{"bosh_deployment_path", "BOSH_DEPLOYMENT_PATH", func(c *Config) *string { return &c.BoshDeploymentPath }}
+	ConfigBoshDirectorReleasePath      = ConfigField{"bosh_director_release_path", "BOSH_DIRECTOR_RELEASE_PATH", func(c *Config) *string { return &c.BoshDirectorReleasePath }}
+	ConfigBoshRelease                  = ConfigField{"bosh_release", "BOSH_RELEASE", func(c *Config) *string { return &c.BoshRelease }}
+	ConfigStemcellOS                   = ConfigField{"stemcell_os", "STEMCELL_OS", func(c *Config) *string { return &c.StemcellOS }}
+	ConfigCandidateStemcellTarballPath = ConfigField{"candidate_stemcell_tarball_path", "CANDIDATE_STEMCELL_TARBALL_PATH", func(c *Config) *string { return &c.CandidateStemcellTarballPath }}
+	ConfigDNSReleasePath               = ConfigField{"dns_release_path", "DNS_RELEASE_PATH", func(c *Config) *string { return &c.DNSReleasePath }}
+	ConfigBoshDNSAddonOpsFilePath      = ConfigField{"bosh_dns_addon_ops_file_path", "BOSH_DNS_ADDON_OPS_FILE_PATH", func(c *Config) *string { return &c.BoshDNSAddonOpsFilePath }}
+	ConfigBBRBinaryPath                = ConfigField{"bbr_binary_path", "BBR_BINARY_PATH", func(c *Config) *string { return &c.BBRBinaryPath }}
+	ConfigBBRReleasePath               = ConfigField{"bbr_release_path", "BBR_RELEASE_PATH", func(c *Config) *string { return &c.BBRReleasePath }}
+	ConfigInnerDirector                = ConfigField{"inner_director", "INNER_DIRECTOR", func(c *Config) *string { return &c.InnerDirector }}
+	ConfigInnerDirectorScriptsPath     = ConfigField{"inner_director_scripts_path", "INNER_DIRECTOR_SCRIPTS_PATH", func(c *Config) *string { return &c.InnerDirectorScriptsPath }}
+	ConfigBoshSrcPath                  = ConfigField{"bosh_src_path", "BOSH_SRC_PATH", func(c *Config) *string { return &c.BoshSrcPath }}
+	ConfigInnerDirectorRoot            = ConfigField{"inner_director_root", "INNER_DIRECTOR_ROOT", func(c *Config) *string { return &c.InnerDirectorRoot }}
+	ConfigArtifactsPath                = ConfigField{"artifacts_path", "BRATS_ARTIFACTS_PATH", func(c *Config) *string { return &c.ArtifactsPath }}
+	ConfigReportsPath                  = ConfigField{"reports_path", "BRATS_REPORTS_PATH", func(c *Config) *string { return &c.ReportsPath }}
+	ConfigArtifactCachePath            = ConfigField{"artifact_cache_path", "BRATS_ARTIFACT_CACHE_PATH", func(c *Config) *string { return &c.ArtifactCachePath }}
+	ConfigArtifactLockPath             = ConfigField{"artifact_lock_path", "BRATS_ARTIFACT_LOCK_PATH", func(c *Config) *string { return &c.ArtifactLockPath }}
+	ConfigResourceSlots                = ConfigField{"resource_slots", "BRATS_RESOURCE_SLOTS", func(c *Config) *string { return &c.ResourceSlots }}
+	ConfigResourceLeasePath            = ConfigField{"resource_lease_path", "BRATS_RESOURCE_LEASE_PATH", func(c *Config) *string { return &c.ResourceLeasePath }}
+
+	configFields = []ConfigField{
+		ConfigBoshBinaryPath,
+		ConfigBoshEnvironment,
+		ConfigBoshDeploymentPath,
+		ConfigBoshDirectorReleasePath,
+		ConfigBoshRelease,
+		ConfigStemcellOS,
+		ConfigCandidateStemcellTarballPath,
+		ConfigDNSReleasePath,
+		ConfigBoshDNSAddonOpsFilePath,
+		ConfigBBRBinaryPath,
+		ConfigBBRReleasePath,
+		ConfigInnerDirector,
+		ConfigInnerDirectorScriptsPath,
+		ConfigBoshSrcPath,
+		ConfigInnerDirectorRoot,
+		ConfigArtifactsPath,
+		ConfigReportsPath,
+		ConfigArtifactCachePath,
+		ConfigArtifactLockPath,
+		ConfigResourceSlots,
+		ConfigResourceLeasePath,
+	}
+
+	knownDBaaS = []string{"rds_mysql", "rds_postgres", "gcp_mysql", "gcp_postgres"}
+)
+
+// ExternalDBConfigFields lists the values LoadExternalDBConfig needs for the
+// given DBaaS. The CA is optional because it falls back to the asset file.
+func ExternalDBConfigFields(DBaaS string, mutualTLSEnabled bool) []ConfigField {
+	fields := []ConfigField{
+		externalDBField(DBaaS, "host", "HOST", func(s *ExternalDBSettings) *string { return &s.Host }),
+		externalDBField(DBaaS, "user", "USER", func(s *ExternalDBSettings) *string { return &s.User }),
+		externalDBField(DBaaS, "password", "PASSWORD", func(s *ExternalDBSettings) *string { return &s.Password }),
+	}
+
+	if mutualTLSEnabled {
+		fields = append(fields,
+			externalDBField(DBaaS, "client_certificate", "CLIENT_CERTIFICATE", func(s *ExternalDBSettings) *string { return &s.ClientCertificate }),
+			externalDBField(DBaaS, "client_private_key", "CLIENT_PRIVATE_KEY", func(s *ExternalDBSettings) *string { return &s.ClientPrivateKey }),
+		)
+	}
+
+	return fields
+}
+
+func externalDBFields(DBaaS string) []ConfigField {
+	return append(
+		ExternalDBConfigFields(DBaaS, true),
+		externalDBField(DBaaS, "ca", "CA", func(s *ExternalDBSettings) *string { return &s.CA }),
+	)
+}
+
+func externalDBField(DBaaS, key, envSuffix string, value func(*ExternalDBSettings) *string) ConfigField {
+	return ConfigField{
+		Key: fmt.Sprintf("external_dbs.%s.%s", DBaaS, key),
+		Env: fmt.Sprintf("%s_EXTERNAL_DB_%s", strings.ToUpper(DBaaS), envSuffix),
+		value: func(c *Config) *string {
+			return value(c.ExternalDB(DBaaS))
+		},
+	}
+}
+
+// LoadConfig reads the config file at path; an empty path yields an empty
+// config so that everything can come from the environment.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path == "" {
+		return config, nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading config file '%s'", path)
+	}
+
+	if err := yaml.UnmarshalStrict(contents, config); err != nil {
+		return nil, bosherr.WrapErrorf(err, "Parsing config file '%s'", path)
+	}
+
+	return config, nil
+}
+
+// ExternalDB returns the settings for the DBaaS, creating an empty entry if
+// there is none yet.
+func (c *Config) ExternalDB(DBaaS string) *ExternalDBSettings {
+	if c.ExternalDBs == nil {
+		c.ExternalDBs = map[string]*ExternalDBSettings{}
+	}
+	if c.ExternalDBs[DBaaS] == nil {
+		c.ExternalDBs[DBaaS] = &ExternalDBSettings{}
+	}
+	return c.ExternalDBs[DBaaS]
+}
+
+// InnerDirectorPath is the directory of the inner director in the leased
+// slot.
+func (c *Config) InnerDirectorPath(resources Resources) string {
+	if c.InnerDirectorRoot == "" {
+		return resources.DirectorPath()
+	}
+	return filepath.Join(c.InnerDirectorRoot, strconv.Itoa(resources.Slot))
+}
+
+// ApplyEnv overrides values with any environment variables that are set.
+func (c *Config) ApplyEnv(lookupEnv func(string) (string, bool)) {
+	for _, field := range c.allFields() {
+		if val, found := lookupEnv(field.Env); found {
+			*field.value(c) = val
+		}
+	}
+}
+
+// Export sets the environment variable of every configured value that is not
+// already in the environment, so the CLI and helper scripts see the same
+// configuration as the suites.
+func (c *Config) Export() error {
+	for _, field := range c.allFields() {
+		val := *field.value(c)
+		if _, found := os.LookupEnv(field.Env); found || val == "" {
+			continue
+		}
+
+		if err := os.Setenv(field.Env, val); err != nil {
+			return bosherr.WrapErrorf(err, "Exporting %s", field.Env)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) Missing(fields ...ConfigField) []ConfigField {
+	var missing []ConfigField
+	for _, field := range fields {
+		if *field.value(c) == "" {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// Validate reports every missing field at once rather than stopping at the
+// first one.
+func (c *Config) Validate(fields ...ConfigField) error {
+	missing := c.Missing(fields...)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return bosherr.Errorf("Missing required configuration:\n%s", describeFields(missing))
+}
+
+func (c *Config) allFields() []ConfigField {
+	fields := append([]ConfigField{}, configFields...)
+
+	dbaasNames := append([]string{}, knownDBaaS...)
+	for DBaaS := range c.ExternalDBs {
+		if !containsString(dbaasNames, DBaaS) {
+			dbaasNames = append(dbaasNames, DBaaS)
+		}
+	}
+	sort.Strings(dbaasNames)
+
+	for _, DBaaS := range dbaasNames {
+		fields = append(fields, externalDBFields(DBaaS)...)
+	}
+
+	return fields
+}
+
+func describeFields(fields []ConfigField) string {
+	lines := make([]string, len(fields))
+	for i, field := range fields {
+		lines[i] = "  - " + field.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var suiteConfig *Config
+
+// SuiteConfig loads the configuration on first use from the file named by
+// BRATS_CONFIG_PATH, overridden by the environment.
+func SuiteConfig() *Config {
+	if suiteConfig != nil {
+		return suiteConfig
+	}
+
+	config, err := LoadConfig(os.Getenv(ConfigPathEnv))
+	if err != nil {
+		Fail(err.Error())
+	}
+
+	config.ApplyEnv(os.LookupEnv)
+	if config.ResourceSlots != "" {
+		if _, err := ParseResourceRange(config.ResourceSlots); err != nil {
+			Fail(err.Error())
+		}
+	}
+	if err := config.Export(); err != nil {
+		Fail(err.Error())
+	}
+
+	suiteConfig = config
+	return suiteConfig
+}
+
+// RequireConfig fails the current node, listing every missing field.
+func RequireConfig(fields ...ConfigField) {
+	if err := SuiteConfig().Validate(fields...); err != nil {
+		Fail(err.Error())
+	}
+}
+
+// SkipUnlessConfigured skips the current spec when any of the fields it needs
+// is missing.
+func SkipUnlessConfigured(fields ...ConfigField) {
+	missing := SuiteConfig().Missing(fields...)
+	if len(missing) > 0 {
+		Skip(fmt.Sprintf("Skipping because of missing configuration:\n%s", describeFields(missing)))
+	}
+}
@@ -0,0 +1,553 @@
+package bratsutils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const (
+	// ConfigServerAPIPath is what director.config_server.url ends with; the
+	// director appends v1/data to it.
+	ConfigServerAPIPath  = "/api/"
+	ConfigServerDataPath = "/api/v1/data"
+
+	// ConfigServerUAAPath is what director.config_server.uaa.url ends with.
+	ConfigServerUAAPath = "/uaa"
+
+	configServerCredentialNotFound = "The request could not be completed because the credential does not exist or you do not have sufficient authorization."
+)
+
+// Generation modes the director asks for, see config_server/client.rb.
+const (
+	ConfigServerModeNoOverwrite = "no-overwrite"
+	ConfigServerModeOverwrite   = "overwrite"
+	ConfigServerModeConverge    = "converge"
+)
+
+// ConfigServerCredential is a version of a credential, as CredHub's data
+// endpoints return it.
+type ConfigServerCredential struct {
+	ID               string      `json:"id"`
+	Name             string      `json:"name"`
+	Type             string      `json:"type"`
+	Value            interface{} `json:"value"`
+	VersionCreatedAt string      `json:"version_created_at"`
+
+	// Parameters are what the version was generated with, which converge
+	// mode compares against.
+	Parameters map[string]interface{} `json:"-"`
+}
+
+// StringValue returns a key of a credential whose value is a hash, like a
+// certificate's "certificate", or the value itself when it is a string.
+func (c ConfigServerCredential) StringValue(key string) string {
+	if value, ok := c.Value.(string); ok && key == "" {
+		return value
+	}
+	if values, ok := c.Value.(map[string]interface{}); ok {
+		value, _ := values[key].(string)
+		return value
+	}
+	return ""
+}
+
+// ConfigServer stands in for the parts of CredHub the director's config
+// server client calls: getting credentials by name and by ID, and
+// generating password, certificate, ssh and rsa credentials. It serves TLS,
+// and the UAA client credentials grant that guards them, on the same port.
+type ConfigServer struct {
+	// CACert is the certificate the director has to trust for both the
+	// config server and its UAA.
+	CACert string
+
+	clientID     string
+	clientSecret string
+	certificate  tls.Certificate
+	address      string
+
+	mu          sync.Mutex
+	server      *http.Server
+	tokens      map[string]bool
+	credentials map[string][]ConfigServerCredential
+	nextID      int
+}
+
+// NewConfigServer listens on a free port of host, with a certificate valid
+// for advertisedIP, which is where the director reaches this host.
+func NewConfigServer(host, advertisedIP, clientID, clientSecret string) (*ConfigServer, error) {
+	certPEM, keyPEM, err := selfSignedCertificate(advertisedIP)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Loading config server certificate")
+	}
+
+	s := &ConfigServer{
+		CACert:       certPEM,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		certificate:  certificate,
+		address:      net.JoinHostPort(host, "0"),
+		tokens:       map[string]bool{},
+		credentials:  map[string][]ConfigServerCredential{},
+	}
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start listens again after Stop, on the same port.
+func (s *ConfigServer) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Listening on '%s'", s.address)
+	}
+	s.address = listener.Addr().String()
+	s.server = &http.Server{Handler: s}
+
+	go s.server.Serve(tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{s.certificate}}))
+	return nil
+}
+
+// Stop closes the port and every connection, so that the director finds the
+// config server unreachable until Start.
+func (s *ConfigServer) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server == nil {
+		return nil
+	}
+
+	err := s.server.Close()
+	s.server = nil
+	return err
+}
+
+func (s *ConfigServer) Close() error {
+	return s.Stop()
+}
+
+func (s *ConfigServer) Port() int {
+	_, port, _ := net.SplitHostPort(s.address)
+	number, _ := strconv.Atoi(port)
+	return number
+}
+
+// URL returns director.config_server.url for a director that reaches this
+// host through host.
+func (s *ConfigServer) URL(host string) string {
+	return fmt.Sprintf("https://%s%s", net.JoinHostPort(host, fmt.Sprint(s.Port())), ConfigServerAPIPath)
+}
+
+// UAAURL returns director.config_server.uaa.url for a director that reaches
+// this host through host.
+func (s *ConfigServer) UAAURL(host string) string {
+	return fmt.Sprintf("https://%s%s", net.JoinHostPort(host, fmt.Sprint(s.Port())), ConfigServerUAAPath)
+}
+
+// Current returns the latest version of a credential.
+func (s *ConfigServer) Current(name string) (ConfigServerCredential, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := s.credentials[name]
+	if len(versions) == 0 {
+		return ConfigServerCredential{}, false
+	}
+	return versions[len(versions)-1], true
+}
+
+// Versions returns every version of a credential, oldest first.
+func (s *ConfigServer) Versions(name string) []ConfigServerCredential {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ConfigServerCredential{}, s.credentials[name]...)
+}
+
+// Regenerate adds a version of a credential generated with the same
+// parameters as the current one, like `credhub regenerate` does.
+func (s *ConfigServer) Regenerate(name string) (ConfigServerCredential, error) {
+	current, found := s.Current(name)
+	if !found {
+		return ConfigServerCredential{}, bosherr.Errorf("Credential '%s' does not exist", name)
+	}
+	return s.generate(name, current.Type, current.Parameters, ConfigServerModeOverwrite)
+}
+
+// Reset forgets every credential.
+func (s *ConfigServer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credentials = map[string][]ConfigServerCredential{}
+}
+
+func (s *ConfigServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.URL.Path == ConfigServerUAAPath+"/oauth/token" && req.Method == "POST":
+		s.issueToken(w, req)
+		return
+	case !s.authorized(req):
+		writeReceiverJSON(w, http.StatusUnauthorized, map[string]string{
+			"error":             "invalid_token",
+			"error_description": "Full authentication is required to access this resource",
+		})
+		return
+	}
+
+	switch {
+	case req.URL.Path == ConfigServerDataPath && req.Method == "GET":
+		credential, found := s.Current(req.URL.Query().Get("name"))
+		if !found {
+			writeReceiverJSON(w, http.StatusNotFound, map[string]string{"error": configServerCredentialNotFound})
+			return
+		}
+		writeReceiverJSON(w, http.StatusOK, map[string]interface{}{"data": []ConfigServerCredential{credential}})
+
+	case strings.HasPrefix(req.URL.Path, ConfigServerDataPath+"/") && req.Method == "GET":
+		credential, found := s.byID(strings.TrimPrefix(req.URL.Path, ConfigServerDataPath+"/"))
+		if !found {
+			writeReceiverJSON(w, http.StatusNotFound, map[string]string{"error": configServerCredentialNotFound})
+			return
+		}
+		writeReceiverJSON(w, http.StatusOK, credential)
+
+	case req.URL.Path == ConfigServerDataPath && req.Method == "POST":
+		var request struct {
+			Name       string                 `json:"name"`
+			Type       string                 `json:"type"`
+			Parameters map[string]interface{} `json:"parameters"`
+			Mode       string                 `json:"mode"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			writeReceiverJSON(w, http.StatusBadRequest, map[string]string{"error": "The request could not be fulfilled because the request path or body did not meet expectation."})
+			return
+		}
+		if !strings.HasPrefix(request.Name, "/") {
+			writeReceiverJSON(w, http.StatusBadRequest, map[string]string{"error": "A credential name must be absolute."})
+			return
+		}
+
+		credential, err := s.generate(request.Name, request.Type, request.Parameters, request.Mode)
+		if err != nil {
+			writeReceiverJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeReceiverJSON(w, http.StatusOK, credential)
+
+	default:
+		writeReceiverJSON(w, http.StatusNotFound, map[string]string{"error": "The request could not be fulfilled because the resource could not be found."})
+	}
+}
+
+// issueToken answers the client credentials grant with an unsigned JWT,
+// which is all the director decodes.
+func (s *ConfigServer) issueToken(w http.ResponseWriter, req *http.Request) {
+	clientID, clientSecret, ok := req.BasicAuth()
+	if !ok {
+		clientID, clientSecret = req.FormValue("client_id"), req.FormValue("client_secret")
+	}
+	if clientID != s.clientID || clientSecret != s.clientSecret || req.FormValue("grant_type") != "client_credentials" {
+		writeReceiverJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized", "error_description": "Bad credentials"})
+		return
+	}
+
+	now := time.Now()
+	claims, _ := json.Marshal(map[string]interface{}{
+		"jti":        randomAlphanumeric(32),
+		"client_id":  clientID,
+		"cid":        clientID,
+		"sub":        clientID,
+		"grant_type": "client_credentials",
+		"scope":      []string{"credhub.read", "credhub.write"},
+		"aud":        []string{"credhub"},
+		"iss":        s.UAAURL("127.0.0.1") + "/oauth/token",
+		"iat":        now.Unix(),
+		"exp":        now.Add(time.Hour).Unix(),
+	})
+	encode := base64.RawURLEncoding.EncodeToString
+	token := encode([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + encode(claims) + "." + encode([]byte("unsigned"))
+
+	s.mu.Lock()
+	s.tokens[token] = true
+	s.mu.Unlock()
+
+	writeReceiverJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   3600,
+		"scope":        "credhub.read credhub.write",
+		"jti":          randomAlphanumeric(32),
+	})
+}
+
+func (s *ConfigServer) authorized(req *http.Request) bool {
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[parts[1]]
+}
+
+func (s *ConfigServer) byID(id string) (ConfigServerCredential, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, versions := range s.credentials {
+		for _, version := range versions {
+			if version.ID == id {
+				return version, true
+			}
+		}
+	}
+	return ConfigServerCredential{}, false
+}
+
+func (s *ConfigServer) generate(name, credentialType string, parameters map[string]interface{}, mode string) (ConfigServerCredential, error) {
+	if parameters == nil {
+		parameters = map[string]interface{}{}
+	}
+
+	current, found := s.Current(name)
+	if found {
+		if current.Type != credentialType {
+			return ConfigServerCredential{}, bosherr.Errorf("The credential type cannot be modified. Please delete the credential if you wish to create it with a different type.")
+		}
+		if mode == ConfigServerModeNoOverwrite || mode == "" ||
+			(mode == ConfigServerModeConverge && reflect.DeepEqual(current.Parameters, parameters)) {
+			return current, nil
+		}
+	}
+
+	value, err := s.generateValue(credentialType, parameters)
+	if err != nil {
+		return ConfigServerCredential{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	credential := ConfigServerCredential{
+		ID:               fmt.Sprintf("%08d-0000-4000-8000-%012d", s.nextID, s.nextID),
+		Name:             name,
+		Type:             credentialType,
+		Value:            value,
+		VersionCreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Parameters:       parameters,
+	}
+	s.credentials[name] = append(s.credentials[name], credential)
+	return credential, nil
+}
+
+func (s *ConfigServer) generateValue(credentialType string, parameters map[string]interface{}) (interface{}, error) {
+	switch credentialType {
+	case "password":
+		length := 30
+		if l, ok := parameters["length"].(float64); ok {
+			length = int(l)
+		}
+		return randomAlphanumeric(length), nil
+
+	case "certificate":
+		return s.generateCertificate(parameters)
+
+	case "ssh":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Generating ssh key")
+		}
+		publicKey := sshPublicKey(&key.PublicKey)
+		fingerprint := sha256.Sum256(publicKey)
+		return map[string]interface{}{
+			"private_key":            rsaPrivateKeyPEM(key),
+			"public_key":             "ssh-rsa " + base64.StdEncoding.EncodeToString(publicKey),
+			"public_key_fingerprint": base64.RawStdEncoding.EncodeToString(fingerprint[:]),
+		}, nil
+
+	case "rsa":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Generating rsa key")
+		}
+		publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Marshaling rsa public key")
+		}
+		return map[string]interface{}{
+			"private_key": rsaPrivateKeyPEM(key),
+			"public_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		}, nil
+
+	default:
+		return nil, bosherr.Errorf("The request does not include a valid type. Valid values for generate include 'password', 'certificate', 'ssh' and 'rsa'.")
+	}
+}
+
+func (s *ConfigServer) generateCertificate(parameters map[string]interface{}) (interface{}, error) {
+	isCA, _ := parameters["is_ca"].(bool)
+	caName, _ := parameters["ca"].(string)
+	selfSign, _ := parameters["self_sign"].(bool)
+	if caName == "" && !isCA && !selfSign {
+		return nil, bosherr.Errorf("The request does not include a valid ca, is_ca or self_sign parameter.")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating certificate key")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating certificate serial number")
+	}
+
+	commonName, _ := parameters["common_name"].(string)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	if names, ok := parameters["alternative_names"].([]interface{}); ok {
+		for _, name := range names {
+			if ip := net.ParseIP(fmt.Sprint(name)); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, fmt.Sprint(name))
+			}
+		}
+	}
+	if usages, ok := parameters["extended_key_usage"].([]interface{}); ok {
+		for _, usage := range usages {
+			switch usage {
+			case "server_auth":
+				template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+			case "client_auth":
+				template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+			}
+		}
+	}
+
+	parent, signer := template, key
+	if caName != "" {
+		ca, found := s.Current(caName)
+		if !found || ca.Type != "certificate" {
+			return nil, bosherr.Errorf("The request could not be completed because the CA '%s' does not exist.", caName)
+		}
+		parent, signer, err = parseCertificateAndKey(ca.StringValue("certificate"), ca.StringValue("private_key"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Creating certificate")
+	}
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	caPEM := certPEM
+	if caName != "" {
+		caPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: parent.Raw}))
+	}
+
+	return map[string]interface{}{
+		"ca":          caPEM,
+		"certificate": certPEM,
+		"private_key": rsaPrivateKeyPEM(key),
+	}, nil
+}
+
+func parseCertificateAndKey(certPEM, keyPEM string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, bosherr.Error("Decoding CA certificate and key")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Parsing CA certificate")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Parsing CA key")
+	}
+	return cert, key, nil
+}
+
+func rsaPrivateKeyPEM(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+// sshPublicKey encodes a key in the SSH wire format, as in RFC 4253.
+func sshPublicKey(key *rsa.PublicKey) []byte {
+	var encoded []byte
+	writeString := func(b []byte) {
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(b)))
+		encoded = append(append(encoded, length...), b...)
+	}
+	writeMPInt := func(n *big.Int) {
+		b := n.Bytes()
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		writeString(b)
+	}
+
+	writeString([]byte("ssh-rsa"))
+	writeMPInt(big.NewInt(int64(key.E)))
+	writeMPInt(key.N)
+	return encoded
+}
+
+const alphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func randomAlphanumeric(length int) string {
+	random := make([]byte, length)
+	rand.Read(random)
+	for i := range random {
+		random[i] = alphanumeric[int(random[i])%len(alphanumeric)]
+	}
+	return string(random)
+}
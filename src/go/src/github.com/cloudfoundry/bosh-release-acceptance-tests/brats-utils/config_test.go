@@ -0,0 +1,135 @@
+package bratsutils_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	var configPath string
+
+	writeConfig := func(contents string) {
+		configFile, err := ioutil.TempFile("", "brats-config")
+		Expect(err).ToNot(HaveOccurred())
+		defer configFile.Close()
+
+		_, err = configFile.WriteString(contents)
+		Expect(err).ToNot(HaveOccurred())
+		configPath = configFile.Name()
+	}
+
+	lookupIn := func(env map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			val, found := env[name]
+			return val, found
+		}
+	}
+
+	AfterEach(func() {
+		if configPath != "" {
+			os.Remove(configPath)
+		}
+	})
+
+	Describe("LoadConfig", func() {
+		It("reads the config file", func() {
+			writeConfig(`
+bosh_binary_path: /usr/local/bin/bosh
+stemcell_os: ubuntu-xenial
+external_dbs:
+  rds_mysql:
+    host: mysql.example.com
+    user: admin
+`)
+
+			config, err := bratsutils.LoadConfig(configPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(config.BoshBinaryPath).To(Equal("/usr/local/bin/bosh"))
+			Expect(config.StemcellOS).To(Equal("ubuntu-xenial"))
+			Expect(config.ExternalDB("rds_mysql").Host).To(Equal("mysql.example.com"))
+		})
+
+		It("returns an empty config without a path", func() {
+			config, err := bratsutils.LoadConfig("")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*config).To(Equal(bratsutils.Config{}))
+		})
+
+		It("rejects unknown keys", func() {
+			writeConfig("bosh_binary_pth: /usr/local/bin/bosh\n")
+
+			_, err := bratsutils.LoadConfig(configPath)
+			Expect(err).To(MatchError(ContainSubstring("bosh_binary_pth")))
+		})
+	})
+
+	Describe("ApplyEnv", func() {
+		It("prefers environment variables over the file", func() {
+			writeConfig(`
+bosh_binary_path: /usr/local/bin/bosh
+dns_release_path: /tmp/dns.tgz
+external_dbs:
+  gcp_postgres:
+    host: postgres.example.com
+`)
+			config, err := bratsutils.LoadConfig(configPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			config.ApplyEnv(lookupIn(map[string]string{
+				"BOSH_BINARY_PATH":                  "/opt/bosh",
+				"GCP_POSTGRES_EXTERNAL_DB_PASSWORD": "secret",
+				"RDS_MYSQL_EXTERNAL_DB_CA":          "a-ca",
+			}))
+
+			Expect(config.BoshBinaryPath).To(Equal("/opt/bosh"))
+			Expect(config.DNSReleasePath).To(Equal("/tmp/dns.tgz"))
+			Expect(config.ExternalDB("gcp_postgres").Host).To(Equal("postgres.example.com"))
+			Expect(config.ExternalDB("gcp_postgres").Password).To(Equal("secret"))
+			Expect(config.ExternalDB("rds_mysql").CA).To(Equal("a-ca"))
+		})
+	})
+
+	Describe("Validate", func() {
+		It("reports every missing field at once", func() {
+			config := &bratsutils.Config{StemcellOS: "ubuntu-xenial"}
+
+			err := config.Validate(
+				bratsutils.ConfigBoshBinaryPath,
+				bratsutils.ConfigStemcellOS,
+				bratsutils.ConfigDNSReleasePath,
+			)
+			Expect(err).To(MatchError(ContainSubstring("bosh_binary_path (BOSH_BINARY_PATH)")))
+			Expect(err).To(MatchError(ContainSubstring("dns_release_path (DNS_RELEASE_PATH)")))
+			Expect(err).ToNot(MatchError(ContainSubstring("STEMCELL_OS")))
+		})
+
+		It("covers the external database fields for mutual TLS", func() {
+			config := &bratsutils.Config{}
+			config.ExternalDB("gcp_mysql").Host = "mysql.example.com"
+
+			missing := config.Missing(bratsutils.ExternalDBConfigFields("gcp_mysql", true)...)
+
+			var envNames []string
+			for _, field := range missing {
+				envNames = append(envNames, field.Env)
+			}
+			Expect(envNames).To(ConsistOf(
+				"GCP_MYSQL_EXTERNAL_DB_USER",
+				"GCP_MYSQL_EXTERNAL_DB_PASSWORD",
+				"GCP_MYSQL_EXTERNAL_DB_CLIENT_CERTIFICATE",
+				"GCP_MYSQL_EXTERNAL_DB_CLIENT_PRIVATE_KEY",
+			))
+		})
+
+		It("succeeds when everything is configured", func() {
+			config := &bratsutils.Config{BoshBinaryPath: "/usr/local/bin/bosh"}
+			Expect(config.Validate(bratsutils.ConfigBoshBinaryPath)).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,203 @@
+package bratsutils
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	ConsulEventFirePath       = "/v1/event/fire/"
+	ConsulCheckRegisterPath   = "/v1/agent/check/register"
+	ConsulCheckDeregisterPath = "/v1/agent/check/deregister/"
+)
+
+// consulCheckUpdatePaths maps the TTL endpoints of the Consul agent API to
+// the status they set.
+var consulCheckUpdatePaths = map[string]string{
+	"/v1/agent/check/pass/": "passing",
+	"/v1/agent/check/warn/": "warning",
+	"/v1/agent/check/fail/": "critical",
+}
+
+// ConsulEvent is a user event fired through the agent API. The health
+// monitor sends JSON payloads.
+type ConsulEvent struct {
+	Name    string
+	Payload []byte
+	Query   url.Values
+}
+
+// ConsulCheck is a TTL check as registered through the agent API, along
+// with its current status. Like in Consul, a new check is critical until
+// its TTL is first updated.
+type ConsulCheck struct {
+	ID     string
+	Name   string
+	Notes  string
+	TTL    string
+	Status string
+	Output string
+}
+
+// ConsulReceiver stands in for the subset of the Consul agent HTTP API the
+// health monitor uses: firing events, and registering and updating TTL
+// checks.
+type ConsulReceiver struct {
+	*httpReceiver
+
+	mu     sync.Mutex
+	checks map[string]ConsulCheck
+}
+
+func NewConsulReceiver(host string) (*ConsulReceiver, error) {
+	r := &ConsulReceiver{checks: map[string]ConsulCheck{}}
+
+	receiver, err := newHTTPReceiver(host, r.respond)
+	if err != nil {
+		return nil, err
+	}
+	r.httpReceiver = receiver
+	return r, nil
+}
+
+func (r *ConsulReceiver) respond(w http.ResponseWriter, request ReceivedRequest) {
+	if request.Method != "PUT" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(request.Path, ConsulEventFirePath):
+		writeReceiverJSON(w, http.StatusOK, map[string]interface{}{
+			"ID":      consulEventID(),
+			"Name":    strings.TrimPrefix(request.Path, ConsulEventFirePath),
+			"Payload": request.Body,
+			"Version": 1,
+		})
+
+	case request.Path == ConsulCheckRegisterPath:
+		var registration struct {
+			ID    string
+			Name  string
+			Notes string
+			TTL   string
+		}
+		if err := json.Unmarshal(request.Body, &registration); err != nil {
+			http.Error(w, fmt.Sprintf("Request decode failed: %s", err), http.StatusBadRequest)
+			return
+		}
+		if registration.Name == "" {
+			http.Error(w, "Missing check name", http.StatusBadRequest)
+			return
+		}
+		if registration.ID == "" {
+			registration.ID = registration.Name
+		}
+
+		r.mu.Lock()
+		r.checks[registration.ID] = ConsulCheck{
+			ID:     registration.ID,
+			Name:   registration.Name,
+			Notes:  registration.Notes,
+			TTL:    registration.TTL,
+			Status: "critical",
+		}
+		r.mu.Unlock()
+
+	case strings.HasPrefix(request.Path, ConsulCheckDeregisterPath):
+		r.mu.Lock()
+		delete(r.checks, strings.TrimPrefix(request.Path, ConsulCheckDeregisterPath))
+		r.mu.Unlock()
+
+	default:
+		for prefix, status := range consulCheckUpdatePaths {
+			if !strings.HasPrefix(request.Path, prefix) {
+				continue
+			}
+
+			id := strings.TrimPrefix(request.Path, prefix)
+
+			r.mu.Lock()
+			check, found := r.checks[id]
+			if found {
+				check.Status = status
+				check.Output = request.Query.Get("note")
+				r.checks[id] = check
+			}
+			r.mu.Unlock()
+
+			if !found {
+				http.Error(w, fmt.Sprintf("CheckID %q does not have associated TTL", id), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		http.NotFound(w, nil)
+	}
+}
+
+// Events returns the events fired so far.
+func (r *ConsulReceiver) Events() []ConsulEvent {
+	var events []ConsulEvent
+	for _, request := range r.Requests() {
+		if request.Method != "PUT" || !strings.HasPrefix(request.Path, ConsulEventFirePath) {
+			continue
+		}
+		events = append(events, ConsulEvent{
+			Name:    strings.TrimPrefix(request.Path, ConsulEventFirePath),
+			Payload: request.Body,
+			Query:   request.Query,
+		})
+	}
+	return events
+}
+
+// Checks returns the checks registered, sorted by their ID. Unlike the
+// requests, they survive Reset: the health monitor registers each check only
+// once for as long as it runs.
+func (r *ConsulReceiver) Checks() []ConsulCheck {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var checks []ConsulCheck
+	for _, check := range r.checks {
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].ID < checks[j].ID })
+	return checks
+}
+
+type ConsulCheckUpdate struct {
+	CheckID string
+	Status  string
+}
+
+// CheckUpdates returns the IDs of the checks whose TTL was updated so far,
+// in order, with the status each update set.
+func (r *ConsulReceiver) CheckUpdates() []ConsulCheckUpdate {
+	var updates []ConsulCheckUpdate
+	for _, request := range r.Requests() {
+		if request.Method != "PUT" {
+			continue
+		}
+		for prefix, status := range consulCheckUpdatePaths {
+			if strings.HasPrefix(request.Path, prefix) {
+				updates = append(updates, ConsulCheckUpdate{CheckID: strings.TrimPrefix(request.Path, prefix), Status: status})
+			}
+		}
+	}
+	return updates
+}
+
+// consulEventID returns a random UUID, like the IDs Consul gives events.
+func consulEventID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
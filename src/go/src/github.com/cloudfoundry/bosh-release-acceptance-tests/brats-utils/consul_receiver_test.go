@@ -0,0 +1,83 @@
+package bratsutils_test
+
+import (
+	"net/http"
+	"strings"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConsulReceiver", func() {
+	var receiver *bratsutils.ConsulReceiver
+
+	put := func(path, body string) int {
+		request, err := http.NewRequest("PUT", receiver.URL("127.0.0.1")+path, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+
+		response, err := http.DefaultClient.Do(request)
+		Expect(err).ToNot(HaveOccurred())
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	BeforeEach(func() {
+		var err error
+		receiver, err = bratsutils.NewConsulReceiver("127.0.0.1")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		receiver.Close()
+	})
+
+	It("records fired events with their query", func() {
+		Expect(put("/v1/event/fire/brats-does_not_exist?token=acl", `{"kind":"alert"}`)).To(Equal(http.StatusOK))
+
+		events := receiver.Events()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Name).To(Equal("brats-does_not_exist"))
+		Expect(string(events[0].Payload)).To(Equal(`{"kind":"alert"}`))
+		Expect(events[0].Query.Get("token")).To(Equal("acl"))
+	})
+
+	It("registers TTL checks, which start out critical", func() {
+		Expect(put("/v1/agent/check/register", `{"name":"brats-syslog_storer_abc","notes":"Registered by BRATS","ttl":"120s"}`)).To(Equal(http.StatusOK))
+
+		Expect(receiver.Checks()).To(Equal([]bratsutils.ConsulCheck{{
+			ID:     "brats-syslog_storer_abc",
+			Name:   "brats-syslog_storer_abc",
+			Notes:  "Registered by BRATS",
+			TTL:    "120s",
+			Status: "critical",
+		}}))
+	})
+
+	It("updates registered checks and keeps them across resets", func() {
+		put("/v1/agent/check/register", `{"name":"brats-syslog_storer_abc","ttl":"120s"}`)
+		receiver.Reset()
+
+		Expect(put("/v1/agent/check/pass/brats-syslog_storer_abc?note=running", "{}")).To(Equal(http.StatusOK))
+		Expect(receiver.Checks()[0].Status).To(Equal("passing"))
+		Expect(receiver.Checks()[0].Output).To(Equal("running"))
+
+		Expect(put("/v1/agent/check/fail/brats-syslog_storer_abc", "{}")).To(Equal(http.StatusOK))
+		Expect(receiver.Checks()[0].Status).To(Equal("critical"))
+
+		Expect(receiver.CheckUpdates()).To(Equal([]bratsutils.ConsulCheckUpdate{
+			{CheckID: "brats-syslog_storer_abc", Status: "passing"},
+			{CheckID: "brats-syslog_storer_abc", Status: "critical"},
+		}))
+
+		Expect(put("/v1/agent/check/deregister/brats-syslog_storer_abc", "")).To(Equal(http.StatusOK))
+		Expect(receiver.Checks()).To(BeEmpty())
+	})
+
+	It("rejects updates to checks that were never registered, like Consul", func() {
+		Expect(put("/v1/agent/check/warn/unknown", "{}")).To(Equal(http.StatusInternalServerError))
+		Expect(put("/v1/agent/check/register", `{"ttl":"120s"}`)).To(Equal(http.StatusBadRequest))
+		Expect(put("/v1/kv/key", "value")).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,30 @@
+package bratsutils
+
+import (
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+
+	. "github.com/onsi/gomega"
+)
+
+// Director returns an API client for the inner director, authenticated as
+// the admin user.
+func Director() *director.Client {
+	client, err := newDirectorClient()
+	Expect(err).ToNot(HaveOccurred())
+
+	return client
+}
+
+func newDirectorClient() (*director.Client, error) {
+	creds, err := innerDirector.Credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	return director.NewClient(director.ClientConfig{
+		URL:          creds.URL,
+		CACert:       creds.CACert,
+		Client:       creds.Client,
+		ClientSecret: creds.ClientSecret,
+	})
+}
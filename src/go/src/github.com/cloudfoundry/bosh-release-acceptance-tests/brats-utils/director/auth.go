@@ -0,0 +1,104 @@
+package director
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+type authenticator interface {
+	Authorize(req *http.Request) error
+}
+
+type basicAuthenticator struct {
+	username string
+	password string
+}
+
+func (a basicAuthenticator) Authorize(req *http.Request) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+// uaaAuthenticator obtains client credentials tokens from the director's UAA
+// and refreshes them shortly before they expire.
+type uaaAuthenticator struct {
+	tokenURL     string
+	client       string
+	clientSecret string
+	httpClient   *http.Client
+
+	lock      sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+type uaaTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func newUAAAuthenticator(uaaURL string, config ClientConfig, httpClient *http.Client) *uaaAuthenticator {
+	return &uaaAuthenticator{
+		tokenURL:     strings.TrimSuffix(uaaURL, "/") + "/oauth/token",
+		client:       config.Client,
+		clientSecret: config.ClientSecret,
+		httpClient:   httpClient,
+	}
+}
+
+func (a *uaaAuthenticator) Authorize(req *http.Request) error {
+	token, err := a.accessToken()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a *uaaAuthenticator) accessToken() (string, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.token != "" && time.Now().Before(a.expiresAt) {
+		return a.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+
+	req, err := http.NewRequest("POST", a.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", bosherr.WrapError(err, "Building UAA token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(a.client, a.clientSecret)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return "", bosherr.WrapError(err, "Requesting UAA token")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", bosherr.Errorf("UAA responded with status %d when requesting token", resp.StatusCode)
+	}
+
+	var tokenResp uaaTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", bosherr.WrapError(err, "Unmarshaling UAA token response")
+	}
+
+	a.token = tokenResp.AccessToken
+	// Refresh a little early so long-running requests do not race expiry.
+	a.expiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn)*time.Second - 30*time.Second)
+
+	return a.token, nil
+}
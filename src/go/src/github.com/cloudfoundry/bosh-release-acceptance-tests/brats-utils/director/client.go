@@ -0,0 +1,236 @@
+package director
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// ClientConfig describes how to reach and authenticate against a director.
+// Client and ClientSecret are used as basic auth credentials when the
+// director runs with local users, and as UAA client credentials otherwise.
+type ClientConfig struct {
+	URL          string
+	CACert       string
+	Client       string
+	ClientSecret string
+}
+
+type Client struct {
+	config     ClientConfig
+	httpClient *http.Client
+
+	authLock sync.Mutex
+	auth     authenticator
+}
+
+// Error is returned when the director answers with an unexpected status code.
+type Error struct {
+	StatusCode  int    `json:"-"`
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+}
+
+func (e Error) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("Director responded with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("Director responded with status %d: %s (code %d)", e.StatusCode, e.Description, e.Code)
+}
+
+func NewClient(config ClientConfig) (*Client, error) {
+	if config.URL == "" {
+		return nil, bosherr.Error("Expected director URL to be non-empty")
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.CACert != "" {
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM([]byte(config.CACert)) {
+			return nil, bosherr.Error("Parsing director CA certificate")
+		}
+		tlsConfig.RootCAs = certPool
+	}
+
+	httpClient := &http.Client{
+		Timeout: 5 * time.Minute,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: 30 * time.Second,
+		},
+		// Task-creating endpoints redirect to /tasks/:id; we only want the id.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &Client{
+		config:     config,
+		httpClient: httpClient,
+	}, nil
+}
+
+func (c *Client) URL() string { return c.config.URL }
+
+func (c *Client) getJSON(path string, query url.Values, result interface{}) error {
+	resp, err := c.do("GET", path, query, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return err
+	}
+
+	return decodeJSON(resp.Body, result)
+}
+
+func (c *Client) sendJSON(method, path string, query url.Values, body interface{}, result interface{}, expectedStatus ...int) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Marshaling request body for '%s %s'", method, path)
+	}
+
+	resp, err := c.do(method, path, query, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, expectedStatus...); err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return decodeJSON(resp.Body, result)
+}
+
+// startTask performs a request that the director answers with a redirect to
+// the task it queued and returns that task's id.
+func (c *Client) startTask(method, path string, query url.Values, contentType string, body io.Reader) (int, error) {
+	resp, err := c.do(method, path, query, contentType, body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := expectStatus(resp, http.StatusFound, http.StatusSeeOther); err != nil {
+		return 0, err
+	}
+
+	location := resp.Header.Get("Location")
+	taskID, err := strconv.Atoi(location[strings.LastIndex(location, "/")+1:])
+	if err != nil {
+		return 0, bosherr.WrapErrorf(err, "Parsing task id from redirect location '%s'", location)
+	}
+
+	return taskID, nil
+}
+
+func (c *Client) startJSONTask(method, path string, query url.Values, body interface{}) (int, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, bosherr.WrapErrorf(err, "Marshaling request body for '%s %s'", method, path)
+	}
+
+	return c.startTask(method, path, query, "application/json", bytes.NewReader(payload))
+}
+
+func (c *Client) do(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	endpoint := strings.TrimSuffix(c.config.URL, "/") + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Building request '%s %s'", method, path)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if path != "/info" {
+		auth, err := c.authenticator()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := auth.Authorize(req); err != nil {
+			return nil, bosherr.WrapError(err, "Authorizing director request")
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Performing request '%s %s'", method, path)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) authenticator() (authenticator, error) {
+	c.authLock.Lock()
+	defer c.authLock.Unlock()
+
+	if c.auth != nil {
+		return c.auth, nil
+	}
+
+	info, err := c.Info()
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Determining director authentication type")
+	}
+
+	switch info.UserAuthentication.Type {
+	case "uaa":
+		c.auth = newUAAAuthenticator(info.UserAuthentication.Options.URL, c.config, c.httpClient)
+	case "basic":
+		c.auth = basicAuthenticator{username: c.config.Client, password: c.config.ClientSecret}
+	default:
+		return nil, bosherr.Errorf("Unsupported director authentication type '%s'", info.UserAuthentication.Type)
+	}
+
+	return c.auth, nil
+}
+
+func expectStatus(resp *http.Response, expected ...int) error {
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+
+	directorErr := Error{StatusCode: resp.StatusCode}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &directorErr); err != nil {
+		directorErr.Description = strings.TrimSpace(string(body))
+	}
+
+	return directorErr
+}
+
+func decodeJSON(body io.Reader, result interface{}) error {
+	if err := json.NewDecoder(body).Decode(result); err != nil {
+		return bosherr.WrapError(err, "Unmarshaling director response")
+	}
+	return nil
+}
@@ -0,0 +1,595 @@
+package director_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type recordedRequest struct {
+	Method        string
+	Path          string
+	Query         string
+	ContentType   string
+	Authorization string
+	Body          string
+}
+
+type fakeDirector struct {
+	server   *httptest.Server
+	mux      *http.ServeMux
+	requests []recordedRequest
+	authType string
+}
+
+func newFakeDirector(authType string) *fakeDirector {
+	fake := &fakeDirector{mux: http.NewServeMux(), authType: authType}
+	fake.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		fake.requests = append(fake.requests, recordedRequest{
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Query:         r.URL.RawQuery,
+			ContentType:   r.Header.Get("Content-Type"),
+			Authorization: r.Header.Get("Authorization"),
+			Body:          string(body),
+		})
+		fake.mux.ServeHTTP(w, r)
+	}))
+
+	fake.mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"name":    "bosh-1",
+			"uuid":    "director-uuid",
+			"version": "0.0.0 (00000000)",
+			"cpi":     "docker_cpi",
+			"user_authentication": map[string]interface{}{
+				"type":    fake.authType,
+				"options": map[string]interface{}{"url": fake.server.URL + "/uaa"},
+			},
+			"features": map[string]interface{}{
+				"local_dns": map[string]interface{}{"status": true},
+			},
+		})
+	})
+
+	fake.mux.HandleFunc("/uaa/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		client, secret, ok := r.BasicAuth()
+		if !ok || client != "admin" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"access_token": "uaa-token",
+			"token_type":   "bearer",
+			"expires_in":   3600,
+		})
+	})
+
+	return fake
+}
+
+func (f *fakeDirector) client() *director.Client {
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.server.Certificate().Raw})
+
+	client, err := director.NewClient(director.ClientConfig{
+		URL:          f.server.URL,
+		CACert:       string(caCert),
+		Client:       "admin",
+		ClientSecret: "secret",
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	return client
+}
+
+func (f *fakeDirector) lastRequest() recordedRequest {
+	Expect(f.requests).ToNot(BeEmpty())
+	return f.requests[len(f.requests)-1]
+}
+
+func (f *fakeDirector) redirectToTask(path string, taskID int) {
+	f.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, fmt.Sprintf("/tasks/%d", taskID), http.StatusFound)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	Expect(json.NewEncoder(w).Encode(body)).To(Succeed())
+}
+
+var _ = Describe("Client", func() {
+	var (
+		fake   *fakeDirector
+		client *director.Client
+	)
+
+	BeforeEach(func() {
+		fake = newFakeDirector("basic")
+	})
+
+	JustBeforeEach(func() {
+		client = fake.client()
+	})
+
+	AfterEach(func() {
+		fake.server.Close()
+	})
+
+	Describe("NewClient", func() {
+		It("requires a URL", func() {
+			_, err := director.NewClient(director.ClientConfig{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects an unparseable CA certificate", func() {
+			_, err := director.NewClient(director.ClientConfig{URL: "https://127.0.0.1:25555", CACert: "not a cert"})
+			Expect(err).To(MatchError(ContainSubstring("CA certificate")))
+		})
+	})
+
+	Describe("Info", func() {
+		It("returns the typed director info without authenticating", func() {
+			info, err := client.Info()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(info.Name).To(Equal("bosh-1"))
+			Expect(info.CPI).To(Equal("docker_cpi"))
+			Expect(info.UserAuthentication.Type).To(Equal("basic"))
+			Expect(info.Features["local_dns"].Status).To(BeTrue())
+			Expect(fake.lastRequest().Authorization).To(BeEmpty())
+		})
+	})
+
+	Describe("authentication", func() {
+		BeforeEach(func() {
+			fake.mux.HandleFunc("/deployments", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, []interface{}{})
+			})
+		})
+
+		Context("when the director uses local users", func() {
+			It("sends basic auth credentials", func() {
+				_, err := client.Deployments()
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(fake.lastRequest().Authorization).To(HavePrefix("Basic "))
+			})
+		})
+
+		Context("when the director uses UAA", func() {
+			BeforeEach(func() {
+				fake.authType = "uaa"
+			})
+
+			It("fetches a client credentials token once and reuses it", func() {
+				_, err := client.Deployments()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = client.Deployments()
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(fake.lastRequest().Authorization).To(Equal("Bearer uaa-token"))
+
+				tokenRequests := 0
+				for _, req := range fake.requests {
+					if req.Path == "/uaa/oauth/token" {
+						tokenRequests++
+					}
+				}
+				Expect(tokenRequests).To(Equal(1))
+			})
+		})
+
+		Context("when the director uses an unknown authentication type", func() {
+			BeforeEach(func() {
+				fake.authType = "kerberos"
+			})
+
+			It("returns an error", func() {
+				_, err := client.Deployments()
+				Expect(err).To(MatchError(ContainSubstring("kerberos")))
+			})
+		})
+	})
+
+	Describe("Instances", func() {
+		BeforeEach(func() {
+			fake.mux.HandleFunc("/deployments/dns/instances", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, []map[string]interface{}{
+					{"job": "provider", "index": 0, "id": "abc", "az": "z1", "ips": []string{"10.0.0.2"}, "expects_vm": true},
+					{"job": "provider", "index": 1, "id": "def", "az": "z2", "ips": []string{"10.0.0.3"}, "expects_vm": true},
+				})
+			})
+		})
+
+		It("returns typed instances", func() {
+			instances, err := client.Instances("dns")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(instances).To(HaveLen(2))
+			Expect(instances[1].Job).To(Equal("provider"))
+			Expect(instances[1].AZ).To(Equal("z2"))
+			Expect(instances[1].IPs).To(ConsistOf("10.0.0.3"))
+		})
+	})
+
+	Describe("Deploy", func() {
+		BeforeEach(func() {
+			fake.redirectToTask("/deployments", 42)
+		})
+
+		It("posts the manifest as YAML and returns the task id", func() {
+			taskID, err := client.Deploy([]byte("name: dns"), director.DeployOptions{Recreate: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(taskID).To(Equal(42))
+
+			req := fake.lastRequest()
+			Expect(req.Method).To(Equal("POST"))
+			Expect(req.ContentType).To(Equal("text/yaml"))
+			Expect(req.Query).To(Equal("recreate=true"))
+			Expect(req.Body).To(Equal("name: dns"))
+		})
+	})
+
+	Describe("Tasks", func() {
+		BeforeEach(func() {
+			fake.mux.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, []map[string]interface{}{
+					{"id": 7, "state": "error", "description": "create deployment", "result": "boom", "deployment": "dns"},
+				})
+			})
+			fake.mux.HandleFunc("/tasks/7/output", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "%s log", r.URL.Query().Get("type"))
+			})
+		})
+
+		It("filters by deployment and state", func() {
+			tasks, err := client.Tasks(director.TasksFilter{Deployment: "dns", States: []string{"error", "done"}, Limit: 1})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(tasks).To(HaveLen(1))
+			Expect(tasks[0].ID).To(Equal(7))
+			Expect(tasks[0].IsRunning()).To(BeFalse())
+			Expect(tasks[0].IsSuccessful()).To(BeFalse())
+			Expect(fake.lastRequest().Query).To(Equal("deployment=dns&limit=1&state=error%2Cdone"))
+		})
+
+		It("fetches task output by type", func() {
+			output, err := client.TaskOutput(7, director.TaskOutputDebug)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output).To(Equal("debug log"))
+		})
+	})
+
+	Describe("configs", func() {
+		BeforeEach(func() {
+			fake.mux.HandleFunc("/configs", func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case "POST":
+					w.WriteHeader(http.StatusCreated)
+					writeJSON(w, map[string]interface{}{"id": "3", "type": "cpi", "name": "test", "content": "cpis: []", "current": true})
+				case "DELETE":
+					if r.URL.Query().Get("name") == "missing" {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					w.WriteHeader(http.StatusNoContent)
+				}
+			})
+		})
+
+		It("updates configs", func() {
+			config, err := client.UpdateConfig("cpi", "test", "cpis: []")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.ID).To(Equal("3"))
+			Expect(config.Current).To(BeTrue())
+
+			req := fake.lastRequest()
+			Expect(req.ContentType).To(Equal("application/json"))
+			Expect(req.Body).To(MatchJSON(`{"type":"cpi","name":"test","content":"cpis: []"}`))
+		})
+
+		It("reports whether a config was deleted", func() {
+			deleted, err := client.DeleteConfig("cpi", "test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deleted).To(BeTrue())
+
+			deleted, err = client.DeleteConfig("cpi", "missing")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deleted).To(BeFalse())
+		})
+	})
+
+	Describe("resurrection", func() {
+		BeforeEach(func() {
+			fake.mux.HandleFunc("/resurrection", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+		})
+
+		It("pauses resurrection for every instance", func() {
+			Expect(client.UpdateResurrection(false)).To(Succeed())
+
+			req := fake.lastRequest()
+			Expect(req.Method).To(Equal("PUT"))
+			Expect(req.Body).To(MatchJSON(`{"resurrection_paused":true}`))
+
+			Expect(client.UpdateResurrection(true)).To(Succeed())
+			Expect(fake.lastRequest().Body).To(MatchJSON(`{"resurrection_paused":false}`))
+		})
+	})
+
+	Describe("releases and stemcells", func() {
+		BeforeEach(func() {
+			fake.redirectToTask("/releases", 5)
+			fake.redirectToTask("/stemcells", 6)
+		})
+
+		It("uploads releases by URL", func() {
+			taskID, err := client.UploadReleaseURL("https://example.com/syslog.tgz", director.UploadOptions{SHA1: "abc"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(taskID).To(Equal(5))
+			Expect(fake.lastRequest().Body).To(MatchJSON(`{"location":"https://example.com/syslog.tgz","sha1":"abc"}`))
+		})
+
+		It("streams stemcell tarballs", func() {
+			tarball, err := ioutil.TempFile("", "stemcell")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tarball.Name())
+			_, err = tarball.WriteString("stemcell-bytes")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tarball.Close()).To(Succeed())
+
+			taskID, err := client.UploadStemcellFile(tarball.Name(), director.UploadOptions{Fix: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(taskID).To(Equal(6))
+
+			req := fake.lastRequest()
+			Expect(req.ContentType).To(Equal("application/x-compressed"))
+			Expect(req.Query).To(Equal("fix=true"))
+			Expect(req.Body).To(Equal("stemcell-bytes"))
+		})
+	})
+
+	Describe("orphaned disks", func() {
+		BeforeEach(func() {
+			fake.mux.HandleFunc("/orphan_disks", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, []map[string]interface{}{
+					{"disk_cid": "disk-1", "size": 1024, "az": "z1", "deployment_name": "dns", "instance_name": "provider/abc", "orphaned_at": "2018-01-01 00:00:00 UTC"},
+				})
+			})
+			fake.redirectToTask("/orphan_disks/disk-1", 8)
+		})
+
+		It("lists and deletes orphaned disks", func() {
+			disks, err := client.OrphanedDisks()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(disks).To(Equal([]director.OrphanedDisk{{
+				DiskCID:      "disk-1",
+				Size:         1024,
+				AZ:           "z1",
+				Deployment:   "dns",
+				InstanceName: "provider/abc",
+				OrphanedAt:   "2018-01-01 00:00:00 UTC",
+			}}))
+
+			taskID, err := client.DeleteOrphanedDisk("disk-1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(taskID).To(Equal(8))
+			Expect(fake.lastRequest().Method).To(Equal("DELETE"))
+		})
+	})
+
+	Describe("events", func() {
+		var pages map[string][]map[string]interface{}
+
+		eventsFrom := func(newest, oldest int) []map[string]interface{} {
+			var events []map[string]interface{}
+			for id := newest; id >= oldest; id-- {
+				events = append(events, map[string]interface{}{"id": fmt.Sprint(id), "action": "create", "object_type": "deployment", "object_name": "dns"})
+			}
+			return events
+		}
+
+		BeforeEach(func() {
+			pages = map[string][]map[string]interface{}{
+				"":    eventsFrom(450, 251),
+				"251": eventsFrom(250, 51),
+				"51":  eventsFrom(50, 1),
+			}
+			fake.mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case "GET":
+					writeJSON(w, pages[r.URL.Query().Get("before_id")])
+				case "POST":
+					w.WriteHeader(http.StatusOK)
+				}
+			})
+			fake.mux.HandleFunc("/events/7", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, map[string]interface{}{
+					"id": "7", "parent_id": "6", "timestamp": 1500000000, "user": "admin", "action": "update",
+					"object_type": "deployment", "object_name": "dns", "task": "12", "deployment": "dns",
+					"context": map[string]interface{}{"before": []string{}},
+				})
+			})
+			fake.mux.HandleFunc("/events/8", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, "Event not found")
+			})
+		})
+
+		It("filters the first page", func() {
+			events, err := client.Events(director.EventsFilter{Deployment: "dns", Task: 12, ObjectType: "vm", BeforeID: 300})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(BeEmpty())
+			Expect(fake.lastRequest().Query).To(Equal("before_id=300&deployment=dns&object_type=vm&task=12"))
+
+			events, err = client.Events(director.EventsFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(200))
+			Expect(fake.lastRequest().Query).To(BeEmpty())
+		})
+
+		It("pages back to the events after an ID", func() {
+			events, err := client.Events(director.EventsFilter{AfterID: 40})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(410))
+			Expect(events[0].ID).To(Equal("450"))
+			Expect(events[409].ID).To(Equal("41"))
+		})
+
+		It("fetches single events", func() {
+			event, found, err := client.Event(7)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(event).To(Equal(director.Event{
+				ID: "7", ParentID: "6", Timestamp: 1500000000, User: "admin", Action: "update",
+				ObjectType: "deployment", ObjectName: "dns", Task: "12", Deployment: "dns",
+				Context: map[string]interface{}{"before": []interface{}{}},
+			}))
+
+			_, found, err = client.Event(8)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("creates events", func() {
+			Expect(client.CreateEvent(director.NewEvent{Action: "brats", ObjectType: "test", ObjectName: "events"})).To(Succeed())
+
+			req := fake.lastRequest()
+			Expect(req.Method).To(Equal("POST"))
+			Expect(req.Body).To(MatchJSON(`{"action":"brats","object_type":"test","object_name":"events"}`))
+		})
+	})
+
+	Describe("links", func() {
+		BeforeEach(func() {
+			fake.mux.HandleFunc("/link_providers", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, []map[string]interface{}{{
+					"id": "1", "name": "some-service", "shared": true, "deployment": "links-provider",
+					"link_provider_definition": map[string]string{"type": "whatever", "name": "some-service"},
+					"owner_object": map[string]interface{}{
+						"type": "job", "name": "link-provider", "info": map[string]string{"instance_group": "provider"},
+					},
+				}})
+			})
+			fake.mux.HandleFunc("/link_consumers", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, []map[string]interface{}{{
+					"id": "2", "name": "some-service", "optional": false, "deployment": "links-provider",
+					"link_consumer_definition": map[string]string{"type": "whatever", "name": "some-service"},
+					"owner_object":             map[string]string{"type": "external", "name": "brats"},
+				}})
+			})
+			fake.mux.HandleFunc("/links", func(w http.ResponseWriter, r *http.Request) {
+				link := map[string]interface{}{
+					"id": "3", "name": "some-service", "link_consumer_id": "2", "link_provider_id": "1",
+					"created_at": "2018-01-01 00:00:00 UTC",
+				}
+				if r.Method == "POST" {
+					writeJSON(w, link)
+					return
+				}
+				writeJSON(w, []map[string]interface{}{link, {"id": "4", "name": "manual", "link_consumer_id": "5", "link_provider_id": nil}})
+			})
+			fake.mux.HandleFunc("/links/3", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+			fake.mux.HandleFunc("/links/4", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(w, map[string]interface{}{"code": 810005, "description": "Error deleting link: not a external link"})
+			})
+			fake.mux.HandleFunc("/link_address", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, map[string]string{"address": "q-a1s3.q-g1.bosh"})
+			})
+		})
+
+		It("lists the providers, consumers and links of a deployment", func() {
+			providers, err := client.LinkProviders("links-provider")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fake.lastRequest().Query).To(Equal("deployment=links-provider"))
+			Expect(providers).To(Equal([]director.LinkProvider{{
+				ID: "1", Name: "some-service", Shared: true, Deployment: "links-provider",
+				Definition: director.LinkDefinition{Name: "some-service", Type: "whatever"},
+				Owner:      director.LinkOwner{Type: "job", Name: "link-provider", Info: director.LinkOwnerInfo{InstanceGroup: "provider"}},
+			}}))
+
+			consumers, err := client.LinkConsumers("links-provider")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(consumers).To(Equal([]director.LinkConsumer{{
+				ID: "2", Name: "some-service", Deployment: "links-provider",
+				Definition: director.LinkDefinition{Name: "some-service", Type: "whatever"},
+				Owner:      director.LinkOwner{Type: "external", Name: "brats"},
+			}}))
+
+			links, err := client.Links("links-provider")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(links).To(Equal([]director.Link{
+				{ID: "3", Name: "some-service", ConsumerID: "2", ProviderID: "1", CreatedAt: "2018-01-01 00:00:00 UTC"},
+				{ID: "4", Name: "manual", ConsumerID: "5"},
+			}))
+		})
+
+		It("creates and deletes external links", func() {
+			link, err := client.CreateLink(director.NewLink{ProviderID: "1", Consumer: "brats", Network: "default"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(link.ID).To(Equal("3"))
+
+			req := fake.lastRequest()
+			Expect(req.Method).To(Equal("POST"))
+			Expect(req.ContentType).To(Equal("application/json"))
+			Expect(req.Body).To(MatchJSON(`{
+				"link_provider_id": "1",
+				"link_consumer": {"owner_object": {"type": "external", "name": "brats"}},
+				"network": "default"
+			}`))
+
+			Expect(client.DeleteLink("3")).To(Succeed())
+			Expect(fake.lastRequest().Method).To(Equal("DELETE"))
+
+			Expect(client.DeleteLink("4")).To(Equal(director.Error{
+				StatusCode: http.StatusBadRequest, Code: 810005, Description: "Error deleting link: not a external link",
+			}))
+		})
+
+		It("filters link addresses by AZ and health", func() {
+			address, err := client.LinkAddress("3", director.LinkAddressFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(address).To(Equal("q-a1s3.q-g1.bosh"))
+			Expect(fake.lastRequest().Query).To(Equal("link_id=3"))
+
+			_, err = client.LinkAddress("3", director.LinkAddressFilter{AZs: []string{"z1", "z2"}, Status: director.LinkAddressStatusHealthy})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fake.lastRequest().Query).To(Equal("azs%5B%5D=z1&azs%5B%5D=z2&link_id=3&status=healthy"))
+		})
+	})
+
+	Describe("errors", func() {
+		BeforeEach(func() {
+			fake.mux.HandleFunc("/deployments/missing/instances", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				writeJSON(w, map[string]interface{}{"code": 70000, "description": "Deployment 'missing' doesn't exist"})
+			})
+		})
+
+		It("returns the director's error description", func() {
+			_, err := client.Instances("missing")
+			Expect(err).To(Equal(director.Error{
+				StatusCode:  http.StatusNotFound,
+				Code:        70000,
+				Description: "Deployment 'missing' doesn't exist",
+			}))
+		})
+	})
+})
@@ -0,0 +1,81 @@
+package director
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type Config struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Content   string `json:"content"`
+	Team      string `json:"team"`
+	CreatedAt string `json:"created_at"`
+	Current   bool   `json:"current"`
+}
+
+type ConfigsFilter struct {
+	Type string
+	Name string
+
+	// IncludeOutdated lists every stored version instead of only the latest
+	// config for each type and name.
+	IncludeOutdated bool
+	Limit           int
+}
+
+func (c *Client) Configs(filter ConfigsFilter) ([]Config, error) {
+	query := url.Values{}
+	if filter.Type != "" {
+		query.Set("type", filter.Type)
+	}
+	if filter.Name != "" {
+		query.Set("name", filter.Name)
+	}
+	if filter.IncludeOutdated {
+		query.Set("latest", "false")
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	var configs []Config
+	err := c.getJSON("/configs", query, &configs)
+	return configs, err
+}
+
+func (c *Client) UpdateConfig(configType, name, content string) (Config, error) {
+	body := map[string]string{
+		"type":    configType,
+		"name":    name,
+		"content": content,
+	}
+
+	var config Config
+	err := c.sendJSON("POST", "/configs", nil, body, &config, http.StatusCreated)
+	return config, err
+}
+
+// DeleteConfig deletes every version of the named config. It returns false
+// when there was nothing to delete.
+func (c *Client) DeleteConfig(configType, name string) (bool, error) {
+	query := url.Values{"type": {configType}, "name": {name}}
+
+	resp, err := c.do("DELETE", "/configs", query, "", nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if err := expectStatus(resp, http.StatusNoContent); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,104 @@
+package director
+
+import (
+	"bytes"
+	"net/url"
+)
+
+type Deployment struct {
+	Name      string        `json:"name"`
+	Teams     []string      `json:"teams"`
+	Releases  []NameVersion `json:"releases"`
+	Stemcells []NameVersion `json:"stemcells"`
+}
+
+type NameVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Instance struct {
+	AgentID     string   `json:"agent_id"`
+	CID         string   `json:"cid"`
+	Job         string   `json:"job"`
+	Index       int      `json:"index"`
+	ID          string   `json:"id"`
+	AZ          string   `json:"az"`
+	IPs         []string `json:"ips"`
+	VMCreatedAt string   `json:"vm_created_at"`
+	ExpectsVM   bool     `json:"expects_vm"`
+}
+
+type VM struct {
+	AgentID     string   `json:"agent_id"`
+	CID         string   `json:"cid"`
+	Job         string   `json:"job"`
+	Index       int      `json:"index"`
+	ID          string   `json:"id"`
+	AZ          string   `json:"az"`
+	IPs         []string `json:"ips"`
+	VMCreatedAt string   `json:"vm_created_at"`
+	Active      bool     `json:"active"`
+}
+
+type DeployOptions struct {
+	Recreate bool
+	Fix      bool
+	DryRun   bool
+}
+
+type DeleteDeploymentOptions struct {
+	Force bool
+}
+
+func (c *Client) Deployments() ([]Deployment, error) {
+	var deployments []Deployment
+	err := c.getJSON("/deployments", url.Values{"exclude_configs": {"true"}}, &deployments)
+	return deployments, err
+}
+
+func (c *Client) DeploymentManifest(name string) (string, error) {
+	var resp struct {
+		Manifest string `json:"manifest"`
+	}
+	err := c.getJSON("/deployments/"+url.PathEscape(name), nil, &resp)
+	return resp.Manifest, err
+}
+
+// Deploy queues an update of the deployment named in manifest and returns the
+// id of the resulting task.
+func (c *Client) Deploy(manifest []byte, opts DeployOptions) (int, error) {
+	query := url.Values{}
+	if opts.Recreate {
+		query.Set("recreate", "true")
+	}
+	if opts.Fix {
+		query.Set("fix", "true")
+	}
+	if opts.DryRun {
+		query.Set("dry_run", "true")
+	}
+
+	return c.startTask("POST", "/deployments", query, "text/yaml", bytes.NewReader(manifest))
+}
+
+func (c *Client) DeleteDeployment(name string, opts DeleteDeploymentOptions) (int, error) {
+	query := url.Values{}
+	if opts.Force {
+		query.Set("force", "true")
+	}
+
+	return c.startTask("DELETE", "/deployments/"+url.PathEscape(name), query, "", nil)
+}
+
+func (c *Client) Instances(deployment string) ([]Instance, error) {
+	var instances []Instance
+	err := c.getJSON("/deployments/"+url.PathEscape(deployment)+"/instances", nil, &instances)
+	return instances, err
+}
+
+func (c *Client) VMs(deployment string) ([]VM, error) {
+	var vms []VM
+	err := c.getJSON("/deployments/"+url.PathEscape(deployment)+"/vms", nil, &vms)
+	return vms, err
+}
@@ -0,0 +1,24 @@
+package director
+
+import (
+	"net/url"
+)
+
+type OrphanedDisk struct {
+	DiskCID      string `json:"disk_cid"`
+	Size         int    `json:"size"`
+	AZ           string `json:"az"`
+	Deployment   string `json:"deployment_name"`
+	InstanceName string `json:"instance_name"`
+	OrphanedAt   string `json:"orphaned_at"`
+}
+
+func (c *Client) OrphanedDisks() ([]OrphanedDisk, error) {
+	var disks []OrphanedDisk
+	err := c.getJSON("/orphan_disks", nil, &disks)
+	return disks, err
+}
+
+func (c *Client) DeleteOrphanedDisk(cid string) (int, error) {
+	return c.startTask("DELETE", "/orphan_disks/"+url.PathEscape(cid), nil, "", nil)
+}
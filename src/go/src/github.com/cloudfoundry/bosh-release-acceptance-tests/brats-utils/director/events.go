@@ -0,0 +1,143 @@
+package director
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// eventsPageSize is how many events the director returns at most per
+// request, newest first.
+const eventsPageSize = 200
+
+// Event is an entry of the director's audit trail. Events come in pairs for
+// operations that take a while: the one recorded when the operation ends has
+// the one recorded when it started as its parent.
+type Event struct {
+	ID         string                 `json:"id"`
+	ParentID   string                 `json:"parent_id"`
+	Timestamp  int64                  `json:"timestamp"`
+	User       string                 `json:"user"`
+	Action     string                 `json:"action"`
+	ObjectType string                 `json:"object_type"`
+	ObjectName string                 `json:"object_name"`
+	Error      string                 `json:"error"`
+	Task       string                 `json:"task"`
+	Deployment string                 `json:"deployment"`
+	Instance   string                 `json:"instance"`
+	Context    map[string]interface{} `json:"context"`
+}
+
+func (e Event) IDNumber() int {
+	id, _ := strconv.Atoi(e.ID)
+	return id
+}
+
+type EventsFilter struct {
+	Deployment string
+	Task       int
+	Instance   string
+	User       string
+	Action     string
+	ObjectType string
+	ObjectName string
+
+	// BeforeID only returns events older than the given one.
+	BeforeID int
+
+	// AfterID only returns events newer than the given one. The director
+	// can't filter on it, so the client pages back until it gets there.
+	AfterID int
+}
+
+// Events returns the matching events, newest first. Without AfterID, that
+// is only the director's first page.
+func (c *Client) Events(filter EventsFilter) ([]Event, error) {
+	query := url.Values{}
+	if filter.Deployment != "" {
+		query.Set("deployment", filter.Deployment)
+	}
+	if filter.Task > 0 {
+		query.Set("task", strconv.Itoa(filter.Task))
+	}
+	if filter.Instance != "" {
+		query.Set("instance", filter.Instance)
+	}
+	if filter.User != "" {
+		query.Set("user", filter.User)
+	}
+	if filter.Action != "" {
+		query.Set("action", filter.Action)
+	}
+	if filter.ObjectType != "" {
+		query.Set("object_type", filter.ObjectType)
+	}
+	if filter.ObjectName != "" {
+		query.Set("object_name", filter.ObjectName)
+	}
+
+	beforeID := filter.BeforeID
+	var events []Event
+	for {
+		if beforeID > 0 {
+			query.Set("before_id", strconv.Itoa(beforeID))
+		}
+
+		var page []Event
+		if err := c.getJSON("/events", query, &page); err != nil {
+			return nil, err
+		}
+
+		for _, event := range page {
+			if event.IDNumber() <= filter.AfterID {
+				return events, nil
+			}
+			events = append(events, event)
+		}
+
+		if filter.AfterID == 0 || len(page) < eventsPageSize {
+			return events, nil
+		}
+		beforeID = page[len(page)-1].IDNumber()
+	}
+}
+
+// Event returns a single event. It returns false when there is none with
+// the ID, e.g. because it was cleaned up.
+func (c *Client) Event(id int) (Event, bool, error) {
+	resp, err := c.do("GET", fmt.Sprintf("/events/%d", id), nil, "", nil)
+	if err != nil {
+		return Event{}, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return Event{}, false, nil
+	}
+
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return Event{}, false, err
+	}
+
+	var event Event
+	if err := decodeJSON(resp.Body, &event); err != nil {
+		return Event{}, false, err
+	}
+	return event, true, nil
+}
+
+type NewEvent struct {
+	Action     string                 `json:"action"`
+	ObjectType string                 `json:"object_type"`
+	ObjectName string                 `json:"object_name"`
+	Deployment string                 `json:"deployment,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Context    map[string]interface{} `json:"context,omitempty"`
+}
+
+// CreateEvent adds an event to the audit trail, which only admins may do.
+func (c *Client) CreateEvent(event NewEvent) error {
+	return c.sendJSON("POST", "/events", nil, event, nil, http.StatusOK)
+}
@@ -0,0 +1,33 @@
+package director
+
+type Info struct {
+	Name            string `json:"name"`
+	UUID            string `json:"uuid"`
+	Version         string `json:"version"`
+	User            string `json:"user"`
+	CPI             string `json:"cpi"`
+	StemcellOS      string `json:"stemcell_os"`
+	StemcellVersion string `json:"stemcell_version"`
+
+	UserAuthentication UserAuthentication `json:"user_authentication"`
+	Features           map[string]Feature `json:"features"`
+}
+
+type UserAuthentication struct {
+	Type    string `json:"type"`
+	Options struct {
+		URL  string   `json:"url"`
+		URLs []string `json:"urls"`
+	} `json:"options"`
+}
+
+type Feature struct {
+	Status bool                   `json:"status"`
+	Extras map[string]interface{} `json:"extras"`
+}
+
+func (c *Client) Info() (Info, error) {
+	var info Info
+	err := c.getJSON("/info", nil, &info)
+	return info, err
+}
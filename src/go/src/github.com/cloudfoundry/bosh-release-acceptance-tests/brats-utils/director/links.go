@@ -0,0 +1,145 @@
+package director
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// The health a link address can ask bosh-dns to filter instances by. The
+// default leaves the choice to bosh-dns.
+const (
+	LinkAddressStatusDefault   = "default"
+	LinkAddressStatusHealthy   = "healthy"
+	LinkAddressStatusUnhealthy = "unhealthy"
+	LinkAddressStatusAll       = "all"
+)
+
+// LinkDefinition is the name and type a job's spec gives a link.
+type LinkDefinition struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// LinkOwner is what provides or consumes a link: a job of an instance
+// group, or something outside the director for links created through the
+// API.
+type LinkOwner struct {
+	Type string        `json:"type"`
+	Name string        `json:"name"`
+	Info LinkOwnerInfo `json:"info"`
+}
+
+type LinkOwnerInfo struct {
+	InstanceGroup string `json:"instance_group"`
+}
+
+// LinkProvider is a link a deployment provides, under the name it is
+// consumed by, i.e. its alias if it has one.
+type LinkProvider struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	Shared     bool           `json:"shared"`
+	Deployment string         `json:"deployment"`
+	Definition LinkDefinition `json:"link_provider_definition"`
+	Owner      LinkOwner      `json:"owner_object"`
+}
+
+type LinkConsumer struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	Optional   bool           `json:"optional"`
+	Deployment string         `json:"deployment"`
+	Definition LinkDefinition `json:"link_consumer_definition"`
+	Owner      LinkOwner      `json:"owner_object"`
+}
+
+// Link connects a consumer to the provider it resolved to. ProviderID is
+// empty for a link to a manual provider, i.e. one given in the manifest.
+type Link struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	ConsumerID string `json:"link_consumer_id"`
+	ProviderID string `json:"link_provider_id"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// NewLink is a link for a consumer outside the director to a shared
+// provider. The link belongs to the provider's deployment.
+type NewLink struct {
+	ProviderID string
+	Consumer   string
+
+	// Network is the provider's network to address instances on instead
+	// of its default one.
+	Network string
+}
+
+type LinkAddressFilter struct {
+	AZs    []string
+	Status string
+}
+
+func (c *Client) LinkProviders(deployment string) ([]LinkProvider, error) {
+	var providers []LinkProvider
+	err := c.getJSON("/link_providers", url.Values{"deployment": {deployment}}, &providers)
+	return providers, err
+}
+
+func (c *Client) LinkConsumers(deployment string) ([]LinkConsumer, error) {
+	var consumers []LinkConsumer
+	err := c.getJSON("/link_consumers", url.Values{"deployment": {deployment}}, &consumers)
+	return consumers, err
+}
+
+// Links returns the links of the deployment's consumers.
+func (c *Client) Links(deployment string) ([]Link, error) {
+	var links []Link
+	err := c.getJSON("/links", url.Values{"deployment": {deployment}}, &links)
+	return links, err
+}
+
+func (c *Client) CreateLink(link NewLink) (Link, error) {
+	body := map[string]interface{}{
+		"link_provider_id": link.ProviderID,
+		"link_consumer": map[string]interface{}{
+			"owner_object": map[string]string{"type": "external", "name": link.Consumer},
+		},
+	}
+	if link.Network != "" {
+		body["network"] = link.Network
+	}
+
+	var created Link
+	err := c.sendJSON("POST", "/links", nil, body, &created, http.StatusOK)
+	return created, err
+}
+
+// DeleteLink deletes a link created through the API. The director refuses
+// to delete the links of jobs.
+func (c *Client) DeleteLink(id string) error {
+	resp, err := c.do("DELETE", "/links/"+url.PathEscape(id), nil, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return expectStatus(resp, http.StatusNoContent)
+}
+
+// LinkAddress returns the bosh-dns query that resolves to the instances of
+// the link's provider which match the filter.
+func (c *Client) LinkAddress(linkID string, filter LinkAddressFilter) (string, error) {
+	query := url.Values{"link_id": {linkID}}
+	if len(filter.AZs) > 0 {
+		query["azs[]"] = filter.AZs
+	}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+
+	var result struct {
+		Address string `json:"address"`
+	}
+	err := c.getJSON("/link_address", query, &result)
+	return result.Address, err
+}
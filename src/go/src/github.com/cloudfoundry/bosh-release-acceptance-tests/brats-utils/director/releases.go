@@ -0,0 +1,75 @@
+package director
+
+import (
+	"net/url"
+	"os"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+type Release struct {
+	Name     string           `json:"name"`
+	Versions []ReleaseVersion `json:"release_versions"`
+}
+
+type ReleaseVersion struct {
+	Version            string   `json:"version"`
+	CommitHash         string   `json:"commit_hash"`
+	UncommittedChanges bool     `json:"uncommitted_changes"`
+	CurrentlyDeployed  bool     `json:"currently_deployed"`
+	JobNames           []string `json:"job_names"`
+}
+
+type UploadOptions struct {
+	SHA1 string
+	Fix  bool
+}
+
+func (c *Client) Releases() ([]Release, error) {
+	var releases []Release
+	err := c.getJSON("/releases", nil, &releases)
+	return releases, err
+}
+
+// UploadReleaseURL asks the director to download the release at location and
+// returns the id of the import task.
+func (c *Client) UploadReleaseURL(location string, opts UploadOptions) (int, error) {
+	body := map[string]string{"location": location}
+	if opts.SHA1 != "" {
+		body["sha1"] = opts.SHA1
+	}
+
+	return c.startJSONTask("POST", "/releases", uploadQuery(opts), body)
+}
+
+func (c *Client) UploadReleaseFile(path string, opts UploadOptions) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, bosherr.WrapErrorf(err, "Opening release tarball '%s'", path)
+	}
+	defer file.Close()
+
+	return c.startTask("POST", "/releases", uploadQuery(opts), "application/x-compressed", file)
+}
+
+// DeleteRelease deletes a single release version, or every version of the
+// release when version is empty.
+func (c *Client) DeleteRelease(name, version string, force bool) (int, error) {
+	query := url.Values{}
+	if version != "" {
+		query.Set("version", version)
+	}
+	if force {
+		query.Set("force", "true")
+	}
+
+	return c.startTask("DELETE", "/releases/"+url.PathEscape(name), query, "", nil)
+}
+
+func uploadQuery(opts UploadOptions) url.Values {
+	query := url.Values{}
+	if opts.Fix {
+		query.Set("fix", "true")
+	}
+	return query
+}
@@ -0,0 +1,10 @@
+package director
+
+import "net/http"
+
+// UpdateResurrection turns resurrection on or off for every instance, like
+// `bosh update-resurrection`.
+func (c *Client) UpdateResurrection(enabled bool) error {
+	body := map[string]bool{"resurrection_paused": !enabled}
+	return c.sendJSON("PUT", "/resurrection", nil, body, nil, http.StatusOK)
+}
@@ -0,0 +1,55 @@
+package director
+
+import (
+	"net/url"
+	"os"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+type Stemcell struct {
+	Name            string `json:"name"`
+	OperatingSystem string `json:"operating_system"`
+	Version         string `json:"version"`
+	CID             string `json:"cid"`
+	CPI             string `json:"cpi"`
+	APIVersion      int    `json:"api_version"`
+
+	Deployments []struct {
+		Name string `json:"name"`
+	} `json:"deployments"`
+}
+
+func (c *Client) Stemcells() ([]Stemcell, error) {
+	var stemcells []Stemcell
+	err := c.getJSON("/stemcells", nil, &stemcells)
+	return stemcells, err
+}
+
+func (c *Client) UploadStemcellURL(location string, opts UploadOptions) (int, error) {
+	body := map[string]string{"location": location}
+	if opts.SHA1 != "" {
+		body["sha1"] = opts.SHA1
+	}
+
+	return c.startJSONTask("POST", "/stemcells", uploadQuery(opts), body)
+}
+
+func (c *Client) UploadStemcellFile(path string, opts UploadOptions) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, bosherr.WrapErrorf(err, "Opening stemcell tarball '%s'", path)
+	}
+	defer file.Close()
+
+	return c.startTask("POST", "/stemcells", uploadQuery(opts), "application/x-compressed", file)
+}
+
+func (c *Client) DeleteStemcell(name, version string, force bool) (int, error) {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+
+	return c.startTask("DELETE", "/stemcells/"+url.PathEscape(name)+"/"+url.PathEscape(version), query, "", nil)
+}
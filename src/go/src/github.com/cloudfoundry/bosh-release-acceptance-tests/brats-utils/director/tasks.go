@@ -0,0 +1,105 @@
+package director
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const (
+	TaskOutputEvent  = "event"
+	TaskOutputResult = "result"
+	TaskOutputDebug  = "debug"
+	TaskOutputCPI    = "cpi"
+)
+
+type Task struct {
+	ID          int    `json:"id"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+	Timestamp   int64  `json:"timestamp"`
+	StartedAt   *int64 `json:"started_at"`
+	Result      string `json:"result"`
+	User        string `json:"user"`
+	Deployment  string `json:"deployment"`
+	ContextID   string `json:"context_id"`
+}
+
+// IsRunning reports whether the director may still change the task's state.
+func (t Task) IsRunning() bool {
+	return t.State == "queued" || t.State == "processing" || t.State == "cancelling"
+}
+
+func (t Task) IsSuccessful() bool {
+	return t.State == "done"
+}
+
+type TasksFilter struct {
+	States     []string
+	Deployment string
+	ContextID  string
+	Limit      int
+
+	// All includes tasks that the CLI hides by default, e.g. ssh,
+	// fetch_logs and cck_scan_and_fix tasks.
+	All bool
+}
+
+func (c *Client) Tasks(filter TasksFilter) ([]Task, error) {
+	query := url.Values{}
+	if len(filter.States) > 0 {
+		query.Set("state", strings.Join(filter.States, ","))
+	}
+	if filter.Deployment != "" {
+		query.Set("deployment", filter.Deployment)
+	}
+	if filter.ContextID != "" {
+		query.Set("context_id", filter.ContextID)
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.All {
+		query.Set("verbose", "2")
+	}
+
+	var tasks []Task
+	err := c.getJSON("/tasks", query, &tasks)
+	return tasks, err
+}
+
+func (c *Client) Task(id int) (Task, error) {
+	var task Task
+	err := c.getJSON(fmt.Sprintf("/tasks/%d", id), nil, &task)
+	return task, err
+}
+
+// TaskOutput returns the raw contents of one of the task's logs; outputType
+// is one of the TaskOutput* constants.
+func (c *Client) TaskOutput(id int, outputType string) (string, error) {
+	resp, err := c.do("GET", fmt.Sprintf("/tasks/%d/output", id), url.Values{"type": {outputType}}, "", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return "", nil
+	}
+
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	output, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Reading %s output of task %d", outputType, id)
+	}
+
+	return string(output), nil
+}
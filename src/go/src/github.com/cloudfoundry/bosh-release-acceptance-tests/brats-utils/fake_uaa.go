@@ -0,0 +1,377 @@
+package bratsutils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// UAASigningKey is a key a FakeUAA signs tokens with: an RSA key, whose
+// public half goes in director.user_management.uaa.public_key, or a
+// symmetric one for director.user_management.uaa.symmetric_key.
+type UAASigningKey struct {
+	ID        string
+	Symmetric string
+
+	private *rsa.PrivateKey
+}
+
+func NewUAASigningKey(id string) (UAASigningKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return UAASigningKey{}, bosherr.WrapError(err, "Generating UAA signing key")
+	}
+	return UAASigningKey{ID: id, private: key}, nil
+}
+
+func NewSymmetricUAASigningKey(id, secret string) UAASigningKey {
+	return UAASigningKey{ID: id, Symmetric: secret}
+}
+
+// Algorithm is the JWS algorithm of the tokens the key signs.
+func (k UAASigningKey) Algorithm() string {
+	if k.private == nil {
+		return "HS256"
+	}
+	return "RS256"
+}
+
+// PublicKeyPEM returns the public key in the PEM format the director
+// expects, or an empty string for a symmetric key.
+func (k UAASigningKey) PublicKeyPEM() string {
+	if k.private == nil {
+		return ""
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&k.private.PublicKey)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func (k UAASigningKey) sign(signingInput string) ([]byte, error) {
+	if k.private == nil {
+		mac := hmac.New(sha256.New, []byte(k.Symmetric))
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil), nil
+	}
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, k.private, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Signing token")
+	}
+	return signature, nil
+}
+
+// jwk is the key as UAA lists it at /token_keys.
+func (k UAASigningKey) jwk() map[string]interface{} {
+	if k.private == nil {
+		return map[string]interface{}{
+			"kty": "MAC", "alg": k.Algorithm(), "use": "sig", "kid": k.ID, "value": k.Symmetric,
+		}
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	return map[string]interface{}{
+		"kty":   "RSA",
+		"alg":   k.Algorithm(),
+		"use":   "sig",
+		"kid":   k.ID,
+		"value": k.PublicKeyPEM(),
+		"n":     encode(k.private.PublicKey.N.Bytes()),
+		"e":     encode(big.NewInt(int64(k.private.PublicKey.E)).Bytes()),
+	}
+}
+
+type fakeUAAClient struct {
+	secret string
+	scopes []string
+}
+
+// FakeUAA stands in for the UAA a director with
+// director.user_management.provider: uaa sends its users to. It answers the
+// client credentials grant with JWTs signed with its signing key and lists
+// that key at /token_keys.
+//
+// The CLI trusts the same CA for the director and its UAA, so FakeUAA
+// serves a certificate signed by the CA of the director it is given, and
+// lets in that director's admin client with bosh.admin. Both are looked up
+// on use, since the director's vars store only exists once it is started.
+type FakeUAA struct {
+	advertisedIP string
+	director     func() (InnerDirectorCredentials, error)
+	address      string
+	server       *http.Server
+
+	mu           sync.Mutex
+	key          UAASigningKey
+	clients      map[string]fakeUAAClient
+	certificates map[string]*tls.Certificate
+}
+
+// NewFakeUAA listens on a free port of host. Its certificate is valid for
+// advertisedIP, which is where the director and the CLI reach this host.
+func NewFakeUAA(host, advertisedIP string, key UAASigningKey, director func() (InnerDirectorCredentials, error)) (*FakeUAA, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Listening on '%s'", host)
+	}
+
+	u := &FakeUAA{
+		advertisedIP: advertisedIP,
+		director:     director,
+		address:      listener.Addr().String(),
+		key:          key,
+		clients:      map[string]fakeUAAClient{},
+		certificates: map[string]*tls.Certificate{},
+	}
+	u.server = &http.Server{Handler: u}
+
+	go u.server.Serve(tls.NewListener(listener, &tls.Config{GetCertificate: u.certificate}))
+	return u, nil
+}
+
+func (u *FakeUAA) Close() error {
+	return u.server.Close()
+}
+
+func (u *FakeUAA) Port() int {
+	_, port, _ := net.SplitHostPort(u.address)
+	number, _ := strconv.Atoi(port)
+	return number
+}
+
+// URL returns director.user_management.uaa.url.
+func (u *FakeUAA) URL() string {
+	return fmt.Sprintf("https://%s", net.JoinHostPort(u.advertisedIP, strconv.Itoa(u.Port())))
+}
+
+// SetSigningKey changes the key later tokens are signed with.
+func (u *FakeUAA) SetSigningKey(key UAASigningKey) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.key = key
+}
+
+func (u *FakeUAA) signingKey() UAASigningKey {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.key
+}
+
+// AddClient lets a client obtain tokens with the given scopes.
+func (u *FakeUAA) AddClient(id, secret string, scopes ...string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.clients[id] = fakeUAAClient{secret: secret, scopes: scopes}
+}
+
+// Reset forgets every client added.
+func (u *FakeUAA) Reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.clients = map[string]fakeUAAClient{}
+}
+
+// Token signs a token for a client without it asking for one, e.g. one
+// that expired a while ago when expiresIn is negative.
+func (u *FakeUAA) Token(clientID string, expiresIn time.Duration, scopes ...string) (string, error) {
+	key := u.signingKey()
+
+	now := time.Now()
+	audiences := []string{clientID}
+	for _, scope := range scopes {
+		resource := strings.SplitN(scope, ".", 2)[0]
+		if !containsString(audiences, resource) {
+			audiences = append(audiences, resource)
+		}
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": key.Algorithm(), "kid": key.ID, "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"jti":        randomAlphanumeric(32),
+		"sub":        clientID,
+		"client_id":  clientID,
+		"cid":        clientID,
+		"azp":        clientID,
+		"grant_type": "client_credentials",
+		"scope":      scopes,
+		"aud":        audiences,
+		"zid":        "uaa",
+		"iss":        u.URL() + "/oauth/token",
+		"iat":        now.Unix(),
+		"exp":        now.Add(expiresIn).Unix(),
+	})
+
+	encode := base64.RawURLEncoding.EncodeToString
+	signingInput := encode(header) + "." + encode(claims)
+	signature, err := key.sign(signingInput)
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encode(signature), nil
+}
+
+func (u *FakeUAA) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.URL.Path == "/oauth/token" && req.Method == "POST":
+		u.issueToken(w, req)
+
+	case req.URL.Path == "/token_keys" && req.Method == "GET":
+		writeReceiverJSON(w, http.StatusOK, map[string]interface{}{"keys": []interface{}{u.signingKey().jwk()}})
+
+	case req.URL.Path == "/token_key" && req.Method == "GET":
+		writeReceiverJSON(w, http.StatusOK, u.signingKey().jwk())
+
+	default:
+		writeReceiverJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+	}
+}
+
+func (u *FakeUAA) issueToken(w http.ResponseWriter, req *http.Request) {
+	clientID, clientSecret, ok := req.BasicAuth()
+	if !ok {
+		clientID, clientSecret = req.FormValue("client_id"), req.FormValue("client_secret")
+	}
+
+	if grantType := req.FormValue("grant_type"); grantType != "client_credentials" {
+		writeReceiverJSON(w, http.StatusBadRequest, map[string]string{
+			"error":             "unsupported_grant_type",
+			"error_description": fmt.Sprintf("Unsupported grant type: %s", grantType),
+		})
+		return
+	}
+
+	scopes, found := u.clientScopes(clientID, clientSecret)
+	if !found {
+		writeReceiverJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized", "error_description": "Bad credentials"})
+		return
+	}
+
+	const expiresIn = time.Hour
+	token, err := u.Token(clientID, expiresIn, scopes...)
+	if err != nil {
+		writeReceiverJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+
+	writeReceiverJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   int(expiresIn.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+		"jti":          randomAlphanumeric(32),
+	})
+}
+
+func (u *FakeUAA) clientScopes(clientID, clientSecret string) ([]string, bool) {
+	u.mu.Lock()
+	client, found := u.clients[clientID]
+	u.mu.Unlock()
+	if found {
+		return client.scopes, client.secret == clientSecret
+	}
+
+	creds, err := u.director()
+	if err != nil || creds.Client != clientID || creds.ClientSecret != clientSecret {
+		return nil, false
+	}
+	return []string{"bosh.admin"}, true
+}
+
+// certificate issues the serving certificate from the director's CA, once
+// per CA, so that a redeployed director with a new CA is trusted too.
+func (u *FakeUAA) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	creds, err := u.director()
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if certificate, found := u.certificates[creds.CACert]; found {
+		return certificate, nil
+	}
+
+	ca, caKey, err := parseDirectorCA(creds.CACert, creds.CAPrivateKey)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Loading the director's CA")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating key")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating certificate serial number")
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: u.advertisedIP},
+		IPAddresses:  []net.IP{net.ParseIP(u.advertisedIP)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(7 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Creating certificate")
+	}
+
+	certificate := &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	u.certificates[creds.CACert] = certificate
+	return certificate, nil
+}
+
+// parseDirectorCA parses the director's CA and its key, which is RSA when
+// bosh-deployment generated it and ECDSA when the local director did.
+func parseDirectorCA(certPEM, keyPEM string) (*x509.Certificate, crypto.Signer, error) {
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, bosherr.Error("Decoding CA certificate and key")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Parsing CA certificate")
+	}
+
+	var key crypto.Signer
+	switch keyBlock.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(keyBlock.Bytes)
+	default:
+		err = bosherr.Errorf("Unsupported key type '%s'", keyBlock.Type)
+	}
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Parsing CA key")
+	}
+	return cert, key, nil
+}
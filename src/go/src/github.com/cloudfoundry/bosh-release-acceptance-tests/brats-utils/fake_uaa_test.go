@@ -0,0 +1,193 @@
+package bratsutils_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testCA returns a CA certificate and its key, like a director's vars store
+// has them.
+func testCA() (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "brats-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+var _ = Describe("FakeUAA", func() {
+	var (
+		uaa    *bratsutils.FakeUAA
+		key    bratsutils.UAASigningKey
+		client *http.Client
+	)
+
+	BeforeEach(func() {
+		caCert, caKey := testCA()
+		director := func() (bratsutils.InnerDirectorCredentials, error) {
+			return bratsutils.InnerDirectorCredentials{
+				Client: "admin", ClientSecret: "admin-secret", CACert: caCert, CAPrivateKey: caKey,
+			}, nil
+		}
+
+		var err error
+		key, err = bratsutils.NewUAASigningKey("brats-key")
+		Expect(err).ToNot(HaveOccurred())
+		uaa, err = bratsutils.NewFakeUAA("127.0.0.1", "127.0.0.1", key, director)
+		Expect(err).ToNot(HaveOccurred())
+
+		// Trusting only the director's CA is what the CLI does.
+		roots := x509.NewCertPool()
+		Expect(roots.AppendCertsFromPEM([]byte(caCert))).To(BeTrue())
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	})
+
+	AfterEach(func() {
+		uaa.Close()
+	})
+
+	grant := func(clientID, secret string) (int, map[string]interface{}) {
+		resp, err := client.PostForm(uaa.URL()+"/oauth/token", url.Values{
+			"grant_type": {"client_credentials"}, "client_id": {clientID}, "client_secret": {secret},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+
+		var body map[string]interface{}
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		return resp.StatusCode, body
+	}
+
+	decodeClaims := func(token string) map[string]interface{} {
+		parts := strings.Split(token, ".")
+		Expect(parts).To(HaveLen(3))
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		Expect(err).ToNot(HaveOccurred())
+
+		var claims map[string]interface{}
+		Expect(json.Unmarshal(payload, &claims)).To(Succeed())
+		return claims
+	}
+
+	It("signs the tokens of clients it knows with the key it lists", func() {
+		uaa.AddClient("brats-read", "read-secret", "bosh.read")
+
+		status, body := grant("brats-read", "read-secret")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(HaveKeyWithValue("token_type", "bearer"))
+		Expect(body).To(HaveKeyWithValue("scope", "bosh.read"))
+
+		token := body["access_token"].(string)
+		claims := decodeClaims(token)
+		Expect(claims).To(HaveKeyWithValue("client_id", "brats-read"))
+		Expect(claims).To(HaveKeyWithValue("scope", ConsistOf("bosh.read")))
+		Expect(claims).To(HaveKeyWithValue("aud", ConsistOf("brats-read", "bosh")))
+
+		resp, err := client.Get(uaa.URL() + "/token_keys")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		var keys struct {
+			Keys []struct {
+				Kid   string `json:"kid"`
+				Alg   string `json:"alg"`
+				Value string `json:"value"`
+			} `json:"keys"`
+		}
+		Expect(json.NewDecoder(resp.Body).Decode(&keys)).To(Succeed())
+		Expect(keys.Keys).To(HaveLen(1))
+		Expect(keys.Keys[0].Kid).To(Equal("brats-key"))
+		Expect(keys.Keys[0].Alg).To(Equal("RS256"))
+		Expect(keys.Keys[0].Value).To(Equal(key.PublicKeyPEM()))
+
+		block, _ := pem.Decode([]byte(keys.Keys[0].Value))
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		Expect(err).ToNot(HaveOccurred())
+
+		parts := strings.Split(token, ".")
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		Expect(err).ToNot(HaveOccurred())
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		Expect(rsa.VerifyPKCS1v15(publicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signature)).To(Succeed())
+	})
+
+	It("gives the director's admin client bosh.admin and turns away everyone else", func() {
+		status, body := grant("admin", "admin-secret")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(decodeClaims(body["access_token"].(string))).To(HaveKeyWithValue("scope", ConsistOf("bosh.admin")))
+
+		status, _ = grant("admin", "wrong")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+
+		uaa.AddClient("brats-read", "read-secret", "bosh.read")
+		status, _ = grant("brats-read", "wrong")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+
+		uaa.Reset()
+		status, _ = grant("brats-read", "read-secret")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+
+		resp, err := client.PostForm(uaa.URL()+"/oauth/token", url.Values{"grant_type": {"password"}})
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("signs with a symmetric key once given one", func() {
+		uaa.SetSigningKey(bratsutils.NewSymmetricUAASigningKey("brats-symmetric", "brats-secret"))
+
+		token, err := uaa.Token("brats-team", time.Hour, "bosh.teams.brats.admin")
+		Expect(err).ToNot(HaveOccurred())
+
+		parts := strings.Split(token, ".")
+		header, err := base64.RawURLEncoding.DecodeString(parts[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(header).To(MatchJSON(`{"alg":"HS256","kid":"brats-symmetric","typ":"JWT"}`))
+
+		mac := hmac.New(sha256.New, []byte("brats-secret"))
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		Expect(parts[2]).To(Equal(base64.RawURLEncoding.EncodeToString(mac.Sum(nil))))
+	})
+
+	It("signs tokens that have already expired", func() {
+		token, err := uaa.Token("brats-read", -time.Hour, "bosh.read")
+		Expect(err).ToNot(HaveOccurred())
+
+		claims := decodeClaims(token)
+		Expect(claims["exp"]).To(BeNumerically("<", time.Now().Unix()))
+	})
+})
@@ -0,0 +1,112 @@
+package bratsutils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	HealthMonitorHealthzPath = "/healthz"
+
+	// DefaultHealthMonitorHTTPPort is hm.http.port unless overridden.
+	DefaultHealthMonitorHTTPPort = 25923
+)
+
+var healthzPulse = regexp.MustCompile(`^Last pulse was ([0-9.e-]+) seconds ago$`)
+
+// Healthz is the health monitor's answer to /healthz. It fails once its
+// event loop has not pulsed for three minutes.
+type Healthz struct {
+	StatusCode int
+	LastPulse  time.Duration
+}
+
+// HealthMonitorClient talks to the HTTP API of the health monitor, which
+// only listens on the director's loopback interface. See
+// TunnelToHealthMonitor.
+type HealthMonitorClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewHealthMonitorClient(baseURL string, httpClient *http.Client) *HealthMonitorClient {
+	return &HealthMonitorClient{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+}
+
+// Get returns the status code and body of any path, for checking what the
+// API does not serve.
+func (c *HealthMonitorClient) Get(path string) (int, string, error) {
+	response, err := c.httpClient.Get(c.baseURL + path)
+	if err != nil {
+		return 0, "", bosherr.WrapErrorf(err, "Requesting '%s' from the health monitor", path)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return 0, "", bosherr.WrapErrorf(err, "Reading the health monitor's response to '%s'", path)
+	}
+	return response.StatusCode, string(body), nil
+}
+
+func (c *HealthMonitorClient) Healthz() (Healthz, error) {
+	status, body, err := c.Get(HealthMonitorHealthzPath)
+	if err != nil {
+		return Healthz{}, err
+	}
+
+	match := healthzPulse.FindStringSubmatch(strings.TrimSpace(body))
+	if match == nil {
+		return Healthz{}, bosherr.Errorf("Unexpected healthz response %d '%s'", status, body)
+	}
+
+	seconds, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return Healthz{}, bosherr.WrapErrorf(err, "Parsing the last pulse '%s'", match[1])
+	}
+
+	return Healthz{StatusCode: status, LastPulse: time.Duration(seconds * float64(time.Second))}, nil
+}
+
+// TunnelToHealthMonitor forwards a local port to the health monitor's HTTP
+// port on the inner director over `bosh ssh`, and returns a client for it.
+// Call the returned function to close the tunnel.
+func TunnelToHealthMonitor(remotePort int) (*HealthMonitorClient, func()) {
+	localPort, err := freeLocalPort()
+	Expect(err).ToNot(HaveOccurred())
+
+	session := OuterBoshQuiet("-d", InnerBoshDirectorName(), "ssh", "bosh",
+		"--opts=-L", fmt.Sprintf("--opts=%d:127.0.0.1:%d", localPort, remotePort),
+		"-c", "sleep 3600",
+	)
+	stop := func() { session.Terminate().Wait(time.Minute) }
+
+	client := NewHealthMonitorClient(fmt.Sprintf("http://127.0.0.1:%d", localPort), &http.Client{Timeout: 10 * time.Second})
+	Eventually(func() error {
+		if session.ExitCode() != -1 {
+			return bosherr.Errorf("Tunnel exited with %d", session.ExitCode())
+		}
+		_, err := client.Healthz()
+		return err
+	}, 2*time.Minute, 2*time.Second).Should(Succeed())
+
+	return client, stop
+}
+
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, bosherr.WrapError(err, "Finding a free local port")
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
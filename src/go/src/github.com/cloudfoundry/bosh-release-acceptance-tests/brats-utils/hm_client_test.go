@@ -0,0 +1,69 @@
+package bratsutils_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HealthMonitorClient", func() {
+	var (
+		server *httptest.Server
+		client *bratsutils.HealthMonitorClient
+		status int
+		body   string
+	)
+
+	BeforeEach(func() {
+		status, body = http.StatusOK, "Last pulse was 0.253 seconds ago"
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != bratsutils.HealthMonitorHealthzPath {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+		}))
+		client = bratsutils.NewHealthMonitorClient(server.URL+"/", http.DefaultClient)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("parses the last pulse out of healthz", func() {
+		healthz, err := client.Healthz()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(healthz).To(Equal(bratsutils.Healthz{StatusCode: 200, LastPulse: 253 * time.Millisecond}))
+	})
+
+	It("returns a failing healthz along with its pulse", func() {
+		status, body = http.StatusInternalServerError, "Last pulse was 181.5 seconds ago"
+
+		healthz, err := client.Healthz()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(healthz.StatusCode).To(Equal(500))
+		Expect(healthz.LastPulse).To(Equal(181500 * time.Millisecond))
+	})
+
+	It("fails on anything but a pulse", func() {
+		status, body = http.StatusServiceUnavailable, "<h1>Internal Server Error</h1>"
+
+		_, err := client.Healthz()
+		Expect(err).To(MatchError(ContainSubstring("Unexpected healthz response 503")))
+	})
+
+	It("gets other paths as they are", func() {
+		status, body, err := client.Get("/agents")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(status).To(Equal(404))
+		Expect(body).To(ContainSubstring("not found"))
+	})
+})
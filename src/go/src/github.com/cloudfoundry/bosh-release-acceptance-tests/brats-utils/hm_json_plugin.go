@@ -0,0 +1,158 @@
+package bratsutils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	hmJSONRecorderPackage = "github.com/cloudfoundry/bosh-release-acceptance-tests/assets/hm-json-recorder-release/src/hm-json-recorder"
+
+	// HMJSONRecorderOutputPath is where the recorder job of the
+	// hm-json-recorder release writes the events.
+	HMJSONRecorderOutputPath = "/var/vcap/sys/log/health_monitor/hm-json-recorder.ndjson"
+)
+
+// HMJSONPluginRecord is a line the hm-json-recorder fixture writes: either
+// that it started, or an event the health monitor sent it. Lines that were
+// not JSON end up in Invalid.
+type HMJSONPluginRecord struct {
+	PID        int             `json:"pid"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Started    bool            `json:"started,omitempty"`
+	Event      json.RawMessage `json:"event,omitempty"`
+	Invalid    string          `json:"invalid,omitempty"`
+}
+
+// Kind is "heartbeat" or "alert" for events, and empty otherwise.
+func (r HMJSONPluginRecord) Kind() string {
+	var event struct {
+		Kind string `json:"kind"`
+	}
+	if len(r.Event) == 0 || json.Unmarshal(r.Event, &event) != nil {
+		return ""
+	}
+	return event.Kind
+}
+
+func (r HMJSONPluginRecord) Heartbeat() (HMHeartbeat, error) {
+	var heartbeat HMHeartbeat
+	if err := json.Unmarshal(r.Event, &heartbeat); err != nil {
+		return HMHeartbeat{}, bosherr.WrapError(err, "Unmarshaling heartbeat")
+	}
+	return heartbeat, nil
+}
+
+func (r HMJSONPluginRecord) Alert() (HMAlert, error) {
+	var alert HMAlert
+	if err := json.Unmarshal(r.Event, &alert); err != nil {
+		return HMAlert{}, bosherr.WrapError(err, "Unmarshaling alert")
+	}
+	return alert, nil
+}
+
+// HMHeartbeat is an agent heartbeat as the health monitor plugins serialize
+// it.
+type HMHeartbeat struct {
+	Kind       string                 `json:"kind"`
+	ID         string                 `json:"id"`
+	Timestamp  int64                  `json:"timestamp"`
+	Deployment string                 `json:"deployment"`
+	AgentID    string                 `json:"agent_id"`
+	Job        string                 `json:"job"`
+	Index      string                 `json:"index"`
+	InstanceID string                 `json:"instance_id"`
+	JobState   string                 `json:"job_state"`
+	Vitals     map[string]interface{} `json:"vitals"`
+	Teams      []string               `json:"teams"`
+	Metrics    []HMMetric             `json:"metrics"`
+}
+
+// HMMetric is one of the metrics the health monitor derives from the vitals
+// of a heartbeat. Values are strings.
+type HMMetric struct {
+	Name      string            `json:"name"`
+	Value     string            `json:"value"`
+	Timestamp int64             `json:"timestamp"`
+	Tags      map[string]string `json:"tags"`
+}
+
+func ParseHMJSONPluginRecords(ndjson []byte) ([]HMJSONPluginRecord, error) {
+	var records []HMJSONPluginRecord
+
+	scanner := bufio.NewScanner(bytes.NewReader(ndjson))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record HMJSONPluginRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, bosherr.WrapErrorf(err, "Parsing record '%s'", line)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, bosherr.WrapError(err, "Reading records")
+	}
+	return records, nil
+}
+
+// HMJSONPluginRecords returns what the recorder job has written on the inner
+// director so far.
+func HMJSONPluginRecords() []HMJSONPluginRecord {
+	session := OuterBoshQuiet("-d", InnerBoshDirectorName(), "ssh", "bosh", "-c",
+		"sudo cat "+HMJSONRecorderOutputPath)
+	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+
+	records, err := ParseHMJSONPluginRecords(sshStdout(session.Out.Contents()))
+	Expect(err).ToNot(HaveOccurred())
+	return records
+}
+
+// sshStdout strips the "instance: stdout | " prefix `bosh ssh -c` puts in
+// front of every line the command prints, and drops everything else.
+func sshStdout(output []byte) []byte {
+	var stdout bytes.Buffer
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		parts := bytes.SplitN(line, []byte(": stdout | "), 2)
+		if len(parts) == 2 {
+			stdout.Write(parts[1])
+			stdout.WriteByte('\n')
+		}
+	}
+	return stdout.Bytes()
+}
+
+var hmJSONRecorderOnce sync.Once
+
+// BuildHMJSONRecorder cross-compiles the recorder fixture into the
+// hm-json-recorder release, whose package expects the binary next to its
+// source. The binary is not checked in.
+func BuildHMJSONRecorder() {
+	hmJSONRecorderOnce.Do(buildHMJSONRecorder)
+}
+
+func buildHMJSONRecorder() {
+	binary, err := gexec.BuildWithEnvironment(hmJSONRecorderPackage, []string{"GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0"})
+	Expect(err).ToNot(HaveOccurred())
+
+	dest := AssetPath(filepath.Join("hm-json-recorder-release", "src", "hm-json-recorder", "hm-json-recorder"))
+
+	// Parallel nodes build it too, the rename keeps the release consistent.
+	tmp := dest + ".tmp-" + filepath.Base(filepath.Dir(binary))
+	Expect(copyFile(binary, tmp)).To(Succeed())
+	Expect(os.Chmod(tmp, 0755)).To(Succeed())
+	Expect(os.Rename(tmp, dest)).To(Succeed())
+}
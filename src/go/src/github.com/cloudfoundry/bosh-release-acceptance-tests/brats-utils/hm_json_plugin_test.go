@@ -0,0 +1,56 @@
+package bratsutils_test
+
+import (
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseHMJSONPluginRecords", func() {
+	const recorded = `{"pid":42,"received_at":"2018-03-01T12:00:00Z","started":true}
+{"pid":42,"received_at":"2018-03-01T12:00:30Z","event":{"kind":"heartbeat","id":"hb-1","timestamp":1519905630,"deployment":"os-conf-deployment","agent_id":"agent-1","job":"test-brats","index":"0","instance_id":"instance-1","job_state":"running","vitals":{"load":["0.01"]},"teams":[],"metrics":[{"name":"system.load.1m","value":"0.01","timestamp":1519905630,"tags":{"job":"test-brats","index":"0","id":"instance-1"}}]}}
+
+{"pid":43,"received_at":"2018-03-01T12:01:00Z","event":{"kind":"alert","id":"alert-1","severity":2,"title":"agent-1 has timed out","source":"os-conf-deployment: test-brats(instance-1) [id=agent-1, index=0, cid=vm-1]","deployment":"os-conf-deployment","created_at":1519905660}}
+{"pid":43,"received_at":"2018-03-01T12:01:01Z","invalid":"not json"}
+`
+
+	It("parses every record and the events in them", func() {
+		records, err := bratsutils.ParseHMJSONPluginRecords([]byte(recorded))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(records).To(HaveLen(4))
+
+		Expect(records[0].Started).To(BeTrue())
+		Expect(records[0].PID).To(Equal(42))
+		Expect(records[0].ReceivedAt).To(Equal(time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)))
+		Expect(records[0].Kind()).To(BeEmpty())
+
+		Expect(records[1].Kind()).To(Equal("heartbeat"))
+		heartbeat, err := records[1].Heartbeat()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(heartbeat.AgentID).To(Equal("agent-1"))
+		Expect(heartbeat.Index).To(Equal("0"))
+		Expect(heartbeat.Metrics).To(Equal([]bratsutils.HMMetric{{
+			Name:      "system.load.1m",
+			Value:     "0.01",
+			Timestamp: 1519905630,
+			Tags:      map[string]string{"job": "test-brats", "index": "0", "id": "instance-1"},
+		}}))
+
+		Expect(records[2].Kind()).To(Equal("alert"))
+		alert, err := records[2].Alert()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(alert.Severity).To(Equal(2))
+		Expect(alert.Job()).To(Equal("test-brats"))
+
+		Expect(records[3].Invalid).To(Equal("not json"))
+		Expect(records[3].Kind()).To(BeEmpty())
+	})
+
+	It("fails on lines that are not records", func() {
+		_, err := bratsutils.ParseHMJSONPluginRecords([]byte("{\"pid\":1}\nnope\n"))
+		Expect(err).To(MatchError(ContainSubstring("Parsing record 'nope'")))
+	})
+})
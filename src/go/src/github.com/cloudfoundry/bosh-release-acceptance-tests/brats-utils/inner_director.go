@@ -0,0 +1,301 @@
+package bratsutils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const (
+	InnerDirectorScript = "script"
+	InnerDirectorLocal  = "local"
+)
+
+// InnerDirector manages the lifecycle of the director under test. Whatever
+// the implementation, a started director leaves a `bosh` wrapper script in
+// its directory that targets it, which is what Bosh() runs.
+type InnerDirector interface {
+	// Prepare uploads or builds whatever Start needs; it runs once per suite.
+	Prepare() error
+
+	// Start brings up the director. Ops files are applied to its manifest and
+	// vars are passed through as CLI flags, e.g. "-v", "name=value".
+	Start(opsFiles, vars []string) error
+	Stop() error
+	Exists() bool
+
+	// Env is the environment the CLI needs to target the director.
+	Env() ([]string, error)
+	Credentials() (InnerDirectorCredentials, error)
+
+	// CollectLogs copies the director's logs and its rendered
+	// bosh-director.yml into dest.
+	CollectLogs(dest string) error
+
+	// HostAddress is where the director's jobs reach services the suite
+	// runs on this host, e.g. receivers for the health monitor.
+	HostAddress() string
+
+	// CPI is the CPI the director is started with, as entries of a CPI
+	// config refer to it.
+	CPI() InnerDirectorCPI
+}
+
+// innerDirectorLogDirs are the job log directories under /var/vcap/sys/log
+// worth keeping when a spec fails.
+var innerDirectorLogDirs = []string{"director", "blobstore", "health_monitor", "nats"}
+
+// InnerDirectorCPI is the type and executable of a CPI config entry.
+type InnerDirectorCPI struct {
+	Type     string
+	ExecPath string
+}
+
+type InnerDirectorCredentials struct {
+	URL          string
+	CACert       string
+	Client       string
+	ClientSecret string
+
+	// CAPrivateKey is the key of CACert, for stand-ins like FakeUAA that
+	// need certificates the CLI trusts as much as the director's.
+	CAPrivateKey string
+}
+
+func (c InnerDirectorCredentials) env() []string {
+	env := []string{
+		"BOSH_ENVIRONMENT=" + c.URL,
+		"BOSH_CLIENT=" + c.Client,
+		"BOSH_CLIENT_SECRET=" + c.ClientSecret,
+	}
+	if c.CACert != "" {
+		env = append(env, "BOSH_CA_CERT="+c.CACert)
+	}
+	return env
+}
+
+// NewInnerDirector returns the implementation named by the inner_director
+// setting, defaulting to the scripts that deploy it with the outer director.
+func NewInnerDirector(config *Config, resources Resources, out io.Writer) (InnerDirector, error) {
+	dir := config.InnerDirectorPath(resources)
+
+	switch config.InnerDirector {
+	case "", InnerDirectorScript:
+		scriptsPath := config.InnerDirectorScriptsPath
+		if scriptsPath == "" {
+			scriptsPath = "../../../../../../../ci/docker/main-bosh-docker"
+		}
+		return &scriptInnerDirector{
+			scriptsPath:    scriptsPath,
+			releasePath:    config.BoshDirectorReleasePath,
+			boshBinaryPath: config.BoshBinaryPath,
+			dir:            dir,
+			directorIP:     resources.DirectorIP(),
+			slot:           resources.Slot,
+			out:            out,
+			startTimeout:   25 * time.Minute,
+			stopTimeout:    15 * time.Minute,
+			prepareTimeout: 5 * time.Minute,
+			collectTimeout: 5 * time.Minute,
+		}, nil
+
+	case InnerDirectorLocal:
+		srcPath := config.BoshSrcPath
+		if srcPath == "" {
+			srcPath = "../../../../../../../src"
+		}
+		srcPath, err := filepath.Abs(srcPath)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Expanding BOSH source path '%s'", config.BoshSrcPath)
+		}
+		return &localInnerDirector{
+			srcPath:        srcPath,
+			boshBinaryPath: config.BoshBinaryPath,
+			dir:            dir,
+			port:           25555 + 100*resources.Slot,
+			directorPort:   25556 + 100*resources.Slot,
+			natsPort:       4222 + 100*resources.Slot,
+			workers:        2,
+			out:            out,
+			startTimeout:   2 * time.Minute,
+		}, nil
+
+	default:
+		return nil, bosherr.Errorf("Unknown inner director '%s', expected '%s' or '%s'", config.InnerDirector, InnerDirectorScript, InnerDirectorLocal)
+	}
+}
+
+// splitInnerBoshArgs separates the ops files from the remaining CLI flags
+// callers have always passed to StartInnerBosh.
+func splitInnerBoshArgs(args []string) (opsFiles, vars []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case (arg == "-o" || arg == "--ops-file") && i+1 < len(args):
+			opsFiles = append(opsFiles, args[i+1])
+			i++
+		case strings.HasPrefix(arg, "--ops-file="):
+			opsFiles = append(opsFiles, strings.TrimPrefix(arg, "--ops-file="))
+		case strings.HasPrefix(arg, "-o") && !strings.HasPrefix(arg, "--"):
+			opsFiles = append(opsFiles, strings.TrimSpace(strings.TrimPrefix(arg, "-o")))
+		default:
+			vars = append(vars, arg)
+		}
+	}
+	return opsFiles, vars
+}
+
+func opsFileFlags(opsFiles []string) []string {
+	var flags []string
+	for _, opsFile := range opsFiles {
+		flags = append(flags, "-o", opsFile)
+	}
+	return flags
+}
+
+// writeBoshWrapper writes the `bosh` script Bosh() runs, so that each
+// implementation is targeted the same way.
+func writeBoshWrapper(path, boshBinaryPath string, env []string) error {
+	var script bytes.Buffer
+	script.WriteString("#!/bin/bash\n\n")
+	for _, variable := range env {
+		parts := strings.SplitN(variable, "=", 2)
+		fmt.Fprintf(&script, "export %s='%s'\n", parts[0], strings.Replace(parts[1], "'", `'\''`, -1))
+	}
+	fmt.Fprintf(&script, "\nexec '%s' \"$@\"\n", boshBinaryPath)
+
+	if err := ioutil.WriteFile(path, script.Bytes(), 0755); err != nil {
+		return bosherr.WrapErrorf(err, "Writing bosh wrapper '%s'", path)
+	}
+	return nil
+}
+
+// outputTail keeps the last lines of a command's output so that a failure
+// can explain itself.
+type outputTail struct {
+	lines []string
+	max   int
+	buf   bytes.Buffer
+}
+
+func (t *outputTail) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	for {
+		line, err := t.buf.ReadString('\n')
+		if err != nil {
+			t.buf.WriteString(line)
+			break
+		}
+		t.lines = append(t.lines, strings.TrimRight(line, "\n"))
+		if len(t.lines) > t.max {
+			t.lines = t.lines[1:]
+		}
+	}
+	return len(p), nil
+}
+
+func (t *outputTail) String() string {
+	return strings.Join(append(t.lines, t.buf.String()), "\n")
+}
+
+// CapturingWriter passes writes on, and keeps a copy of them while a capture
+// is running. runCommand only puts the tail of the output into its errors;
+// capturing the drivers' output gives all of it.
+type CapturingWriter struct {
+	out io.Writer
+
+	mu       sync.Mutex
+	captured *bytes.Buffer
+}
+
+func NewCapturingWriter(out io.Writer) *CapturingWriter {
+	return &CapturingWriter{out: out}
+}
+
+// Write is safe to call from a command's stdout and stderr at once.
+func (w *CapturingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	if w.captured != nil {
+		w.captured.Write(p)
+	}
+	w.mu.Unlock()
+
+	return w.out.Write(p)
+}
+
+// Capture starts keeping what is written; the returned function stops and
+// returns it.
+func (w *CapturingWriter) Capture() func() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	captured := &bytes.Buffer{}
+	w.captured = captured
+
+	return func() string {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		if w.captured == captured {
+			w.captured = nil
+		}
+		return captured.String()
+	}
+}
+
+// runCommand streams the command's output to out and kills it after the
+// timeout. Errors include the end of the output.
+func runCommand(cmd *exec.Cmd, out io.Writer, timeout time.Duration) error {
+	tail := &outputTail{max: 100}
+	cmd.Stdout = io.MultiWriter(out, tail)
+	cmd.Stderr = io.MultiWriter(out, tail)
+
+	if err := cmd.Start(); err != nil {
+		return bosherr.WrapErrorf(err, "Starting '%s'", cmd.Path)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Running '%s':\n%s", strings.Join(cmd.Args, " "), tail)
+		}
+		return nil
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		<-done
+		return bosherr.Errorf("Timed out after %s running '%s':\n%s", timeout, strings.Join(cmd.Args, " "), tail)
+	}
+}
+
+func copyFile(src, dest string) error {
+	contents, err := ioutil.ReadFile(src)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Reading '%s'", src)
+	}
+
+	if err := ioutil.WriteFile(dest, contents, 0644); err != nil {
+		return bosherr.WrapErrorf(err, "Writing '%s'", dest)
+	}
+	return nil
+}
+
+func fileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
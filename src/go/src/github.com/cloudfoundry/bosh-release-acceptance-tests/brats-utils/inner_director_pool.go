@@ -0,0 +1,329 @@
+package bratsutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// ResettableDirector is the part of the director API needed to bring a
+// reused inner director back to a clean state.
+type ResettableDirector interface {
+	TaskDirector
+	Deployments() ([]director.Deployment, error)
+	DeleteDeployment(name string, opts director.DeleteDeploymentOptions) (int, error)
+	Releases() ([]director.Release, error)
+	DeleteRelease(name, version string, force bool) (int, error)
+	Stemcells() ([]director.Stemcell, error)
+	DeleteStemcell(name, version string, force bool) (int, error)
+	Configs(filter director.ConfigsFilter) ([]director.Config, error)
+	UpdateConfig(configType, name, content string) (director.Config, error)
+	DeleteConfig(configType, name string) (bool, error)
+	OrphanedDisks() ([]director.OrphanedDisk, error)
+	DeleteOrphanedDisk(cid string) (int, error)
+	UpdateResurrection(enabled bool) error
+}
+
+// DirectorResetter brings a reused director back to how it was right after
+// it started.
+type DirectorResetter interface {
+	// Snapshot records whatever Reset restores. It runs after every start.
+	Snapshot() error
+	Reset() error
+}
+
+// InnerDirectorFingerprint identifies the configuration a director was
+// started with. Arguments that name files, like ops files or
+// --var-file=name=path, contribute their contents too, so editing a file
+// between runs is noticed.
+func InnerDirectorFingerprint(opsFiles, vars []string) (string, error) {
+	hash := sha256.New()
+
+	for _, arg := range append(append([]string{}, opsFiles...), vars...) {
+		fmt.Fprintf(hash, "arg %q\n", arg)
+
+		candidates := []string{arg}
+		if i := strings.LastIndex(arg, "="); i >= 0 {
+			candidates = append(candidates, arg[i+1:])
+		}
+		if fields := strings.Fields(arg); len(fields) == 2 {
+			candidates = append(candidates, fields[1])
+		}
+
+		for _, path := range candidates {
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", bosherr.WrapErrorf(err, "Reading '%s' for the director fingerprint", path)
+			}
+			fmt.Fprintf(hash, "file %q %x\n", path, sha256.Sum256(contents))
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// InnerDirectorPool hands out a running inner director for the ops files and
+// vars a spec asks for. A director that is already running with the same
+// fingerprint is reset through its API instead of being redeployed.
+//
+// The fingerprint lives next to the director's other state, so it is shared
+// by every process on the same parallel node and disappears with the
+// director.
+type InnerDirectorPool struct {
+	director        InnerDirector
+	fingerprintPath string
+	reset           DirectorResetter
+	out             io.Writer
+}
+
+func NewInnerDirectorPool(director InnerDirector, fingerprintPath string, reset DirectorResetter, out io.Writer) *InnerDirectorPool {
+	return &InnerDirectorPool{
+		director:        director,
+		fingerprintPath: fingerprintPath,
+		reset:           reset,
+		out:             out,
+	}
+}
+
+// Acquire returns whether the running director was reused. A director that
+// cannot be reset is redeployed rather than failing the spec.
+func (p *InnerDirectorPool) Acquire(opsFiles, vars []string) (bool, error) {
+	fingerprint, err := InnerDirectorFingerprint(opsFiles, vars)
+	if err != nil {
+		return false, err
+	}
+
+	existed := p.director.Exists()
+
+	if existed && p.Fingerprint() == fingerprint {
+		err := p.reset.Reset()
+		if err == nil {
+			return true, nil
+		}
+		fmt.Fprintf(p.out, "Redeploying the inner director, resetting it failed: %s\n", err)
+	}
+
+	// Forget the old configuration first so that a failed start is never
+	// mistaken for a usable director.
+	if err := p.Invalidate(); err != nil {
+		return false, err
+	}
+
+	if err := p.director.Start(opsFiles, vars); err != nil {
+		return false, err
+	}
+
+	if err := p.reset.Snapshot(); err != nil {
+		return false, bosherr.WrapError(err, "Snapshotting the started director")
+	}
+
+	// Updating a running director keeps its database.
+	if existed {
+		if err := p.reset.Reset(); err != nil {
+			return false, bosherr.WrapError(err, "Resetting the redeployed director")
+		}
+	}
+
+	if err := ioutil.WriteFile(p.fingerprintPath, []byte(fingerprint), 0644); err != nil {
+		return false, bosherr.WrapErrorf(err, "Writing director fingerprint '%s'", p.fingerprintPath)
+	}
+	return false, nil
+}
+
+// Fingerprint is that of the running director, or empty if it is unknown.
+func (p *InnerDirectorPool) Fingerprint() string {
+	contents, err := ioutil.ReadFile(p.fingerprintPath)
+	if err != nil {
+		return ""
+	}
+	return string(contents)
+}
+
+// Invalidate makes the next Acquire redeploy, for when a spec changes the
+// director behind the pool's back.
+func (p *InnerDirectorPool) Invalidate() error {
+	if err := os.Remove(p.fingerprintPath); err != nil && !os.IsNotExist(err) {
+		return bosherr.WrapErrorf(err, "Removing director fingerprint '%s'", p.fingerprintPath)
+	}
+	return nil
+}
+
+// DirectorReset deletes everything specs leave behind on a director:
+// deployments, releases, stemcells, configs and orphaned disks. The default
+// cloud config, which starting the director sets, goes back to its snapshot
+// and resurrection is turned back on.
+type DirectorReset struct {
+	Director    ResettableDirector
+	Tracker     *TaskTracker
+	TaskTimeout time.Duration
+
+	// CloudConfigPath holds the snapshot of the default cloud config.
+	CloudConfigPath string
+}
+
+func (r DirectorReset) Snapshot() error {
+	config, err := r.defaultCloudConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(r.CloudConfigPath, []byte(config.Content), 0644); err != nil {
+		return bosherr.WrapErrorf(err, "Writing cloud config snapshot '%s'", r.CloudConfigPath)
+	}
+	return nil
+}
+
+func (r DirectorReset) Reset() error {
+	steps := []struct {
+		description string
+		run         func() error
+	}{
+		{"deleting deployments", r.deleteDeployments},
+		{"deleting releases", r.deleteReleases},
+		{"deleting stemcells", r.deleteStemcells},
+		{"deleting configs", r.deleteConfigs},
+		{"restoring the default cloud config", r.restoreCloudConfig},
+		{"turning resurrection on", func() error { return r.Director.UpdateResurrection(true) }},
+		{"deleting orphaned disks", r.deleteOrphanedDisks},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			return bosherr.WrapErrorf(err, "Resetting director: %s", step.description)
+		}
+	}
+	return nil
+}
+
+func (r DirectorReset) deleteDeployments() error {
+	deployments, err := r.Director.Deployments()
+	if err != nil {
+		return err
+	}
+
+	for _, deployment := range deployments {
+		if err := r.follow(r.Director.DeleteDeployment(deployment.Name, director.DeleteDeploymentOptions{Force: true})); err != nil {
+			return bosherr.WrapErrorf(err, "Deleting deployment '%s'", deployment.Name)
+		}
+	}
+	return nil
+}
+
+func (r DirectorReset) deleteReleases() error {
+	releases, err := r.Director.Releases()
+	if err != nil {
+		return err
+	}
+
+	for _, release := range releases {
+		if err := r.follow(r.Director.DeleteRelease(release.Name, "", true)); err != nil {
+			return bosherr.WrapErrorf(err, "Deleting release '%s'", release.Name)
+		}
+	}
+	return nil
+}
+
+func (r DirectorReset) deleteStemcells() error {
+	stemcells, err := r.Director.Stemcells()
+	if err != nil {
+		return err
+	}
+
+	for _, stemcell := range stemcells {
+		if err := r.follow(r.Director.DeleteStemcell(stemcell.Name, stemcell.Version, true)); err != nil {
+			return bosherr.WrapErrorf(err, "Deleting stemcell '%s/%s'", stemcell.Name, stemcell.Version)
+		}
+	}
+	return nil
+}
+
+func (r DirectorReset) deleteConfigs() error {
+	configs, err := r.Director.Configs(director.ConfigsFilter{})
+	if err != nil {
+		return err
+	}
+
+	for _, config := range configs {
+		if config.Type == "cloud" && config.Name == "default" {
+			continue
+		}
+		if _, err := r.Director.DeleteConfig(config.Type, config.Name); err != nil {
+			return bosherr.WrapErrorf(err, "Deleting %s config '%s'", config.Type, config.Name)
+		}
+	}
+	return nil
+}
+
+func (r DirectorReset) restoreCloudConfig() error {
+	snapshot, err := ioutil.ReadFile(r.CloudConfigPath)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Reading cloud config snapshot '%s'", r.CloudConfigPath)
+	}
+
+	current, err := r.defaultCloudConfig()
+	if err != nil {
+		return err
+	}
+	if current.Content == string(snapshot) {
+		return nil
+	}
+
+	_, err = r.Director.UpdateConfig("cloud", "default", string(snapshot))
+	return err
+}
+
+func (r DirectorReset) defaultCloudConfig() (director.Config, error) {
+	configs, err := r.Director.Configs(director.ConfigsFilter{Type: "cloud", Name: "default"})
+	if err != nil {
+		return director.Config{}, err
+	}
+	if len(configs) != 1 {
+		return director.Config{}, bosherr.Errorf("Expected one default cloud config, found %d", len(configs))
+	}
+	return configs[0], nil
+}
+
+// deleteOrphanedDisks runs last because deleting deployments orphans their
+// persistent disks.
+func (r DirectorReset) deleteOrphanedDisks() error {
+	disks, err := r.Director.OrphanedDisks()
+	if err != nil {
+		return err
+	}
+
+	for _, disk := range disks {
+		if err := r.follow(r.Director.DeleteOrphanedDisk(disk.DiskCID)); err != nil {
+			return bosherr.WrapErrorf(err, "Deleting orphaned disk '%s'", disk.DiskCID)
+		}
+	}
+	return nil
+}
+
+func (r DirectorReset) follow(taskID int, err error) error {
+	if err != nil {
+		return err
+	}
+
+	result, err := r.Tracker.Follow(taskID, r.TaskTimeout)
+	if err != nil {
+		return err
+	}
+
+	if !result.Succeeded() {
+		return bosherr.Error(result.String())
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package bratsutils_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	"github.com/onsi/gomega/gbytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakePooledDirector struct {
+	bratsutils.InnerDirector
+
+	running  bool
+	starts   [][]string
+	startErr error
+}
+
+func (f *fakePooledDirector) Start(opsFiles, vars []string) error {
+	f.starts = append(f.starts, append(append([]string{}, opsFiles...), vars...))
+	if f.startErr != nil {
+		return f.startErr
+	}
+	f.running = true
+	return nil
+}
+
+func (f *fakePooledDirector) Exists() bool {
+	return f.running
+}
+
+type fakeDirectorResetter struct {
+	snapshots int
+	resets    int
+	resetErr  error
+}
+
+func (f *fakeDirectorResetter) Snapshot() error {
+	f.snapshots++
+	return nil
+}
+
+func (f *fakeDirectorResetter) Reset() error {
+	f.resets++
+	return f.resetErr
+}
+
+type fakeResettableDirector struct {
+	*fakeTaskDirector
+
+	deployments []director.Deployment
+	releases    []director.Release
+	stemcells   []director.Stemcell
+	configs     []director.Config
+	disks       []director.OrphanedDisk
+	deleted     []string
+	updated     []director.Config
+	resurrected bool
+}
+
+func (f *fakeResettableDirector) Deployments() ([]director.Deployment, error) {
+	return f.deployments, nil
+}
+
+func (f *fakeResettableDirector) DeleteDeployment(name string, opts director.DeleteDeploymentOptions) (int, error) {
+	Expect(opts.Force).To(BeTrue())
+	f.deleted = append(f.deleted, "deployment "+name)
+	return 1, nil
+}
+
+func (f *fakeResettableDirector) Releases() ([]director.Release, error) {
+	return f.releases, nil
+}
+
+func (f *fakeResettableDirector) DeleteRelease(name, version string, force bool) (int, error) {
+	f.deleted = append(f.deleted, "release "+name)
+	return 1, nil
+}
+
+func (f *fakeResettableDirector) Stemcells() ([]director.Stemcell, error) {
+	return f.stemcells, nil
+}
+
+func (f *fakeResettableDirector) DeleteStemcell(name, version string, force bool) (int, error) {
+	f.deleted = append(f.deleted, "stemcell "+name+"/"+version)
+	return 1, nil
+}
+
+func (f *fakeResettableDirector) Configs(filter director.ConfigsFilter) ([]director.Config, error) {
+	var configs []director.Config
+	for _, config := range f.configs {
+		if (filter.Type == "" || filter.Type == config.Type) && (filter.Name == "" || filter.Name == config.Name) {
+			configs = append(configs, config)
+		}
+	}
+	return configs, nil
+}
+
+func (f *fakeResettableDirector) UpdateConfig(configType, name, content string) (director.Config, error) {
+	config := director.Config{Type: configType, Name: name, Content: content}
+	f.updated = append(f.updated, config)
+	return config, nil
+}
+
+func (f *fakeResettableDirector) DeleteConfig(configType, name string) (bool, error) {
+	f.deleted = append(f.deleted, configType+" config "+name)
+	return true, nil
+}
+
+func (f *fakeResettableDirector) OrphanedDisks() ([]director.OrphanedDisk, error) {
+	return f.disks, nil
+}
+
+func (f *fakeResettableDirector) DeleteOrphanedDisk(cid string) (int, error) {
+	f.deleted = append(f.deleted, "disk "+cid)
+	return 1, nil
+}
+
+func (f *fakeResettableDirector) UpdateResurrection(enabled bool) error {
+	f.resurrected = enabled
+	return nil
+}
+
+var _ = Describe("InnerDirectorPool", func() {
+	var (
+		dir     string
+		opsFile string
+		inner   *fakePooledDirector
+		reset   *fakeDirectorResetter
+		out     *gbytes.Buffer
+		pool    *bratsutils.InnerDirectorPool
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "pool")
+		Expect(err).ToNot(HaveOccurred())
+
+		opsFile = filepath.Join(dir, "ops.yml")
+		Expect(ioutil.WriteFile(opsFile, []byte("[]"), 0644)).To(Succeed())
+
+		inner = &fakePooledDirector{}
+		reset = &fakeDirectorResetter{}
+		out = gbytes.NewBuffer()
+
+		pool = bratsutils.NewInnerDirectorPool(inner, filepath.Join(dir, "fingerprint"), reset, out)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("deploys a director that is not running", func() {
+		reused, err := pool.Acquire([]string{opsFile}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(BeFalse())
+		Expect(inner.starts).To(HaveLen(1))
+		Expect(reset.snapshots).To(Equal(1))
+		Expect(reset.resets).To(Equal(0))
+		Expect(pool.Fingerprint()).ToNot(BeEmpty())
+	})
+
+	It("resets instead of redeploying when the configuration is unchanged", func() {
+		_, err := pool.Acquire([]string{opsFile}, []string{"-v a=b"})
+		Expect(err).ToNot(HaveOccurred())
+
+		reused, err := pool.Acquire([]string{opsFile}, []string{"-v a=b"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(BeTrue())
+		Expect(inner.starts).To(HaveLen(1))
+		Expect(reset.snapshots).To(Equal(1))
+		Expect(reset.resets).To(Equal(1))
+	})
+
+	It("redeploys and resets when the vars differ", func() {
+		_, err := pool.Acquire([]string{opsFile}, []string{"-v a=b"})
+		Expect(err).ToNot(HaveOccurred())
+
+		reused, err := pool.Acquire([]string{opsFile}, []string{"-v a=c"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(BeFalse())
+		Expect(inner.starts).To(HaveLen(2))
+		Expect(reset.snapshots).To(Equal(2))
+		Expect(reset.resets).To(Equal(1))
+	})
+
+	It("redeploys when an ops file was edited", func() {
+		_, err := pool.Acquire([]string{opsFile}, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(ioutil.WriteFile(opsFile, []byte("- {type: remove, path: /x}"), 0644)).To(Succeed())
+
+		reused, err := pool.Acquire([]string{opsFile}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(BeFalse())
+		Expect(inner.starts).To(HaveLen(2))
+	})
+
+	It("redeploys when the reset fails", func() {
+		_, err := pool.Acquire(nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		reset.resetErr = errors.New("director unreachable")
+		_, err = pool.Acquire(nil, nil)
+		Expect(err).To(MatchError(ContainSubstring("Resetting the redeployed director")))
+		Expect(inner.starts).To(HaveLen(2))
+		Expect(out).To(gbytes.Say("resetting it failed: director unreachable"))
+	})
+
+	It("forgets the configuration when a start fails", func() {
+		_, err := pool.Acquire(nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		inner.startErr = errors.New("deploy failed")
+		_, err = pool.Acquire([]string{opsFile}, nil)
+		Expect(err).To(MatchError("deploy failed"))
+		Expect(pool.Fingerprint()).To(BeEmpty())
+
+		inner.startErr = nil
+		reused, err := pool.Acquire([]string{opsFile}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(BeFalse())
+	})
+
+	It("redeploys after being invalidated", func() {
+		_, err := pool.Acquire(nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pool.Invalidate()).To(Succeed())
+
+		reused, err := pool.Acquire(nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reused).To(BeFalse())
+	})
+})
+
+var _ = Describe("DirectorReset", func() {
+	var (
+		fake          *fakeResettableDirector
+		dir           string
+		directorReset bratsutils.DirectorReset
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "director-reset")
+		Expect(err).ToNot(HaveOccurred())
+
+		tasks := &fakeTaskDirector{polls: []taskPoll{{task: director.Task{ID: 1, State: "done"}}}}
+		fake = &fakeResettableDirector{
+			fakeTaskDirector: tasks,
+			deployments:      []director.Deployment{{Name: "dns"}},
+			releases:         []director.Release{{Name: "syslog"}},
+			stemcells:        []director.Stemcell{{Name: "bosh-warden", Version: "1"}},
+			configs: []director.Config{
+				{Type: "cloud", Name: "default", Content: "azs: [{name: z1}]"},
+				{Type: "runtime", Name: "dns"},
+				{Type: "cpi", Name: "default"},
+			},
+			disks: []director.OrphanedDisk{{DiskCID: "disk-1"}},
+		}
+
+		directorReset = bratsutils.DirectorReset{
+			Director:        fake,
+			Tracker:         bratsutils.NewTaskTracker(fake, gbytes.NewBuffer(), time.Millisecond),
+			TaskTimeout:     time.Minute,
+			CloudConfigPath: filepath.Join(dir, "cloud-config.yml"),
+		}
+		Expect(directorReset.Snapshot()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("deletes everything but the default cloud config", func() {
+		Expect(directorReset.Reset()).To(Succeed())
+		Expect(fake.deleted).To(Equal([]string{
+			"deployment dns",
+			"release syslog",
+			"stemcell bosh-warden/1",
+			"runtime config dns",
+			"cpi config default",
+			"disk disk-1",
+		}))
+		Expect(fake.updated).To(BeEmpty())
+	})
+
+	It("restores the default cloud config from the snapshot", func() {
+		fake.configs[0].Content = "azs: [{name: z1, cpi: other}]"
+
+		Expect(directorReset.Reset()).To(Succeed())
+		Expect(fake.updated).To(Equal([]director.Config{
+			{Type: "cloud", Name: "default", Content: "azs: [{name: z1}]"},
+		}))
+	})
+
+	It("fails without a snapshot", func() {
+		Expect(os.Remove(directorReset.CloudConfigPath)).To(Succeed())
+
+		err := directorReset.Reset()
+		Expect(err).To(MatchError(ContainSubstring("Resetting director: restoring the default cloud config")))
+	})
+
+	It("turns resurrection back on", func() {
+		Expect(directorReset.Reset()).To(Succeed())
+		Expect(fake.resurrected).To(BeTrue())
+	})
+
+	It("fails when a deletion task fails", func() {
+		fake.polls = []taskPoll{{task: director.Task{ID: 1, State: "error", Result: "deployment is locked"}}}
+
+		err := directorReset.Reset()
+		Expect(err).To(MatchError(ContainSubstring("Resetting director: deleting deployments")))
+		Expect(err).To(MatchError(ContainSubstring("deployment is locked")))
+	})
+})
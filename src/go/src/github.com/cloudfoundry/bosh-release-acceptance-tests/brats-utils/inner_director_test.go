@@ -0,0 +1,332 @@
+package bratsutils_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/onsi/gomega/gbytes"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InnerDirector", func() {
+	const node = 97
+
+	var (
+		scriptsPath string
+		root        string
+		innerDir    string
+		out         *gbytes.Buffer
+		driver      bratsutils.InnerDirector
+	)
+
+	writeExecutable := func(path, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		err := ioutil.WriteFile(path, []byte("#!/bin/bash\n"+contents), 0755)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	writeScript := func(name, contents string) {
+		writeExecutable(filepath.Join(scriptsPath, name), contents)
+	}
+
+	BeforeEach(func() {
+		var err error
+		scriptsPath, err = ioutil.TempDir("", "inner-director-scripts")
+		Expect(err).ToNot(HaveOccurred())
+
+		root, err = ioutil.TempDir("", "inner-director-root")
+		Expect(err).ToNot(HaveOccurred())
+		innerDir = filepath.Join(root, "97")
+		out = gbytes.NewBuffer()
+
+		driver, err = bratsutils.NewInnerDirector(&bratsutils.Config{
+			InnerDirectorScriptsPath: scriptsPath,
+			InnerDirectorRoot:        root,
+		}, bratsutils.Resources{Slot: node}, out)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(scriptsPath)
+		os.RemoveAll(root)
+	})
+
+	It("rejects unknown implementations", func() {
+		_, err := bratsutils.NewInnerDirector(&bratsutils.Config{InnerDirector: "docker"}, bratsutils.Resources{Slot: node}, out)
+		Expect(err).To(MatchError(ContainSubstring("Unknown inner director 'docker'")))
+	})
+
+	Describe("the script implementation", func() {
+		BeforeEach(func() {
+			writeScript("start-inner-bosh-parallel.sh", `
+echo "starting $@"
+mkdir -p $inner_bosh_root/$1
+cat > $inner_bosh_root/$1/creds.yml <<EOF
+admin_password: secret
+director_ssl:
+  ca: a-ca
+default_ca:
+  certificate: a-ca
+  private_key: a-ca-key
+EOF
+touch $inner_bosh_root/$1/bosh
+`)
+			writeScript("destroy-inner-bosh.sh", `rm -rf $inner_bosh_root/$1`)
+		})
+
+		It("passes the node, ops files and vars to the start script", func() {
+			Expect(driver.Exists()).To(BeFalse())
+
+			err := driver.Start([]string{"/ops.yml"}, []string{"-v", "name=value"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(out).To(gbytes.Say("starting 97 -o /ops.yml -v name=value"))
+			Expect(driver.Exists()).To(BeTrue())
+			Expect(filepath.Join(innerDir, "creds.yml")).To(BeAnExistingFile())
+
+			Expect(driver.Stop()).To(Succeed())
+			Expect(driver.Exists()).To(BeFalse())
+		})
+
+		It("refers to the docker CPI colocated with the director", func() {
+			Expect(driver.CPI()).To(Equal(bratsutils.InnerDirectorCPI{
+				Type:     "docker",
+				ExecPath: "/var/vcap/jobs/docker_cpi/bin/cpi",
+			}))
+		})
+
+		It("reads the credentials from the vars store", func() {
+			Expect(driver.Start(nil, nil)).To(Succeed())
+
+			creds, err := driver.Credentials()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds).To(Equal(bratsutils.InnerDirectorCredentials{
+				URL:          "https://10.245.0.107:25555",
+				CACert:       "a-ca",
+				Client:       "admin",
+				ClientSecret: "secret",
+				CAPrivateKey: "a-ca-key",
+			}))
+
+			env, err := driver.Env()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(env).To(ContainElement("BOSH_CLIENT_SECRET=secret"))
+		})
+
+		It("includes the script output when it fails", func() {
+			writeScript("start-inner-bosh-parallel.sh", `
+echo "Error: 'bosh/0' is not running after update"
+exit 1
+`)
+
+			err := driver.Start(nil, nil)
+			Expect(err).To(MatchError(MatchRegexp(`Error: 'bosh/\d' is not running after update`)))
+		})
+
+		It("leaves all of a failed start's output to a capturing writer", func() {
+			capturing := bratsutils.NewCapturingWriter(out)
+			driver, err := bratsutils.NewInnerDirector(&bratsutils.Config{
+				InnerDirectorScriptsPath: scriptsPath,
+				InnerDirectorRoot:        root,
+			}, bratsutils.Resources{Slot: node}, capturing)
+			Expect(err).ToNot(HaveOccurred())
+
+			writeScript("start-inner-bosh-parallel.sh", `
+echo "Error: 'bosh/0' is not running after update"
+for i in $(seq 200); do echo "cleaning up $i"; done
+exit 1
+`)
+
+			stopCapture := capturing.Capture()
+			err = driver.Start(nil, nil)
+			output := stopCapture()
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).ToNot(ContainSubstring("is not running after update"))
+			Expect(output).To(ContainSubstring("Error: 'bosh/0' is not running after update"))
+			Expect(output).To(ContainSubstring("cleaning up 200"))
+			Expect(out).To(gbytes.Say("is not running after update"))
+
+			Expect(capturing.Capture()()).To(BeEmpty())
+		})
+
+		It("passes the release path to the prepare script", func() {
+			driver, err := bratsutils.NewInnerDirector(&bratsutils.Config{
+				InnerDirectorScriptsPath: scriptsPath,
+				BoshDirectorReleasePath:  "/tmp/bosh-release",
+				InnerDirectorRoot:        root,
+			}, bratsutils.Resources{Slot: node}, out)
+			Expect(err).ToNot(HaveOccurred())
+
+			writeScript("create-and-upload-release.sh", `echo "uploading ${bosh_release_path} for node $1"`)
+
+			Expect(driver.Prepare()).To(Succeed())
+			Expect(out).To(gbytes.Say("uploading /tmp/bosh-release for node 97"))
+		})
+	})
+
+	Describe("the local implementation", func() {
+		var (
+			srcPath  string
+			binPath  string
+			origPath string
+
+			natsListener     net.Listener
+			directorListener net.Listener
+		)
+
+		readCertificate := func(name string) *x509.Certificate {
+			contents, err := ioutil.ReadFile(filepath.Join(innerDir, "nats", name))
+			Expect(err).ToNot(HaveOccurred())
+			block, _ := pem.Decode(contents)
+			Expect(block).ToNot(BeNil())
+			cert, err := x509.ParseCertificate(block.Bytes)
+			Expect(err).ToNot(HaveOccurred())
+			return cert
+		}
+
+		BeforeEach(func() {
+			var err error
+			srcPath, err = ioutil.TempDir("", "inner-director-src")
+			Expect(err).ToNot(HaveOccurred())
+			binPath, err = ioutil.TempDir("", "inner-director-bin")
+			Expect(err).ToNot(HaveOccurred())
+
+			// bundle runs the fakes, which stay up until Stop.
+			writeExecutable(filepath.Join(binPath, "bundle"), `shift; exec "$@"`)
+			writeExecutable(filepath.Join(binPath, "bosh-director"), `exec sleep 600`)
+			writeExecutable(filepath.Join(binPath, "bosh-director-worker"), `exec sleep 600`)
+			writeExecutable(filepath.Join(binPath, "bosh"), `[ "$1" == int ] && cat "$2"`)
+			writeExecutable(filepath.Join(srcPath, "bosh-director", "bin", "bosh-director-migrate"), `exit 0`)
+			writeExecutable(filepath.Join(srcPath, "tmp", "gnatsd", "gnatsd"), `echo "$@"; exec sleep 600`)
+			writeExecutable(filepath.Join(srcPath, "tmp", "verify-multidigest", "verify-multidigest"), `exit 0`)
+
+			origPath = os.Getenv("PATH")
+			os.Setenv("PATH", binPath+":"+origPath)
+
+			// Stand-ins for what gnatsd and the director listen on.
+			natsListener, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", 4222+100*node))
+			Expect(err).ToNot(HaveOccurred())
+
+			directorListener, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", 25556+100*node))
+			Expect(err).ToNot(HaveOccurred())
+			go http.Serve(directorListener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"name":"local-inner"}`)
+			}))
+
+			driver, err = bratsutils.NewInnerDirector(&bratsutils.Config{
+				InnerDirector:     bratsutils.InnerDirectorLocal,
+				BoshSrcPath:       srcPath,
+				BoshBinaryPath:    filepath.Join(binPath, "bosh"),
+				InnerDirectorRoot: root,
+			}, bratsutils.Resources{Slot: node}, out)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			if driver.Exists() {
+				driver.Stop()
+			}
+			natsListener.Close()
+			directorListener.Close()
+			os.Setenv("PATH", origPath)
+			os.RemoveAll(srcPath)
+			os.RemoveAll(binPath)
+		})
+
+		It("needs the binaries the integration sandbox installs", func() {
+			Expect(driver.Prepare()).To(Succeed())
+
+			Expect(os.Remove(filepath.Join(srcPath, "tmp", "gnatsd", "gnatsd"))).To(Succeed())
+			Expect(driver.Prepare()).To(MatchError(ContainSubstring("rake spec:integration:install_dependencies")))
+		})
+
+		It("starts gnatsd with certificates the director config refers to", func() {
+			Expect(driver.Start(nil, nil)).To(Succeed())
+			Expect(driver.Exists()).To(BeTrue())
+
+			Expect(ioutil.ReadFile(filepath.Join(innerDir, "nats.log"))).To(ContainSubstring("-c " + filepath.Join(innerDir, "nats", "nats.conf")))
+			natsConfig, err := ioutil.ReadFile(filepath.Join(innerDir, "nats", "nats.conf"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(natsConfig)).To(ContainSubstring(fmt.Sprintf("listen: 127.0.0.1:%d", 4222+100*node)))
+
+			contents, err := ioutil.ReadFile(filepath.Join(innerDir, "bosh-director.yml"))
+			Expect(err).ToNot(HaveOccurred())
+			var config struct {
+				Mbus string            `yaml:"mbus"`
+				NATS map[string]string `yaml:"nats"`
+			}
+			Expect(yaml.Unmarshal(contents, &config)).To(Succeed())
+			Expect(config.Mbus).To(Equal(fmt.Sprintf("nats://127.0.0.1:%d", 4222+100*node)))
+			Expect(config.NATS).To(HaveLen(5))
+			for _, path := range config.NATS {
+				Expect(path).To(BeAnExistingFile())
+			}
+
+			ca := readCertificate("ca.pem")
+			roots := x509.NewCertPool()
+			roots.AddCert(ca)
+
+			server := readCertificate("server.pem")
+			_, err = server.Verify(x509.VerifyOptions{Roots: roots, DNSName: "127.0.0.1", KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+			Expect(err).ToNot(HaveOccurred())
+
+			client := readCertificate("director.pem")
+			Expect(client.Subject.CommonName).To(Equal("default.director.bosh-internal"))
+			_, err = client.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+			Expect(err).ToNot(HaveOccurred())
+
+			// The director signs agent certificates with the CA key, which it
+			// only reads as RSA.
+			caKey, err := ioutil.ReadFile(config.NATS["client_ca_private_key_path"])
+			Expect(err).ToNot(HaveOccurred())
+			block, _ := pem.Decode(caKey)
+			Expect(block).ToNot(BeNil())
+			_, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(driver.Stop()).To(Succeed())
+			Expect(driver.Exists()).To(BeFalse())
+			Expect(innerDir).ToNot(BeADirectory())
+		})
+
+		It("serves the director over TLS to the CLI", func() {
+			Expect(driver.Start(nil, nil)).To(Succeed())
+
+			creds, err := driver.Credentials()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creds.URL).To(Equal(fmt.Sprintf("https://127.0.0.1:%d", 25555+100*node)))
+			Expect(creds.Client).To(Equal("admin"))
+
+			roots := x509.NewCertPool()
+			Expect(roots.AppendCertsFromPEM([]byte(creds.CACert))).To(BeTrue())
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+			resp, err := client.Get(creds.URL + "/info")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(ioutil.ReadAll(resp.Body)).To(ContainSubstring("local-inner"))
+		})
+
+		It("refers to the dummy CPI wrapper it writes", func() {
+			Expect(driver.CPI()).To(Equal(bratsutils.InnerDirectorCPI{
+				Type:     "dummy",
+				ExecPath: filepath.Join(innerDir, "cpi"),
+			}))
+
+			Expect(driver.Start(nil, nil)).To(Succeed())
+			Expect(driver.CPI().ExecPath).To(BeAnExistingFile())
+		})
+	})
+})
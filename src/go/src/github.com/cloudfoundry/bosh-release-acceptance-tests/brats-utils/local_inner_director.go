@@ -0,0 +1,732 @@
+package bratsutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// localInnerDirector runs the director from the Ruby sources on this machine,
+// the way the integration sandbox in bosh-dev does: bosh-director, a few
+// bosh-director-worker processes and dummy_cpi as the CPI, backed by SQLite
+// and a local blobstore, with gnatsd as the message bus. It needs neither
+// Docker nor an outer director, only the binaries
+// `rake spec:integration:install_dependencies` puts under the sources' tmp.
+//
+// The director only listens on plain HTTP, so Start also serves it over TLS
+// with a self-signed certificate for the CLI. That proxy lives in the process
+// that called Start.
+//
+// Ops files and vars are applied to the generated director config rather
+// than to a bosh-deployment manifest.
+type localInnerDirector struct {
+	srcPath        string
+	boshBinaryPath string
+	dir            string
+	port           int
+	directorPort   int
+	natsPort       int
+	workers        int
+	out            io.Writer
+	startTimeout   time.Duration
+
+	proxy *http.Server
+}
+
+type localCreds struct {
+	AdminPassword string `yaml:"admin_password"`
+	DirectorSSL   struct {
+		CA          string `yaml:"ca"`
+		Certificate string `yaml:"certificate"`
+		PrivateKey  string `yaml:"private_key"`
+	} `yaml:"director_ssl"`
+}
+
+func (d *localInnerDirector) Prepare() error {
+	if _, err := exec.LookPath("bundle"); err != nil {
+		return bosherr.WrapError(err, "Finding bundler to run the director")
+	}
+
+	for _, path := range []string{d.gnatsdPath(), d.verifyMultidigestPath()} {
+		if exists, _ := fileExists(path); !exists {
+			return bosherr.Errorf("Finding '%s', install it with `rake spec:integration:install_dependencies`", path)
+		}
+	}
+	return nil
+}
+
+func (d *localInnerDirector) Start(opsFiles, vars []string) error {
+	// There is no in-place update like `bosh deploy` gives the script driver,
+	// so a new configuration means new processes.
+	if d.Exists() {
+		if err := d.Stop(); err != nil {
+			return bosherr.WrapError(err, "Stopping the running director")
+		}
+	}
+
+	for _, subdir := range []string{"boshdir", "blobstore", "cloud", "nats", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(d.dir, subdir), 0755); err != nil {
+			return bosherr.WrapErrorf(err, "Creating '%s'", subdir)
+		}
+	}
+
+	creds, err := d.generateCreds()
+	if err != nil {
+		return err
+	}
+
+	if err := d.generateNATSCerts(); err != nil {
+		return err
+	}
+
+	if err := d.startNATS(); err != nil {
+		return err
+	}
+
+	if err := d.writeCPI(); err != nil {
+		return err
+	}
+
+	if err := d.writeDirectorConfig(creds, opsFiles, vars); err != nil {
+		return err
+	}
+
+	migrate := d.bundleCommand("bin/bosh-director-migrate", "-c", d.configPath())
+	if err := runCommand(migrate, d.out, d.startTimeout); err != nil {
+		return bosherr.WrapError(err, "Migrating the director database")
+	}
+
+	if err := d.startProcess("director", d.bundleCommand("bosh-director", "-c", d.configPath())); err != nil {
+		return err
+	}
+	for i := 0; i < d.workers; i++ {
+		worker := d.bundleCommand("bosh-director-worker", "-c", d.configPath(), "-i", strconv.Itoa(i))
+		worker.Env = append(worker.Env, "QUEUE=normal,urgent")
+		if err := d.startProcess(fmt.Sprintf("worker_%d", i), worker); err != nil {
+			return err
+		}
+	}
+
+	if err := d.startProxy(creds); err != nil {
+		return err
+	}
+
+	if err := d.waitForDirector(); err != nil {
+		return err
+	}
+
+	env, err := d.Env()
+	if err != nil {
+		return err
+	}
+	return writeBoshWrapper(filepath.Join(d.dir, "bosh"), d.boshBinaryPath, env)
+}
+
+func (d *localInnerDirector) Stop() error {
+	if d.proxy != nil {
+		d.proxy.Close()
+		d.proxy = nil
+	}
+
+	pidFiles, err := filepath.Glob(filepath.Join(d.dir, "*.pid"))
+	if err != nil {
+		return bosherr.WrapError(err, "Finding director processes")
+	}
+
+	for _, pidFile := range pidFiles {
+		if err := stopProcessGroup(pidFile); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(d.dir); err != nil {
+		return bosherr.WrapErrorf(err, "Removing '%s'", d.dir)
+	}
+	return nil
+}
+
+func (d *localInnerDirector) HostAddress() string {
+	return "127.0.0.1"
+}
+
+// CPI is the dummy CPI wrapper writeCPI writes.
+func (d *localInnerDirector) CPI() InnerDirectorCPI {
+	return InnerDirectorCPI{Type: "dummy", ExecPath: filepath.Join(d.dir, "cpi")}
+}
+
+func (d *localInnerDirector) Exists() bool {
+	exists, _ := fileExists(filepath.Join(d.dir, "bosh"))
+	return exists
+}
+
+func (d *localInnerDirector) Env() ([]string, error) {
+	creds, err := d.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	return creds.env(), nil
+}
+
+func (d *localInnerDirector) Credentials() (InnerDirectorCredentials, error) {
+	creds, err := d.readCreds()
+	if err != nil {
+		return InnerDirectorCredentials{}, err
+	}
+
+	return InnerDirectorCredentials{
+		URL:          fmt.Sprintf("https://127.0.0.1:%d", d.port),
+		CACert:       creds.DirectorSSL.CA,
+		Client:       "admin",
+		ClientSecret: creds.AdminPassword,
+		// The certificate is its own CA.
+		CAPrivateKey: creds.DirectorSSL.PrivateKey,
+	}, nil
+}
+
+// CollectLogs copies the process logs, which are all there is of
+// innerDirectorLogDirs when running locally.
+func (d *localInnerDirector) CollectLogs(dest string) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return bosherr.WrapErrorf(err, "Creating '%s'", dest)
+	}
+
+	logs, err := filepath.Glob(filepath.Join(d.dir, "*.log"))
+	if err != nil {
+		return bosherr.WrapError(err, "Finding director logs")
+	}
+
+	for _, path := range append(logs, d.configPath()) {
+		if err := copyFile(path, filepath.Join(dest, filepath.Base(path))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *localInnerDirector) configPath() string {
+	return filepath.Join(d.dir, "bosh-director.yml")
+}
+
+func (d *localInnerDirector) natsPath(name string) string {
+	return filepath.Join(d.dir, "nats", name)
+}
+
+func (d *localInnerDirector) natsURL() string {
+	return fmt.Sprintf("nats://127.0.0.1:%d", d.natsPort)
+}
+
+func (d *localInnerDirector) gnatsdPath() string {
+	return filepath.Join(d.srcPath, "tmp", "gnatsd", "gnatsd")
+}
+
+func (d *localInnerDirector) verifyMultidigestPath() string {
+	return filepath.Join(d.srcPath, "tmp", "verify-multidigest", "verify-multidigest")
+}
+
+// generateCreds writes a vars store shaped like the one bosh-deployment
+// produces, so everything reading creds.yml works against either director.
+func (d *localInnerDirector) generateCreds() (localCreds, error) {
+	var creds localCreds
+
+	password := make([]byte, 16)
+	if _, err := rand.Read(password); err != nil {
+		return creds, bosherr.WrapError(err, "Generating admin password")
+	}
+	creds.AdminPassword = hex.EncodeToString(password)
+
+	cert, key, err := selfSignedCertificate("127.0.0.1")
+	if err != nil {
+		return creds, err
+	}
+	creds.DirectorSSL.CA = cert
+	creds.DirectorSSL.Certificate = cert
+	creds.DirectorSSL.PrivateKey = key
+
+	contents, err := yaml.Marshal(creds)
+	if err != nil {
+		return creds, bosherr.WrapError(err, "Marshaling director credentials")
+	}
+	if err := ioutil.WriteFile(filepath.Join(d.dir, "creds.yml"), contents, 0600); err != nil {
+		return creds, bosherr.WrapError(err, "Writing director credentials")
+	}
+	if err := ioutil.WriteFile(filepath.Join(d.dir, "ca.crt"), []byte(cert), 0644); err != nil {
+		return creds, bosherr.WrapError(err, "Writing director CA certificate")
+	}
+
+	return creds, nil
+}
+
+func (d *localInnerDirector) readCreds() (localCreds, error) {
+	var creds localCreds
+	path := filepath.Join(d.dir, "creds.yml")
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return creds, bosherr.WrapErrorf(err, "Reading inner director vars store '%s'", path)
+	}
+	if err := yaml.Unmarshal(contents, &creds); err != nil {
+		return creds, bosherr.WrapErrorf(err, "Parsing inner director vars store '%s'", path)
+	}
+	return creds, nil
+}
+
+// generateNATSCerts writes the certificates NATS and the director talk over,
+// all signed by one CA as in bosh-dev's assets/sandbox/nats_server. The CA
+// key is RSA because the director signs agent certificates with it.
+func (d *localInnerDirector) generateNATSCerts() error {
+	ca, caKey, err := natsCertificate(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "default.nats-ca.bosh-internal"},
+		KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:     true,
+	}, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	server, serverKey, err := natsCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "default.nats.bosh-internal"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	if err != nil {
+		return err
+	}
+
+	director, directorKey, err := natsCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "default.director.bosh-internal"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		"ca.pem":       certificatePEM(ca),
+		"ca.key":       rsaPrivateKeyPEM(caKey),
+		"server.pem":   certificatePEM(server),
+		"server.key":   rsaPrivateKeyPEM(serverKey),
+		"director.pem": certificatePEM(director),
+		"director.key": rsaPrivateKeyPEM(directorKey),
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(d.natsPath(name), []byte(contents), 0600); err != nil {
+			return bosherr.WrapErrorf(err, "Writing NATS '%s'", name)
+		}
+	}
+	return nil
+}
+
+// startNATS runs gnatsd with the permissions of bosh-dev's
+// assets/sandbox/nats.conf.erb and waits for it to listen.
+func (d *localInnerDirector) startNATS() error {
+	config := fmt.Sprintf(`listen: 127.0.0.1:%d
+
+authorization {
+  DIRECTOR_PERMISSIONS: {
+    publish: ["agent.*", "hm.director.alert"]
+    subscribe: ["director.>"]
+  }
+
+  AGENT_PERMISSIONS: {
+    publish: [
+      "hm.agent.heartbeat._CLIENT_ID",
+      "hm.agent.alert._CLIENT_ID",
+      "hm.agent.shutdown._CLIENT_ID",
+      "director.*._CLIENT_ID.*"
+    ]
+    subscribe: ["agent._CLIENT_ID"]
+  }
+
+  certificate_clients: [
+    {client_name: director.bosh-internal, permissions: $DIRECTOR_PERMISSIONS},
+    {client_name: agent.bosh-internal, permissions: $AGENT_PERMISSIONS},
+  ]
+
+  timeout: 5
+}
+
+tls {
+  cert_file: "%s"
+  key_file: "%s"
+  ca_file: "%s"
+  verify: true
+  timeout: 5
+  enable_cert_authorization: true
+}
+`, d.natsPort, d.natsPath("server.pem"), d.natsPath("server.key"), d.natsPath("ca.pem"))
+
+	configPath := d.natsPath("nats.conf")
+	if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+		return bosherr.WrapError(err, "Writing NATS config")
+	}
+
+	if err := d.startProcess("nats", exec.Command(d.gnatsdPath(), "-c", configPath)); err != nil {
+		return err
+	}
+
+	address := fmt.Sprintf("127.0.0.1:%d", d.natsPort)
+	deadline := time.Now().Add(d.startTimeout)
+	for {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return bosherr.WrapErrorf(err, "Waiting for NATS on %s, see '%s'", address, filepath.Join(d.dir, "nats.log"))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// writeCPI writes the wrapper the director execs for every CPI call, like
+// bosh-dev's assets/sandbox/cpi.erb.
+func (d *localInnerDirector) writeCPI() error {
+	cpiConfig, err := json.Marshal(map[string]interface{}{
+		"dir":  filepath.Join(d.dir, "cloud"),
+		"nats": d.natsURL(),
+		"agent": map[string]interface{}{
+			"blobstore": d.blobstore(),
+		},
+	})
+	if err != nil {
+		return bosherr.WrapError(err, "Marshaling dummy CPI config")
+	}
+
+	cpiConfigPath := filepath.Join(d.dir, "cpi.json")
+	if err := ioutil.WriteFile(cpiConfigPath, cpiConfig, 0644); err != nil {
+		return bosherr.WrapError(err, "Writing dummy CPI config")
+	}
+
+	script := fmt.Sprintf(`#!/bin/bash
+
+read -r INPUT
+
+export BUNDLE_GEMFILE='%s'
+echo "$INPUT" | exec bundle exec '%s' '%s'
+`,
+		filepath.Join(d.srcPath, "Gemfile"),
+		filepath.Join(d.srcPath, "bosh-director", "bin", "dummy_cpi"),
+		cpiConfigPath,
+	)
+
+	if err := ioutil.WriteFile(filepath.Join(d.dir, "cpi"), []byte(script), 0755); err != nil {
+		return bosherr.WrapError(err, "Writing dummy CPI wrapper")
+	}
+	return nil
+}
+
+func (d *localInnerDirector) blobstore() map[string]interface{} {
+	return map[string]interface{}{
+		"provider": "local",
+		"options": map[string]interface{}{
+			"blobstore_path": filepath.Join(d.dir, "blobstore"),
+		},
+	}
+}
+
+// writeDirectorConfig renders the director config after the template in
+// bosh-dev's assets/sandbox/director_test.yml.erb, then interpolates the ops
+// files and vars into it with the CLI.
+func (d *localInnerDirector) writeDirectorConfig(creds localCreds, opsFiles, vars []string) error {
+	db := map[string]interface{}{
+		"adapter":  "sqlite",
+		"database": filepath.Join(d.dir, "director.db"),
+		"connection_options": map[string]interface{}{
+			"max_connections": 32,
+			"pool_timeout":    10,
+		},
+	}
+
+	config := map[string]interface{}{
+		"name": fmt.Sprintf("local-inner-%d", d.port),
+		"uuid": fmt.Sprintf("local-inner-%d", d.port),
+		"runtime": map[string]interface{}{
+			"ip":       "127.0.0.1",
+			"instance": "bosh/0",
+		},
+		"port":    d.directorPort,
+		"mbus":    d.natsURL(),
+		"logging": map[string]interface{}{"level": "DEBUG"},
+		"dir":     filepath.Join(d.dir, "boshdir"),
+		"db":      db,
+		"dns":     map[string]interface{}{"db": db},
+		"local_dns": map[string]interface{}{
+			"enabled": true,
+		},
+		"version":                 "0.0.0",
+		"blobstore":               d.blobstore(),
+		"compiled_package_cache":  d.blobstore(),
+		"verify_multidigest_path": d.verifyMultidigestPath(),
+		"cloud": map[string]interface{}{
+			"provider": map[string]interface{}{
+				"name": "dummy",
+				"path": filepath.Join(d.dir, "cpi"),
+			},
+			"properties": map[string]interface{}{
+				"dir":   filepath.Join(d.dir, "cloud"),
+				"agent": map[string]interface{}{"blobstore": d.blobstore()},
+			},
+		},
+		"user_management": map[string]interface{}{
+			"provider": "local",
+			"local": map[string]interface{}{
+				"users": []map[string]string{
+					{"name": "admin", "password": creds.AdminPassword},
+				},
+			},
+		},
+		"cpi": map[string]interface{}{
+			"max_supported_api_version": 2,
+			"preferred_api_version":     1,
+		},
+		"config_server": map[string]interface{}{"enabled": false},
+		"nats": map[string]interface{}{
+			"server_ca_path":             d.natsPath("ca.pem"),
+			"client_certificate_path":    d.natsPath("director.pem"),
+			"client_private_key_path":    d.natsPath("director.key"),
+			"client_ca_certificate_path": d.natsPath("ca.pem"),
+			"client_ca_private_key_path": d.natsPath("ca.key"),
+		},
+		"record_events":     true,
+		"log_access_events": true,
+		"audit_log_path":    d.dir,
+		"director_ips":      []string{"127.0.0.1"},
+		"trusted_certs":     "",
+	}
+
+	contents, err := yaml.Marshal(config)
+	if err != nil {
+		return bosherr.WrapError(err, "Marshaling director config")
+	}
+
+	basePath := filepath.Join(d.dir, "bosh-director-base.yml")
+	if err := ioutil.WriteFile(basePath, contents, 0644); err != nil {
+		return bosherr.WrapError(err, "Writing director config")
+	}
+
+	args := append([]string{"int", basePath}, opsFileFlags(opsFiles)...)
+	args = append(args, vars...)
+
+	rendered, err := exec.Command(d.boshBinaryPath, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return bosherr.WrapErrorf(err, "Interpolating director config: %s", exitErr.Stderr)
+		}
+		return bosherr.WrapError(err, "Interpolating director config")
+	}
+
+	if err := ioutil.WriteFile(d.configPath(), rendered, 0644); err != nil {
+		return bosherr.WrapError(err, "Writing director config")
+	}
+	return nil
+}
+
+func (d *localInnerDirector) bundleCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command("bundle", append([]string{"exec"}, args...)...)
+	cmd.Dir = filepath.Join(d.srcPath, "bosh-director")
+	cmd.Env = append(os.Environ(),
+		"BUNDLE_GEMFILE="+filepath.Join(d.srcPath, "Gemfile"),
+		"TMPDIR="+filepath.Join(d.dir, "tmp"),
+	)
+	return cmd
+}
+
+// startProcess runs the process in its own process group so that Stop can
+// also take down what bundler spawned, and records its pid for Stop.
+func (d *localInnerDirector) startProcess(name string, cmd *exec.Cmd) error {
+	logFile, err := os.Create(filepath.Join(d.dir, name+".log"))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating log file for %s", name)
+	}
+	defer logFile.Close()
+
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return bosherr.WrapErrorf(err, "Starting %s", name)
+	}
+	go cmd.Wait()
+
+	pid := strconv.Itoa(cmd.Process.Pid)
+	if err := ioutil.WriteFile(filepath.Join(d.dir, name+".pid"), []byte(pid), 0644); err != nil {
+		return bosherr.WrapErrorf(err, "Recording pid of %s", name)
+	}
+	return nil
+}
+
+func (d *localInnerDirector) startProxy(creds localCreds) error {
+	certificate, err := tls.X509KeyPair([]byte(creds.DirectorSSL.Certificate), []byte(creds.DirectorSSL.PrivateKey))
+	if err != nil {
+		return bosherr.WrapError(err, "Loading director certificate")
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", d.port))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Listening on port %d", d.port)
+	}
+
+	target := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", d.directorPort)}
+	d.proxy = &http.Server{
+		Handler:   httputil.NewSingleHostReverseProxy(target),
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{certificate}},
+	}
+	go d.proxy.Serve(tls.NewListener(listener, d.proxy.TLSConfig))
+
+	return nil
+}
+
+func (d *localInnerDirector) waitForDirector() error {
+	infoURL := fmt.Sprintf("http://127.0.0.1:%d/info", d.directorPort)
+	deadline := time.Now().Add(d.startTimeout)
+
+	for {
+		resp, err := http.Get(infoURL)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			logPath := filepath.Join(d.dir, "director.log")
+			return bosherr.Errorf("Timed out after %s waiting for the director to answer on %s, see '%s'", d.startTimeout, infoURL, logPath)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func stopProcessGroup(pidFile string) error {
+	contents, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Reading '%s'", pidFile)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Parsing '%s'", pidFile)
+	}
+
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+		if err == syscall.ESRCH {
+			return nil
+		}
+		return bosherr.WrapErrorf(err, "Stopping process group %d", pid)
+	}
+
+	for i := 0; i < 20; i++ {
+		if syscall.Kill(-pid, 0) == syscall.ESRCH {
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	syscall.Kill(-pid, syscall.SIGKILL)
+	return nil
+}
+
+func selfSignedCertificate(ip string) (string, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", bosherr.WrapError(err, "Generating key")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", bosherr.WrapError(err, "Generating certificate serial number")
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: ip},
+		IPAddresses:           []net.IP{net.ParseIP(ip)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(7 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", bosherr.WrapError(err, "Creating certificate")
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", bosherr.WrapError(err, "Marshaling key")
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(cert), string(keyPEM), nil
+}
+
+// natsCertificate issues an RSA certificate for template, signed by ca, or
+// self-signed without one.
+func natsCertificate(template, ca *x509.Certificate, caKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Generating key")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Generating certificate serial number")
+	}
+
+	template.SerialNumber = serial
+	template.Subject.Organization = []string{"Cloud Foundry"}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(7 * 24 * time.Hour)
+	template.KeyUsage |= x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	template.BasicConstraintsValid = true
+	if ca == nil {
+		ca, caKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Creating certificate")
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Parsing certificate")
+	}
+	return cert, key, nil
+}
+
+func certificatePEM(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
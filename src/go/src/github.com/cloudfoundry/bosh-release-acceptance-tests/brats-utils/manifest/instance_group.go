@@ -0,0 +1,126 @@
+package manifest
+
+type InstanceGroup struct {
+	Name               string     `yaml:"name"`
+	Instances          int        `yaml:"instances"`
+	AZs                []string   `yaml:"azs,omitempty"`
+	Jobs               []*Job     `yaml:"jobs"`
+	VMType             string     `yaml:"vm_type,omitempty"`
+	Stemcell           string     `yaml:"stemcell,omitempty"`
+	PersistentDiskType string     `yaml:"persistent_disk_type,omitempty"`
+	Networks           []Network  `yaml:"networks,omitempty"`
+	Lifecycle          string     `yaml:"lifecycle,omitempty"`
+	Properties         Properties `yaml:"properties,omitempty"`
+}
+
+type Network struct {
+	Name      string   `yaml:"name"`
+	StaticIPs []string `yaml:"static_ips,omitempty"`
+	Default   []string `yaml:"default,omitempty"`
+}
+
+type Job struct {
+	Name       string                 `yaml:"name"`
+	Release    string                 `yaml:"release"`
+	Properties Properties             `yaml:"properties,omitempty"`
+	Consumes   map[string]interface{} `yaml:"consumes,omitempty"`
+	Provides   map[string]interface{} `yaml:"provides,omitempty"`
+}
+
+// NewInstanceGroup returns a single instance in z1 on the default network,
+// vm type and stemcell.
+func NewInstanceGroup(name string) *InstanceGroup {
+	return &InstanceGroup{
+		Name:      name,
+		Instances: 1,
+		AZs:       []string{"z1"},
+		VMType:    Default,
+		Stemcell:  Default,
+		Networks:  []Network{{Name: Default}},
+	}
+}
+
+func (g *InstanceGroup) WithInstances(instances int) *InstanceGroup {
+	g.Instances = instances
+	return g
+}
+
+func (g *InstanceGroup) InAZs(azs ...string) *InstanceGroup {
+	g.AZs = azs
+	return g
+}
+
+func (g *InstanceGroup) WithJob(jobs ...*Job) *InstanceGroup {
+	g.Jobs = append(g.Jobs, jobs...)
+	return g
+}
+
+func (g *InstanceGroup) WithVMType(vmType string) *InstanceGroup {
+	g.VMType = vmType
+	return g
+}
+
+func (g *InstanceGroup) WithPersistentDiskType(diskType string) *InstanceGroup {
+	g.PersistentDiskType = diskType
+	return g
+}
+
+// OnNetworks replaces the default network.
+func (g *InstanceGroup) OnNetworks(networks ...Network) *InstanceGroup {
+	g.Networks = networks
+	return g
+}
+
+func (g *InstanceGroup) AsErrand() *InstanceGroup {
+	g.Lifecycle = "errand"
+	return g
+}
+
+func (g *InstanceGroup) WithProperties(properties Properties) *InstanceGroup {
+	g.Properties = properties
+	return g
+}
+
+// Job returns the job with the name, or nil.
+func (g *InstanceGroup) Job(name string) *Job {
+	for _, job := range g.Jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+func NewJob(name, release string) *Job {
+	return &Job{Name: name, Release: release}
+}
+
+func (j *Job) WithProperties(properties Properties) *Job {
+	j.Properties = properties
+	return j
+}
+
+// ConsumesFrom wires the link to the provider of the same deployment named
+// from.
+func (j *Job) ConsumesFrom(link, from string) *Job {
+	return j.ConsumesLink(link, map[string]interface{}{"from": from})
+}
+
+// ConsumesLink sets the consumer definition for a link as is, e.g. "nil" to
+// explicitly not consume it.
+func (j *Job) ConsumesLink(link string, definition interface{}) *Job {
+	if j.Consumes == nil {
+		j.Consumes = map[string]interface{}{}
+	}
+	j.Consumes[link] = definition
+	return j
+}
+
+// ProvidesAs renames the link the job provides.
+func (j *Job) ProvidesAs(link, as string) *Job {
+	if j.Provides == nil {
+		j.Provides = map[string]interface{}{}
+	}
+	j.Provides[link] = map[string]interface{}{"as": as}
+	return j
+}
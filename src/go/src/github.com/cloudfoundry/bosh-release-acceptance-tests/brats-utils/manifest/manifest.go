@@ -0,0 +1,160 @@
+// Package manifest builds deployment manifests in code, so that specs can
+// vary a topology without adding another file under assets/.
+//
+// Builders default to what the assets use throughout: the `default` vm type,
+// stemcell alias and network, one instance in z1, and the usual update block.
+// Values like ((stemcell-os)) are kept as they are for the CLI to
+// interpolate.
+package manifest
+
+import (
+	"io/ioutil"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const Default = "default"
+
+type Properties map[string]interface{}
+
+type Manifest struct {
+	Name           string           `yaml:"name"`
+	Releases       []Release        `yaml:"releases,omitempty"`
+	Stemcells      []Stemcell       `yaml:"stemcells,omitempty"`
+	Update         *Update          `yaml:"update,omitempty"`
+	InstanceGroups []*InstanceGroup `yaml:"instance_groups,omitempty"`
+	Variables      []Variable       `yaml:"variables,omitempty"`
+	Addons         []Addon          `yaml:"addons,omitempty"`
+	Features       Properties       `yaml:"features,omitempty"`
+}
+
+type Release struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	URL     string `yaml:"url,omitempty"`
+	SHA1    string `yaml:"sha1,omitempty"`
+}
+
+type Stemcell struct {
+	Alias   string `yaml:"alias"`
+	OS      string `yaml:"os"`
+	Version string `yaml:"version"`
+}
+
+type Update struct {
+	Canaries        int    `yaml:"canaries"`
+	MaxInFlight     int    `yaml:"max_in_flight"`
+	CanaryWatchTime string `yaml:"canary_watch_time"`
+	UpdateWatchTime string `yaml:"update_watch_time"`
+}
+
+type Variable struct {
+	Name    string     `yaml:"name"`
+	Type    string     `yaml:"type"`
+	Options Properties `yaml:"options,omitempty"`
+}
+
+type Addon struct {
+	Name    string     `yaml:"name"`
+	Jobs    []*Job     `yaml:"jobs"`
+	Include Properties `yaml:"include,omitempty"`
+	Exclude Properties `yaml:"exclude,omitempty"`
+}
+
+// New returns a manifest with the update block the assets share and no
+// releases, stemcells or instance groups yet.
+func New(name string) *Manifest {
+	return &Manifest{
+		Name:   name,
+		Update: DefaultUpdate(),
+	}
+}
+
+func DefaultUpdate() *Update {
+	return &Update{
+		Canaries:        1,
+		MaxInFlight:     10,
+		CanaryWatchTime: "1000-30000",
+		UpdateWatchTime: "1000-30000",
+	}
+}
+
+// LatestRelease refers to the newest uploaded version of a release.
+func LatestRelease(name string) Release {
+	return Release{Name: name, Version: "latest"}
+}
+
+// LatestStemcell is the `default` alias for the newest stemcell of os.
+func LatestStemcell(os string) Stemcell {
+	return Stemcell{Alias: Default, OS: os, Version: "latest"}
+}
+
+func (m *Manifest) WithRelease(releases ...Release) *Manifest {
+	m.Releases = append(m.Releases, releases...)
+	return m
+}
+
+func (m *Manifest) WithStemcell(stemcells ...Stemcell) *Manifest {
+	m.Stemcells = append(m.Stemcells, stemcells...)
+	return m
+}
+
+func (m *Manifest) WithUpdate(update *Update) *Manifest {
+	m.Update = update
+	return m
+}
+
+func (m *Manifest) WithInstanceGroup(groups ...*InstanceGroup) *Manifest {
+	m.InstanceGroups = append(m.InstanceGroups, groups...)
+	return m
+}
+
+func (m *Manifest) WithVariable(variables ...Variable) *Manifest {
+	m.Variables = append(m.Variables, variables...)
+	return m
+}
+
+func (m *Manifest) WithAddon(addons ...Addon) *Manifest {
+	m.Addons = append(m.Addons, addons...)
+	return m
+}
+
+func (m *Manifest) WithFeature(name string, value interface{}) *Manifest {
+	if m.Features == nil {
+		m.Features = Properties{}
+	}
+	m.Features[name] = value
+	return m
+}
+
+// InstanceGroup returns the instance group with the name, or nil.
+func (m *Manifest) InstanceGroup(name string) *InstanceGroup {
+	for _, group := range m.InstanceGroups {
+		if group.Name == name {
+			return group
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) YAML() ([]byte, error) {
+	contents, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Marshaling manifest '%s'", m.Name)
+	}
+	return append([]byte("---\n"), contents...), nil
+}
+
+// Write saves the manifest to path, ready to be passed to `bosh deploy`.
+func (m *Manifest) Write(path string) error {
+	contents, err := m.YAML()
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		return bosherr.WrapErrorf(err, "Writing manifest '%s'", path)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package manifest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/manifest"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// normalize re-marshals YAML so that key order, quoting and flow style do not
+// matter when comparing with the assets.
+func normalize(contents []byte) string {
+	var parsed interface{}
+	Expect(yaml.Unmarshal(contents, &parsed)).To(Succeed())
+
+	normalized, err := yaml.Marshal(parsed)
+	Expect(err).ToNot(HaveOccurred())
+	return string(normalized)
+}
+
+func postgresManifest(job string) *manifest.Manifest {
+	return manifest.New("((deployment-name))").
+		WithRelease(manifest.LatestRelease("bosh"), manifest.LatestRelease("bpm")).
+		WithStemcell(manifest.LatestStemcell("((stemcell-os))")).
+		WithInstanceGroup(manifest.NewInstanceGroup("bosh").
+			WithJob(manifest.NewJob(job, "bosh"), manifest.NewJob("bpm", "bpm")).
+			WithPersistentDiskType(manifest.Default).
+			WithProperties(manifest.Properties{
+				"postgres": manifest.Properties{
+					"listen_address": "127.0.0.1",
+					"host":           "127.0.0.1",
+					"user":           "postgres",
+					"password":       "c1oudc0w",
+					"database":       "bosh",
+					"adapter":        "postgres",
+				},
+			}),
+		)
+}
+
+var _ = Describe("Manifest", func() {
+	DescribeTable("reproduces the assets",
+		func(asset string, build func() *manifest.Manifest) {
+			expected, err := ioutil.ReadFile(filepath.Join("..", "..", "assets", asset))
+			Expect(err).ToNot(HaveOccurred())
+
+			actual, err := build().YAML()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(normalize(actual)).To(Equal(normalize(expected)))
+		},
+
+		Entry("syslog", "syslog-manifest.yml", func() *manifest.Manifest {
+			return manifest.New("syslog-deployment").
+				WithRelease(manifest.LatestRelease("syslog")).
+				WithStemcell(manifest.LatestStemcell("((stemcell-os))")).
+				WithInstanceGroup(
+					manifest.NewInstanceGroup("syslog_storer").WithJob(
+						manifest.NewJob("syslog_storer", "syslog").WithProperties(manifest.Properties{
+							"syslog": manifest.Properties{"transport": "tcp", "port": 514},
+						}),
+					),
+					manifest.NewInstanceGroup("syslog_forwarder").WithJob(
+						manifest.NewJob("syslog_forwarder", "syslog").ConsumesFrom("syslog_storer", "syslog_storer"),
+					),
+				)
+		}),
+
+		Entry("dns with templates", "dns-with-templates-manifest.yml", func() *manifest.Manifest {
+			return manifest.New("dns-with-templates").
+				WithRelease(
+					manifest.Release{Name: "bosh-dns", Version: "latest", URL: "file://((dns-release-path))"},
+					manifest.Release{Name: "linked-templates", Version: "latest", URL: "file://((linked-template-release-path))"},
+				).
+				WithStemcell(manifest.LatestStemcell("((stemcell-os))")).
+				WithInstanceGroup(
+					manifest.NewInstanceGroup("test-agent").WithJob(
+						manifest.NewJob("query-with-az-filter", "linked-templates"),
+						manifest.NewJob("query-all", "linked-templates"),
+						manifest.NewJob("query-individual-instance", "linked-templates"),
+					),
+					manifest.NewInstanceGroup("provider").
+						WithInstances(3).
+						InAZs("z1", "z2").
+						WithJob(manifest.NewJob("link-provider", "linked-templates")),
+				).
+				WithVariable(
+					manifest.CAVariable("dns_api_tls_ca", "dns-api-tls-ca"),
+					manifest.CertificateVariable("dns_api_server_tls", "dns_api_tls_ca", "api.bosh-dns", "server_auth"),
+					manifest.CertificateVariable("dns_api_client_tls", "dns_api_tls_ca", "api.bosh-dns", "client_auth"),
+				)
+		}),
+
+		Entry("postgres 10", "postgres-10-manifest.yml", func() *manifest.Manifest {
+			return postgresManifest("postgres-10")
+		}),
+
+		Entry("postgres 9.4", "postgres-94-manifest.yml", func() *manifest.Manifest {
+			return postgresManifest("postgres-9.4")
+		}),
+
+		Entry("os-conf", "os-conf-manifest.yml", func() *manifest.Manifest {
+			update := manifest.DefaultUpdate()
+			update.Canaries = 10
+
+			return manifest.New("os-conf-deployment").
+				WithRelease(manifest.LatestRelease("os-conf")).
+				WithStemcell(manifest.LatestStemcell("((stemcell-os))")).
+				WithUpdate(update).
+				WithInstanceGroup(manifest.NewInstanceGroup("test-brats").
+					WithPersistentDiskType(manifest.Default).
+					WithJob(manifest.NewJob("user_add", "os-conf").WithProperties(manifest.Properties{
+						"users": []interface{}{},
+					})),
+				)
+		}),
+	)
+
+	It("varies the topology in code", func() {
+		m := manifest.New("dns").WithInstanceGroup(
+			manifest.NewInstanceGroup("provider-z1").WithInstances(2),
+			manifest.NewInstanceGroup("provider-z2").WithInstances(1).InAZs("z2"),
+		)
+		m.InstanceGroup("provider-z2").WithJob(manifest.NewJob("link-provider", "linked-templates").ProvidesAs("provider", "z2-provider"))
+
+		actual, err := m.YAML()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(normalize(actual)).To(Equal(normalize([]byte(`
+name: dns
+update: {canaries: 1, max_in_flight: 10, canary_watch_time: 1000-30000, update_watch_time: 1000-30000}
+instance_groups:
+- name: provider-z1
+  instances: 2
+  azs: [z1]
+  jobs: []
+  vm_type: default
+  stemcell: default
+  networks: [{name: default}]
+- name: provider-z2
+  instances: 1
+  azs: [z2]
+  jobs:
+  - name: link-provider
+    release: linked-templates
+    provides: {provider: {as: z2-provider}}
+  vm_type: default
+  stemcell: default
+  networks: [{name: default}]
+`))))
+	})
+
+	It("builds runtime configs with addon rules", func() {
+		config := manifest.NewRuntimeConfig().
+			WithRelease(manifest.Release{Name: "brats-addons", Version: "0+dev.1"}).
+			WithAddon(manifest.Addon{
+				Name: "by-job",
+				Jobs: []*manifest.Job{manifest.NewJob("addon-by-job", "brats-addons")},
+				Include: manifest.Properties{
+					"jobs":     []manifest.Properties{manifest.JobFilter("workload-worker", "brats-addons")},
+					"stemcell": []manifest.Properties{manifest.StemcellFilter("ubuntu-xenial")},
+				},
+				Exclude: manifest.Properties{"deployments": []string{"beta"}},
+			})
+
+		actual, err := config.YAML()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(actual)).To(HavePrefix("---\n"))
+
+		Expect(normalize(actual)).To(Equal(normalize([]byte(`
+releases: [{name: brats-addons, version: 0+dev.1}]
+addons:
+- name: by-job
+  jobs: [{name: addon-by-job, release: brats-addons}]
+  include:
+    jobs: [{name: workload-worker, release: brats-addons}]
+    stemcell: [{os: ubuntu-xenial}]
+  exclude:
+    deployments: [beta]
+`))))
+	})
+
+	It("writes the manifest for the CLI", func() {
+		dir, err := ioutil.TempDir("", "manifest")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "manifest.yml")
+		Expect(manifest.New("dns").Write(path)).To(Succeed())
+
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(contents)).To(HavePrefix("---\nname: dns\n"))
+	})
+})
@@ -0,0 +1,64 @@
+package manifest
+
+import (
+	"io/ioutil"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// RuntimeConfig is the content of a config of type runtime. The director
+// adds its addons to the instance groups of every deployment their include
+// and exclude rules match. Unlike in a deployment manifest, its releases
+// need an exact version.
+type RuntimeConfig struct {
+	Releases []Release `yaml:"releases,omitempty"`
+	Addons   []Addon   `yaml:"addons,omitempty"`
+}
+
+func NewRuntimeConfig() *RuntimeConfig {
+	return &RuntimeConfig{}
+}
+
+func (c *RuntimeConfig) WithRelease(releases ...Release) *RuntimeConfig {
+	c.Releases = append(c.Releases, releases...)
+	return c
+}
+
+func (c *RuntimeConfig) WithAddon(addons ...Addon) *RuntimeConfig {
+	c.Addons = append(c.Addons, addons...)
+	return c
+}
+
+func (c *RuntimeConfig) YAML() ([]byte, error) {
+	contents, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Marshaling runtime config")
+	}
+	return append([]byte("---\n"), contents...), nil
+}
+
+// Write saves the runtime config to path, ready to be passed to
+// `bosh update-config --type runtime`.
+func (c *RuntimeConfig) Write(path string) error {
+	contents, err := c.YAML()
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		return bosherr.WrapErrorf(err, "Writing runtime config '%s'", path)
+	}
+	return nil
+}
+
+// JobFilter matches the instance groups with the job in an addon's include
+// or exclude rules.
+func JobFilter(name, release string) Properties {
+	return Properties{"name": name, "release": release}
+}
+
+// StemcellFilter matches the instance groups on a stemcell of os.
+func StemcellFilter(os string) Properties {
+	return Properties{"os": os}
+}
@@ -0,0 +1,31 @@
+package manifest
+
+// CAVariable generates a self-signed certificate authority.
+func CAVariable(name, commonName string) Variable {
+	return Variable{
+		Name: name,
+		Type: "certificate",
+		Options: Properties{
+			"is_ca":       true,
+			"common_name": commonName,
+		},
+	}
+}
+
+// CertificateVariable generates a certificate signed by the CA variable;
+// extendedKeyUsage takes values like server_auth and client_auth.
+func CertificateVariable(name, ca, commonName string, extendedKeyUsage ...string) Variable {
+	options := Properties{
+		"ca":          ca,
+		"common_name": commonName,
+	}
+	if len(extendedKeyUsage) > 0 {
+		options["extended_key_usage"] = extendedKeyUsage
+	}
+
+	return Variable{Name: name, Type: "certificate", Options: options}
+}
+
+func PasswordVariable(name string) Variable {
+	return Variable{Name: name, Type: "password"}
+}
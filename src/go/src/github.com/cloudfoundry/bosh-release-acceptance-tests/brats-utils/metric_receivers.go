@@ -0,0 +1,158 @@
+package bratsutils
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// lineReceiver records every line written to it over TCP, which is all the
+// Graphite and OpenTSDB forwarders of the health monitor do.
+type lineReceiver struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	lines []string
+}
+
+// newLineReceiver listens on a free port of host.
+func newLineReceiver(host string) (*lineReceiver, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Listening on '%s'", host)
+	}
+
+	r := &lineReceiver{listener: listener}
+	go acceptConnections(listener, r.read)
+	return r, nil
+}
+
+func (r *lineReceiver) read(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		r.mu.Lock()
+		r.lines = append(r.lines, scanner.Text())
+		r.mu.Unlock()
+	}
+}
+
+func (r *lineReceiver) Port() int {
+	return r.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (r *lineReceiver) Close() error {
+	return r.listener.Close()
+}
+
+// Lines returns everything received so far.
+func (r *lineReceiver) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.lines...)
+}
+
+// Reset forgets everything received so far.
+func (r *lineReceiver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = nil
+}
+
+func acceptConnections(listener net.Listener, handle func(net.Conn)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go handle(conn)
+	}
+}
+
+type GraphiteMetric struct {
+	Name      string
+	Value     string
+	Timestamp int64
+}
+
+// GraphiteReceiver accepts Graphite's plaintext protocol, one
+// "name value timestamp" line per metric.
+type GraphiteReceiver struct {
+	*lineReceiver
+}
+
+func NewGraphiteReceiver(host string) (*GraphiteReceiver, error) {
+	r, err := newLineReceiver(host)
+	if err != nil {
+		return nil, err
+	}
+	return &GraphiteReceiver{r}, nil
+}
+
+// Metrics returns the well-formed metrics received so far.
+func (r *GraphiteReceiver) Metrics() []GraphiteMetric {
+	var metrics []GraphiteMetric
+	for _, line := range r.Lines() {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		metrics = append(metrics, GraphiteMetric{Name: fields[0], Value: fields[1], Timestamp: timestamp})
+	}
+	return metrics
+}
+
+type TSDBMetric struct {
+	Name      string
+	Timestamp int64
+	Value     string
+	Tags      map[string]string
+}
+
+// TSDBReceiver accepts OpenTSDB's telnet protocol,
+// "put name timestamp value tag=value..." lines.
+type TSDBReceiver struct {
+	*lineReceiver
+}
+
+func NewTSDBReceiver(host string) (*TSDBReceiver, error) {
+	r, err := newLineReceiver(host)
+	if err != nil {
+		return nil, err
+	}
+	return &TSDBReceiver{r}, nil
+}
+
+// Metrics returns the well-formed put commands received so far.
+func (r *TSDBReceiver) Metrics() []TSDBMetric {
+	var metrics []TSDBMetric
+	for _, line := range r.Lines() {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "put" {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		metric := TSDBMetric{Name: fields[1], Timestamp: timestamp, Value: fields[3], Tags: map[string]string{}}
+		for _, tag := range fields[4:] {
+			parts := strings.SplitN(tag, "=", 2)
+			if len(parts) == 2 {
+				metric.Tags[parts[0]] = parts[1]
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
@@ -0,0 +1,50 @@
+package bratsutils_test
+
+import (
+	"fmt"
+	"net"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("metric receivers", func() {
+	send := func(port int, lines string) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		_, err = conn.Write([]byte(lines))
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	It("records Graphite metrics", func() {
+		receiver, err := bratsutils.NewGraphiteReceiver("127.0.0.1")
+		Expect(err).ToNot(HaveOccurred())
+		defer receiver.Close()
+
+		send(receiver.Port(), "brats.dns.provider.abc.agent-1.system_load_1m 0.25 1500000000\nnot a metric\n")
+
+		Eventually(receiver.Metrics).Should(Equal([]bratsutils.GraphiteMetric{
+			{Name: "brats.dns.provider.abc.agent-1.system_load_1m", Value: "0.25", Timestamp: 1500000000},
+		}))
+		Expect(receiver.Lines()).To(HaveLen(2))
+	})
+
+	It("records OpenTSDB metrics with their tags", func() {
+		receiver, err := bratsutils.NewTSDBReceiver("127.0.0.1")
+		Expect(err).ToNot(HaveOccurred())
+		defer receiver.Close()
+
+		send(receiver.Port(), "put system.healthy 1500000000 1 deployment=dns id=abc index=0 job=provider\n")
+
+		Eventually(receiver.Metrics).Should(Equal([]bratsutils.TSDBMetric{{
+			Name:      "system.healthy",
+			Timestamp: 1500000000,
+			Value:     "1",
+			Tags:      map[string]string{"deployment": "dns", "id": "abc", "index": "0", "job": "provider"},
+		}}))
+	})
+})
@@ -0,0 +1,105 @@
+package bratsutils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// NATSPublisher speaks just enough of the NATS client protocol to publish
+// to the director's message bus with the legacy user and password, the way
+// agents that predate certificates do. Every publish waits for the server to
+// answer a PING, so that errors such as permission violations surface.
+type NATSPublisher struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewNATSPublisher(address, user, password string) (*NATSPublisher, error) {
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Connecting to NATS at '%s'", address)
+	}
+
+	p := &NATSPublisher{conn: conn, reader: bufio.NewReader(conn)}
+
+	info, err := p.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return nil, bosherr.Errorf("Expected INFO from NATS, got '%s'", info)
+	}
+
+	connect, err := json.Marshal(map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"user":     user,
+		"pass":     password,
+		"name":     "brats",
+	})
+	if err != nil {
+		conn.Close()
+		return nil, bosherr.WrapError(err, "Marshaling NATS CONNECT")
+	}
+
+	if err := p.roundTrip(fmt.Sprintf("CONNECT %s\r\n", connect)); err != nil {
+		conn.Close()
+		return nil, bosherr.WrapError(err, "Authenticating with NATS")
+	}
+	return p, nil
+}
+
+func (p *NATSPublisher) Publish(subject string, payload []byte) error {
+	if err := p.roundTrip(fmt.Sprintf("PUB %s %d\r\n%s\r\n", subject, len(payload), payload)); err != nil {
+		return bosherr.WrapErrorf(err, "Publishing to '%s'", subject)
+	}
+	return nil
+}
+
+func (p *NATSPublisher) Close() error {
+	return p.conn.Close()
+}
+
+// roundTrip sends the commands followed by a PING, and waits for the PONG.
+func (p *NATSPublisher) roundTrip(commands string) error {
+	p.conn.SetDeadline(time.Now().Add(30 * time.Second))
+	defer p.conn.SetDeadline(time.Time{})
+
+	if _, err := p.conn.Write([]byte(commands + "PING\r\n")); err != nil {
+		return bosherr.WrapError(err, "Writing to NATS")
+	}
+
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return bosherr.WrapError(err, "Writing to NATS")
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return bosherr.Errorf("NATS replied '%s'", line)
+		}
+	}
+}
+
+func (p *NATSPublisher) readLine() (string, error) {
+	line, err := p.reader.ReadString('\n')
+	if err != nil {
+		return "", bosherr.WrapError(err, "Reading from NATS")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,129 @@
+package bratsutils_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeNATS accepts a single client, checks its credentials like gnatsd does
+// and records what it publishes.
+type fakeNATS struct {
+	listener net.Listener
+	user     string
+	password string
+
+	mu        sync.Mutex
+	published map[string][]string
+}
+
+func newFakeNATS(user, password string) *fakeNATS {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+
+	f := &fakeNATS{listener: listener, user: user, password: password, published: map[string][]string{}}
+	go f.serve()
+	return f
+}
+
+func (f *fakeNATS) serve() {
+	conn, err := f.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"auth_required\":true}\r\n")
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "CONNECT":
+			var connect struct {
+				User string `json:"user"`
+				Pass string `json:"pass"`
+			}
+			json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &connect)
+			if connect.User != f.user || connect.Pass != f.password {
+				fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			if strings.HasPrefix(fields[1], "forbidden.") {
+				fmt.Fprintf(conn, "-ERR 'Permissions Violation for Publish to \"%s\"'\r\n", fields[1])
+				continue
+			}
+			f.mu.Lock()
+			f.published[fields[1]] = append(f.published[fields[1]], string(payload[:size]))
+			f.mu.Unlock()
+		case "PING":
+			fmt.Fprint(conn, "PING\r\nPONG\r\n")
+		}
+	}
+}
+
+func (f *fakeNATS) Published(subject string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.published[subject]
+}
+
+var _ = Describe("NATSPublisher", func() {
+	var server *fakeNATS
+
+	BeforeEach(func() {
+		server = newFakeNATS("nats", "secret")
+	})
+
+	AfterEach(func() {
+		server.listener.Close()
+	})
+
+	It("publishes once authenticated", func() {
+		publisher, err := bratsutils.NewNATSPublisher(server.listener.Addr().String(), "nats", "secret")
+		Expect(err).ToNot(HaveOccurred())
+		defer publisher.Close()
+
+		Expect(publisher.Publish("hm.agent.heartbeat.rogue", []byte(`{"job_state":"running"}`))).To(Succeed())
+		Expect(publisher.Publish("hm.agent.heartbeat.rogue", []byte("second"))).To(Succeed())
+		Expect(server.Published("hm.agent.heartbeat.rogue")).To(Equal([]string{`{"job_state":"running"}`, "second"}))
+	})
+
+	It("surfaces errors the server replies with", func() {
+		publisher, err := bratsutils.NewNATSPublisher(server.listener.Addr().String(), "nats", "secret")
+		Expect(err).ToNot(HaveOccurred())
+		defer publisher.Close()
+
+		err = publisher.Publish("forbidden.subject", []byte("{}"))
+		Expect(err).To(MatchError(ContainSubstring("Permissions Violation")))
+	})
+
+	It("fails on wrong credentials", func() {
+		_, err := bratsutils.NewNATSPublisher(server.listener.Addr().String(), "nats", "wrong")
+		Expect(err).To(MatchError(ContainSubstring("Authorization Violation")))
+	})
+})
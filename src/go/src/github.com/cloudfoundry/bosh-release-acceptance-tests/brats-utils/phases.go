@@ -0,0 +1,82 @@
+package bratsutils
+
+import (
+	"sync"
+	"time"
+)
+
+// Phases the helpers time on their own. Anything else a spec spends time on
+// is reported as PhaseAssertion.
+const (
+	PhasePrepare            = "prepare"
+	PhaseInnerDirectorStart = "inner_director_start"
+	PhaseReleaseUpload      = "release_upload"
+	PhaseStemcellUpload     = "stemcell_upload"
+	PhaseDeploy             = "deploy"
+	PhaseAssertion          = "assertion"
+	PhaseTeardown           = "teardown"
+)
+
+type PhaseTiming struct {
+	Phase   string  `json:"phase"`
+	Seconds float64 `json:"seconds"`
+}
+
+// phaseRecorder sums up the time spent in each phase, in the order the phases
+// were first entered, until the reporter takes them at the end of a spec.
+type phaseRecorder struct {
+	lock      sync.Mutex
+	phases    []string
+	durations map[string]time.Duration
+}
+
+var phases = &phaseRecorder{}
+
+func (r *phaseRecorder) add(phase string, duration time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.durations == nil {
+		r.durations = map[string]time.Duration{}
+	}
+	if _, found := r.durations[phase]; !found {
+		r.phases = append(r.phases, phase)
+	}
+	r.durations[phase] += duration
+}
+
+// take returns the recorded timings, attributing whatever part of total no
+// phase accounts for to PhaseAssertion, and starts over.
+func (r *phaseRecorder) take(total time.Duration) []PhaseTiming {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	timings := []PhaseTiming{}
+	remaining := total
+	for _, phase := range r.phases {
+		timings = append(timings, PhaseTiming{Phase: phase, Seconds: r.durations[phase].Seconds()})
+		remaining -= r.durations[phase]
+	}
+	if remaining > 0 {
+		timings = append(timings, PhaseTiming{Phase: PhaseAssertion, Seconds: remaining.Seconds()})
+	}
+
+	r.phases = nil
+	r.durations = nil
+	return timings
+}
+
+// StartPhase starts timing a phase of the current spec; call the returned
+// function when it is over, typically with defer so that failures count too.
+func StartPhase(phase string) func() {
+	startedAt := time.Now()
+	return func() {
+		phases.add(phase, time.Since(startedAt))
+	}
+}
+
+// TimePhase records how long body takes as a phase of the current spec.
+func TimePhase(phase string, body func()) {
+	defer StartPhase(phase)()
+	body()
+}
@@ -0,0 +1,42 @@
+// Command prefetch fills the artifact cache from the artifact lock ahead of
+// an offline run of the suites, checking every download against the SHA1 in
+// the artifact lock:
+//
+//	go run ./brats-utils/prefetch -cache /path/to/cache [name...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+)
+
+func main() {
+	lockPath := flag.String("lock", "assets/artifacts.lock.yml", "artifact lock to prefetch")
+	cacheDir := flag.String("cache", os.Getenv("BRATS_ARTIFACT_CACHE_PATH"), "directory to download artifacts into")
+	flag.Parse()
+
+	if *cacheDir == "" {
+		fmt.Fprintln(os.Stderr, "Expected -cache or BRATS_ARTIFACT_CACHE_PATH to be set")
+		os.Exit(2)
+	}
+
+	lock, err := bratsutils.LoadArtifactLock(*lockPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cache := bratsutils.NewArtifactCache(*cacheDir, lock, &http.Client{Timeout: 30 * time.Minute})
+
+	if err := cache.Prefetch(flag.Args()...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Artifacts are cached in %s\n", *cacheDir)
+}
@@ -0,0 +1,180 @@
+package bratsutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/reporters"
+	"github.com/onsi/ginkgo/types"
+
+	. "github.com/onsi/ginkgo"
+)
+
+type SuiteReport struct {
+	Suite   string       `json:"suite"`
+	Node    int          `json:"node"`
+	Seconds float64      `json:"seconds"`
+	Passed  bool         `json:"passed"`
+	Specs   []SpecReport `json:"specs"`
+}
+
+// SpecReport describes one spec, or the BeforeSuite and AfterSuite, which is
+// where the shared inner director is started and stopped.
+type SpecReport struct {
+	Name    string        `json:"name"`
+	State   string        `json:"state"`
+	Seconds float64       `json:"seconds"`
+	Phases  []PhaseTiming `json:"phases"`
+	Failure string        `json:"failure,omitempty"`
+}
+
+// JSONReporter writes a SuiteReport, including the phase timings recorded by
+// the helpers, when the suite ends.
+type JSONReporter struct {
+	path   string
+	report SuiteReport
+}
+
+var _ reporters.Reporter = &JSONReporter{}
+
+func NewJSONReporter(path string) *JSONReporter {
+	return &JSONReporter{path: path}
+}
+
+func (r *JSONReporter) SpecSuiteWillBegin(config config.GinkgoConfigType, summary *types.SuiteSummary) {
+	r.report = SuiteReport{
+		Suite: summary.SuiteDescription,
+		Node:  config.ParallelNode,
+		Specs: []SpecReport{},
+	}
+	phases.take(0)
+}
+
+func (r *JSONReporter) BeforeSuiteDidRun(summary *types.SetupSummary) {
+	r.addSetup("BeforeSuite", summary)
+}
+
+func (r *JSONReporter) AfterSuiteDidRun(summary *types.SetupSummary) {
+	r.addSetup("AfterSuite", summary)
+}
+
+func (r *JSONReporter) SpecWillRun(summary *types.SpecSummary) {
+	phases.take(0)
+}
+
+func (r *JSONReporter) SpecDidComplete(summary *types.SpecSummary) {
+	spec := SpecReport{
+		Name:    strings.Join(summary.ComponentTexts[1:], " "),
+		State:   specStateName(summary.State),
+		Seconds: summary.RunTime.Seconds(),
+		Phases:  phases.take(summary.RunTime),
+	}
+	if summary.HasFailureState() {
+		spec.Failure = summary.Failure.Message
+	}
+	r.report.Specs = append(r.report.Specs, spec)
+}
+
+func (r *JSONReporter) SpecSuiteDidEnd(summary *types.SuiteSummary) {
+	r.report.Seconds = summary.RunTime.Seconds()
+	r.report.Passed = summary.SuiteSucceeded
+
+	if err := r.write(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write JSON report: %s\n", err)
+	}
+}
+
+func (r *JSONReporter) Report() SuiteReport { return r.report }
+
+func (r *JSONReporter) addSetup(name string, summary *types.SetupSummary) {
+	// Nothing ran, e.g. on the nodes that only run the second half of a
+	// SynchronizedBeforeSuite.
+	if summary.State == types.SpecStateInvalid {
+		return
+	}
+
+	setup := SpecReport{
+		Name:    name,
+		State:   specStateName(summary.State),
+		Seconds: summary.RunTime.Seconds(),
+		Phases:  phases.take(0),
+	}
+	if summary.State.IsFailure() {
+		setup.Failure = summary.Failure.Message
+	}
+	r.report.Specs = append(r.report.Specs, setup)
+}
+
+func (r *JSONReporter) write() error {
+	contents, err := json.MarshalIndent(r.report, "", "  ")
+	if err != nil {
+		return bosherr.WrapError(err, "Marshaling report")
+	}
+
+	if err := ioutil.WriteFile(r.path, contents, 0644); err != nil {
+		return bosherr.WrapErrorf(err, "Writing report '%s'", r.path)
+	}
+	return nil
+}
+
+func specStateName(state types.SpecState) string {
+	switch state {
+	case types.SpecStatePending:
+		return "pending"
+	case types.SpecStateSkipped:
+		return "skipped"
+	case types.SpecStatePassed:
+		return "passed"
+	case types.SpecStateFailed:
+		return "failed"
+	case types.SpecStatePanicked:
+		return "panicked"
+	case types.SpecStateTimedOut:
+		return "timed_out"
+	default:
+		return "invalid"
+	}
+}
+
+// RunSpecsWithReports runs the suite like RunSpecs and, when reports_path is
+// configured, also writes a JUnit and a JSON report per parallel node there.
+// Resources leased by the suite are released when it returns.
+func RunSpecsWithReports(t GinkgoTestingT, description string) bool {
+	defer func() {
+		if err := releaseResources(); err != nil {
+			fmt.Fprintf(os.Stderr, "Releasing resources: %s\n", err)
+		}
+	}()
+
+	suiteConfig, err := LoadConfig(os.Getenv(ConfigPathEnv))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		t.Fail()
+		return false
+	}
+	suiteConfig.ApplyEnv(os.LookupEnv)
+
+	if suiteConfig.ReportsPath == "" {
+		return RunSpecs(t, description)
+	}
+
+	if err := os.MkdirAll(suiteConfig.ReportsPath, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Creating reports directory '%s': %s\n", suiteConfig.ReportsPath, err)
+		t.Fail()
+		return false
+	}
+
+	name := strings.ToLower(unsafeArtifactChars.ReplaceAllString(description, "_"))
+	node := config.GinkgoConfig.ParallelNode
+
+	return RunSpecsWithDefaultAndCustomReporters(t, description, []Reporter{
+		reporters.NewJUnitReporter(filepath.Join(suiteConfig.ReportsPath, fmt.Sprintf("%s_junit_%d.xml", name, node))),
+		NewJSONReporter(filepath.Join(suiteConfig.ReportsPath, fmt.Sprintf("%s_%d.json", name, node))),
+	})
+}
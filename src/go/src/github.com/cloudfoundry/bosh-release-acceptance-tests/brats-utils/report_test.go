@@ -0,0 +1,108 @@
+package bratsutils_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSONReporter", func() {
+	var (
+		reportDir string
+		reporter  *bratsutils.JSONReporter
+	)
+
+	BeforeEach(func() {
+		var err error
+		reportDir, err = ioutil.TempDir("", "reports")
+		Expect(err).ToNot(HaveOccurred())
+
+		reporter = bratsutils.NewJSONReporter(filepath.Join(reportDir, "brats_1.json"))
+		reporter.SpecSuiteWillBegin(config.GinkgoConfigType{ParallelNode: 1}, &types.SuiteSummary{SuiteDescription: "Brats Suite"})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(reportDir)
+	})
+
+	phaseNamed := func(timings []bratsutils.PhaseTiming, phase string) float64 {
+		for _, timing := range timings {
+			if timing.Phase == phase {
+				return timing.Seconds
+			}
+		}
+		Fail("no timing for phase " + phase)
+		return 0
+	}
+
+	It("breaks each spec down into phases", func() {
+		reporter.SpecWillRun(&types.SpecSummary{})
+		bratsutils.TimePhase(bratsutils.PhaseReleaseUpload, func() { time.Sleep(10 * time.Millisecond) })
+		bratsutils.TimePhase(bratsutils.PhaseReleaseUpload, func() { time.Sleep(10 * time.Millisecond) })
+		bratsutils.TimePhase(bratsutils.PhaseDeploy, func() { time.Sleep(10 * time.Millisecond) })
+
+		reporter.SpecDidComplete(&types.SpecSummary{
+			ComponentTexts: []string{"[Top Level]", "Blobstore", "logs access"},
+			State:          types.SpecStateFailed,
+			RunTime:        time.Second,
+			Failure:        types.SpecFailure{Message: "Expected 0 to equal 1"},
+		})
+
+		specs := reporter.Report().Specs
+		Expect(specs).To(HaveLen(1))
+		Expect(specs[0].Name).To(Equal("Blobstore logs access"))
+		Expect(specs[0].State).To(Equal("failed"))
+		Expect(specs[0].Failure).To(Equal("Expected 0 to equal 1"))
+
+		var names []string
+		for _, timing := range specs[0].Phases {
+			names = append(names, timing.Phase)
+		}
+		Expect(names).To(Equal([]string{"release_upload", "deploy", "assertion"}))
+
+		Expect(phaseNamed(specs[0].Phases, "release_upload")).To(BeNumerically(">=", 0.02))
+		Expect(phaseNamed(specs[0].Phases, "assertion")).To(BeNumerically("~", 0.97, 0.02))
+	})
+
+	It("does not carry phases over to the next spec", func() {
+		bratsutils.TimePhase(bratsutils.PhaseDeploy, func() {})
+		reporter.SpecWillRun(&types.SpecSummary{})
+
+		reporter.SpecDidComplete(&types.SpecSummary{
+			ComponentTexts: []string{"[Top Level]", "Logging", "works"},
+			State:          types.SpecStatePassed,
+		})
+
+		Expect(reporter.Report().Specs[0].Phases).To(BeEmpty())
+	})
+
+	It("reports suite setup and writes the report at the end", func() {
+		bratsutils.TimePhase(bratsutils.PhaseInnerDirectorStart, func() {})
+		reporter.BeforeSuiteDidRun(&types.SetupSummary{State: types.SpecStatePassed, RunTime: time.Minute})
+		reporter.AfterSuiteDidRun(&types.SetupSummary{State: types.SpecStateInvalid})
+		reporter.SpecSuiteDidEnd(&types.SuiteSummary{SuiteSucceeded: true, RunTime: time.Hour})
+
+		contents, err := ioutil.ReadFile(filepath.Join(reportDir, "brats_1.json"))
+		Expect(err).ToNot(HaveOccurred())
+
+		var report bratsutils.SuiteReport
+		Expect(json.Unmarshal(contents, &report)).To(Succeed())
+
+		Expect(report.Suite).To(Equal("Brats Suite"))
+		Expect(report.Node).To(Equal(1))
+		Expect(report.Passed).To(BeTrue())
+		Expect(report.Seconds).To(Equal(3600.0))
+		Expect(report.Specs).To(HaveLen(1))
+		Expect(report.Specs[0].Name).To(Equal("BeforeSuite"))
+		Expect(report.Specs[0].Phases[0].Phase).To(Equal("inner_director_start"))
+	})
+})
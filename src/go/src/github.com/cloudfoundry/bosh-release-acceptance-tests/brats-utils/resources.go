@@ -0,0 +1,304 @@
+package bratsutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"github.com/onsi/ginkgo/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	// DefaultResourceSlots matches the static IPs the outer cloud config
+	// reserves for inner directors, 10.245.0.11 to 10.245.0.100. Slot n
+	// gets 10.245.0.(10+n), so no configured range may go past
+	// MaxResourceSlot.
+	DefaultResourceSlots     = "1-90"
+	MaxResourceSlot          = 90
+	DefaultResourceLeasePath = "/tmp/inner-bosh/leases.json"
+)
+
+// ResourceRange is an inclusive range of slot numbers, written "first-last".
+type ResourceRange struct {
+	First int
+	Last  int
+}
+
+func ParseResourceRange(value string) (ResourceRange, error) {
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) != 2 {
+		return ResourceRange{}, bosherr.Errorf("Expected resource range '%s' to look like 'first-last'", value)
+	}
+
+	first, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return ResourceRange{}, bosherr.WrapErrorf(err, "Parsing start of resource range '%s'", value)
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return ResourceRange{}, bosherr.WrapErrorf(err, "Parsing end of resource range '%s'", value)
+	}
+
+	if first < 1 || last < first {
+		return ResourceRange{}, bosherr.Errorf("Expected resource range '%s' to be positive and ascending", value)
+	}
+	if last > MaxResourceSlot {
+		return ResourceRange{}, bosherr.Errorf("Expected resource range '%s' to end by slot %d, the last with a static IP for inner directors", value, MaxResourceSlot)
+	}
+	return ResourceRange{First: first, Last: last}, nil
+}
+
+// Resources are what one suite process may use without colliding with any
+// other on the host. They are all derived from the leased slot, so the inner
+// director scripts, which take a node number, get the slot in its place.
+type Resources struct {
+	Slot int
+}
+
+func (r Resources) DirectorIP() string {
+	return fmt.Sprintf("10.245.0.%d", 10+r.Slot)
+}
+
+func (r Resources) DirectorPath() string {
+	return fmt.Sprintf("/tmp/inner-bosh/director/%d", r.Slot)
+}
+
+// DirectorDeploymentName is the deployment of the inner director on the outer
+// director.
+func (r Resources) DirectorDeploymentName() string {
+	return fmt.Sprintf("bosh-%d", r.Slot)
+}
+
+func (r Resources) DBName(dbType string) string {
+	return fmt.Sprintf("db_%s_%d", dbType, r.Slot)
+}
+
+// Name makes any other name, e.g. of a deployment or config, unique to the
+// lease.
+func (r Resources) Name(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, r.Slot)
+}
+
+// TempRoot holds the lease's temporary directories and is removed along
+// with the lease.
+func (r Resources) TempRoot() string {
+	return filepath.Join(os.TempDir(), "brats-resources", strconv.Itoa(r.Slot))
+}
+
+func (r Resources) TempDir(prefix string) (string, error) {
+	if err := os.MkdirAll(r.TempRoot(), 0755); err != nil {
+		return "", bosherr.WrapErrorf(err, "Creating '%s'", r.TempRoot())
+	}
+
+	dir, err := ioutil.TempDir(r.TempRoot(), prefix)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Creating temporary directory '%s'", prefix)
+	}
+	return dir, nil
+}
+
+// LeaseOwner identifies the process holding a lease. A lease whose process
+// is gone is free again, which covers suites that were killed.
+type LeaseOwner struct {
+	PID      int       `json:"pid"`
+	Suite    string    `json:"suite"`
+	Node     int       `json:"node"`
+	LeasedAt time.Time `json:"leased_at"`
+}
+
+// ResourceAllocator leases slots from a range, recording them in a JSON file
+// that is locked while it is read and written. Every suite on the host that
+// shares the file, e.g. BRATS and BBR, gets different slots.
+type ResourceAllocator struct {
+	path  string
+	slots ResourceRange
+}
+
+func NewResourceAllocator(path string, slots ResourceRange) *ResourceAllocator {
+	return &ResourceAllocator{path: path, slots: slots}
+}
+
+// Lease returns the slot already leased by the owner's process, or the
+// lowest free one.
+func (a *ResourceAllocator) Lease(owner LeaseOwner) (Resources, error) {
+	var leased Resources
+
+	err := a.update(func(leases map[int]LeaseOwner) error {
+		for slot, existing := range leases {
+			if existing.PID == owner.PID {
+				leased = Resources{Slot: slot}
+				return nil
+			}
+		}
+
+		for slot := a.slots.First; slot <= a.slots.Last; slot++ {
+			if _, taken := leases[slot]; !taken {
+				leases[slot] = owner
+				leased = Resources{Slot: slot}
+				return nil
+			}
+		}
+
+		return bosherr.Errorf("All resource slots %d-%d are leased", a.slots.First, a.slots.Last)
+	})
+
+	return leased, err
+}
+
+// Release frees the slot and removes its temporary directories.
+func (a *ResourceAllocator) Release(resources Resources) error {
+	err := a.update(func(leases map[int]LeaseOwner) error {
+		delete(leases, resources.Slot)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(resources.TempRoot()); err != nil {
+		return bosherr.WrapErrorf(err, "Removing '%s'", resources.TempRoot())
+	}
+	return nil
+}
+
+// Leases returns the live leases by slot.
+func (a *ResourceAllocator) Leases() (map[int]LeaseOwner, error) {
+	var current map[int]LeaseOwner
+
+	err := a.update(func(leases map[int]LeaseOwner) error {
+		current = leases
+		return nil
+	})
+
+	return current, err
+}
+
+func (a *ResourceAllocator) update(change func(map[int]LeaseOwner) error) error {
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return bosherr.WrapErrorf(err, "Creating '%s'", filepath.Dir(a.path))
+	}
+
+	file, err := os.OpenFile(a.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Opening resource leases '%s'", a.path)
+	}
+	defer file.Close()
+
+	// The lock goes away with the file descriptor, even if we panic.
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return bosherr.WrapErrorf(err, "Locking resource leases '%s'", a.path)
+	}
+
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Reading resource leases '%s'", a.path)
+	}
+
+	leases := map[int]LeaseOwner{}
+	if len(contents) > 0 {
+		if err := json.Unmarshal(contents, &leases); err != nil {
+			return bosherr.WrapErrorf(err, "Parsing resource leases '%s'", a.path)
+		}
+	}
+
+	for slot, owner := range leases {
+		if !processAlive(owner.PID) {
+			delete(leases, slot)
+		}
+	}
+
+	if err := change(leases); err != nil {
+		return err
+	}
+
+	contents, err = json.MarshalIndent(leases, "", "  ")
+	if err != nil {
+		return bosherr.WrapError(err, "Marshaling resource leases")
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return bosherr.WrapErrorf(err, "Truncating resource leases '%s'", a.path)
+	}
+	if _, err := file.WriteAt(contents, 0); err != nil {
+		return bosherr.WrapErrorf(err, "Writing resource leases '%s'", a.path)
+	}
+	return nil
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+var (
+	resourceAllocator *ResourceAllocator
+	leasedResources   *Resources
+)
+
+// LeaseResources leases a slot for this process on first use. The lease is
+// given back when RunSpecsWithReports returns, however the suite ended, and
+// is reclaimed from processes that died without returning it.
+func LeaseResources() Resources {
+	if leasedResources != nil {
+		return *leasedResources
+	}
+
+	suite := SuiteConfig()
+
+	slots := suite.ResourceSlots
+	if slots == "" {
+		slots = DefaultResourceSlots
+	}
+	slotRange, err := ParseResourceRange(slots)
+	Expect(err).ToNot(HaveOccurred())
+
+	leasePath := suite.ResourceLeasePath
+	if leasePath == "" {
+		leasePath = DefaultResourceLeasePath
+	}
+	resourceAllocator = NewResourceAllocator(leasePath, slotRange)
+
+	resources, err := resourceAllocator.Lease(LeaseOwner{
+		PID:      os.Getpid(),
+		Suite:    filepath.Base(os.Args[0]),
+		Node:     config.GinkgoConfig.ParallelNode,
+		LeasedAt: time.Now().UTC(),
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	fmt.Fprintf(GinkgoWriter, "Leased resource slot %d\n", resources.Slot)
+	leasedResources = &resources
+	return resources
+}
+
+// TempDir creates a temporary directory that is removed with the lease.
+func TempDir(prefix string) string {
+	dir, err := LeaseResources().TempDir(prefix)
+	Expect(err).ToNot(HaveOccurred())
+	return dir
+}
+
+func releaseResources() error {
+	if leasedResources == nil {
+		return nil
+	}
+
+	if err := resourceAllocator.Release(*leasedResources); err != nil {
+		return err
+	}
+	leasedResources = nil
+	return nil
+}
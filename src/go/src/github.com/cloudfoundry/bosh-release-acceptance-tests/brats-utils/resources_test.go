@@ -0,0 +1,136 @@
+package bratsutils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ResourceAllocator", func() {
+	var (
+		dir       string
+		allocator *bratsutils.ResourceAllocator
+		other     *exec.Cmd
+	)
+
+	owner := func(pid int) bratsutils.LeaseOwner {
+		return bratsutils.LeaseOwner{PID: pid, Suite: "brats.test", Node: 1}
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "resources")
+		Expect(err).ToNot(HaveOccurred())
+
+		allocator = bratsutils.NewResourceAllocator(filepath.Join(dir, "leases.json"), bratsutils.ResourceRange{First: 95, Last: 96})
+
+		other = exec.Command("sleep", "60")
+		Expect(other.Start()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		other.Process.Kill()
+		other.Wait()
+		os.RemoveAll(dir)
+	})
+
+	It("leases the lowest free slot once per process", func() {
+		resources, err := allocator.Lease(owner(os.Getpid()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resources.Slot).To(Equal(95))
+
+		again, err := allocator.Lease(owner(os.Getpid()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again).To(Equal(resources))
+
+		otherResources, err := allocator.Lease(owner(other.Process.Pid))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(otherResources.Slot).To(Equal(96))
+	})
+
+	It("fails when every slot is leased", func() {
+		_, err := allocator.Lease(owner(os.Getpid()))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = allocator.Lease(owner(other.Process.Pid))
+		Expect(err).ToNot(HaveOccurred())
+
+		third := exec.Command("sleep", "60")
+		Expect(third.Start()).To(Succeed())
+		defer func() {
+			third.Process.Kill()
+			third.Wait()
+		}()
+
+		_, err = allocator.Lease(owner(third.Process.Pid))
+		Expect(err).To(MatchError("All resource slots 95-96 are leased"))
+	})
+
+	It("reclaims slots of processes that are gone", func() {
+		_, err := allocator.Lease(owner(other.Process.Pid))
+		Expect(err).ToNot(HaveOccurred())
+
+		other.Process.Kill()
+		other.Wait()
+
+		resources, err := allocator.Lease(owner(os.Getpid()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resources.Slot).To(Equal(95))
+
+		leases, err := allocator.Leases()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(leases).To(HaveLen(1))
+		Expect(leases[95].PID).To(Equal(os.Getpid()))
+	})
+
+	It("frees the slot and its temporary directories on release", func() {
+		resources, err := allocator.Lease(owner(os.Getpid()))
+		Expect(err).ToNot(HaveOccurred())
+
+		tempDir, err := resources.TempDir("db_tls")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tempDir).To(HavePrefix(resources.TempRoot()))
+
+		Expect(allocator.Release(resources)).To(Succeed())
+
+		_, err = os.Stat(resources.TempRoot())
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		leases, err := allocator.Leases()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(leases).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Resources", func() {
+	It("derives every name from the slot", func() {
+		resources := bratsutils.Resources{Slot: 3}
+
+		Expect(resources.DirectorIP()).To(Equal("10.245.0.13"))
+		Expect(bratsutils.Resources{Slot: bratsutils.MaxResourceSlot}.DirectorIP()).To(Equal("10.245.0.100"))
+		Expect(resources.DirectorPath()).To(Equal("/tmp/inner-bosh/director/3"))
+		Expect(resources.DirectorDeploymentName()).To(Equal("bosh-3"))
+		Expect(resources.DBName("mysql")).To(Equal("db_mysql_3"))
+		Expect(resources.Name("logging-cpi-config")).To(Equal("logging-cpi-config-3"))
+	})
+
+	It("parses slot ranges", func() {
+		slots, err := bratsutils.ParseResourceRange("1-90")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(slots).To(Equal(bratsutils.ResourceRange{First: 1, Last: 90}))
+
+		_, err = bratsutils.ParseResourceRange("90")
+		Expect(err).To(MatchError(ContainSubstring("to look like 'first-last'")))
+
+		_, err = bratsutils.ParseResourceRange("5-2")
+		Expect(err).To(MatchError(ContainSubstring("positive and ascending")))
+
+		_, err = bratsutils.ParseResourceRange("80-91")
+		Expect(err).To(MatchError(ContainSubstring("to end by slot 90")))
+	})
+})
@@ -0,0 +1,262 @@
+package bratsutils
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// RiemannEvent holds the fields of a Riemann event the health monitor sets.
+// Everything else it sends, like the deployment or the metric name, arrives
+// as attributes.
+type RiemannEvent struct {
+	Time        int64
+	State       string
+	Service     string
+	Host        string
+	Description string
+	Tags        []string
+	Metric      float64
+	Attributes  map[string]string
+}
+
+// RiemannReceiver accepts Riemann's protocol buffers messages over both TCP
+// and UDP on the same port, like a Riemann server. The Ruby client sends
+// small messages over UDP and only falls back to TCP for large ones.
+type RiemannReceiver struct {
+	listener net.Listener
+	packets  net.PacketConn
+
+	mu     sync.Mutex
+	events []RiemannEvent
+}
+
+func NewRiemannReceiver(host string) (*RiemannReceiver, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Listening on '%s'", host)
+	}
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	packets, err := net.ListenPacket("udp", net.JoinHostPort(host, port))
+	if err != nil {
+		listener.Close()
+		return nil, bosherr.WrapErrorf(err, "Listening for UDP on port %s", port)
+	}
+
+	r := &RiemannReceiver{listener: listener, packets: packets}
+	go acceptConnections(listener, r.readTCP)
+	go r.readUDP()
+	return r, nil
+}
+
+func (r *RiemannReceiver) Port() int {
+	return r.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (r *RiemannReceiver) Close() error {
+	r.packets.Close()
+	return r.listener.Close()
+}
+
+// Events returns every event received so far.
+func (r *RiemannReceiver) Events() []RiemannEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RiemannEvent{}, r.events...)
+}
+
+// Reset forgets every event received so far.
+func (r *RiemannReceiver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+// readTCP handles length-prefixed messages and acknowledges each one, since
+// the client waits for the server's reply.
+func (r *RiemannReceiver) readTCP(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var length uint32
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+
+		message := make([]byte, length)
+		if _, err := io.ReadFull(conn, message); err != nil {
+			return
+		}
+		r.record(message)
+
+		// A Msg with ok (field 2) set to true.
+		if _, err := conn.Write([]byte{0, 0, 0, 2, 0x10, 0x01}); err != nil {
+			return
+		}
+	}
+}
+
+func (r *RiemannReceiver) readUDP() {
+	buffer := make([]byte, 65536)
+	for {
+		n, _, err := r.packets.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		r.record(append([]byte{}, buffer[:n]...))
+	}
+}
+
+func (r *RiemannReceiver) record(message []byte) {
+	events, err := decodeRiemannMessage(message)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.events = append(r.events, events...)
+	r.mu.Unlock()
+}
+
+// decodeRiemannMessage reads the events (field 6) of a Msg from riemann's
+// proto.proto, ignoring fields the health monitor never sets.
+func decodeRiemannMessage(message []byte) ([]RiemannEvent, error) {
+	var events []RiemannEvent
+
+	err := decodeProtobuf(message, func(field protobufField) error {
+		if field.number != 6 {
+			return nil
+		}
+		event, err := decodeRiemannEvent(field.bytes)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+
+	return events, err
+}
+
+func decodeRiemannEvent(message []byte) (RiemannEvent, error) {
+	event := RiemannEvent{Attributes: map[string]string{}}
+
+	var (
+		metricD, metricF      float64
+		metricSint64          int64
+		hasD, hasF, hasSint64 bool
+	)
+
+	err := decodeProtobuf(message, func(field protobufField) error {
+		switch field.number {
+		case 1:
+			event.Time = int64(field.varint)
+		case 2:
+			event.State = string(field.bytes)
+		case 3:
+			event.Service = string(field.bytes)
+		case 4:
+			event.Host = string(field.bytes)
+		case 5:
+			event.Description = string(field.bytes)
+		case 7:
+			event.Tags = append(event.Tags, string(field.bytes))
+		case 9:
+			var key, value string
+			err := decodeProtobuf(field.bytes, func(attribute protobufField) error {
+				switch attribute.number {
+				case 1:
+					key = string(attribute.bytes)
+				case 2:
+					value = string(attribute.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			event.Attributes[key] = value
+		case 13:
+			metricSint64, hasSint64 = int64(field.varint>>1)^-int64(field.varint&1), true
+		case 14:
+			metricD, hasD = math.Float64frombits(field.fixed), true
+		case 15:
+			metricF, hasF = float64(math.Float32frombits(uint32(field.fixed))), true
+		}
+		return nil
+	})
+
+	switch {
+	case hasD:
+		event.Metric = metricD
+	case hasSint64:
+		event.Metric = float64(metricSint64)
+	case hasF:
+		event.Metric = metricF
+	}
+
+	return event, err
+}
+
+type protobufField struct {
+	number int
+	varint uint64
+	fixed  uint64
+	bytes  []byte
+}
+
+// decodeProtobuf walks the fields of an encoded protocol buffers message.
+// Varints land in varint, 32 and 64-bit values in fixed, and
+// length-delimited values in bytes.
+func decodeProtobuf(message []byte, visit func(protobufField) error) error {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return bosherr.Error("Reading protobuf field key")
+		}
+		message = message[n:]
+
+		field := protobufField{number: int(key >> 3)}
+
+		switch key & 7 {
+		case 0:
+			field.varint, n = binary.Uvarint(message)
+			if n <= 0 {
+				return bosherr.Errorf("Reading varint of field %d", field.number)
+			}
+			message = message[n:]
+		case 1:
+			if len(message) < 8 {
+				return bosherr.Errorf("Reading 64-bit value of field %d", field.number)
+			}
+			field.fixed = binary.LittleEndian.Uint64(message)
+			message = message[8:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return bosherr.Errorf("Reading bytes of field %d", field.number)
+			}
+			field.bytes = message[n : n+int(length)]
+			message = message[n+int(length):]
+		case 5:
+			if len(message) < 4 {
+				return bosherr.Errorf("Reading 32-bit value of field %d", field.number)
+			}
+			field.fixed = uint64(binary.LittleEndian.Uint32(message))
+			message = message[4:]
+		default:
+			return bosherr.Errorf("Unsupported wire type %d of field %d", key&7, field.number)
+		}
+
+		if err := visit(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
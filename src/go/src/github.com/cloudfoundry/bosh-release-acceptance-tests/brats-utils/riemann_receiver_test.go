@@ -0,0 +1,174 @@
+package bratsutils_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func protobufKey(number, wireType int) []byte {
+	key := make([]byte, binary.MaxVarintLen64)
+	return key[:binary.PutUvarint(key, uint64(number<<3|wireType))]
+}
+
+// The protobuf helpers encode single fields the way the Ruby riemann client
+// does.
+func protobufVarint(number int, value uint64) []byte {
+	varint := make([]byte, binary.MaxVarintLen64)
+	return append(protobufKey(number, 0), varint[:binary.PutUvarint(varint, value)]...)
+}
+
+func protobufBytes(number int, value []byte) []byte {
+	length := make([]byte, binary.MaxVarintLen64)
+	length = length[:binary.PutUvarint(length, uint64(len(value)))]
+
+	return append(append(protobufKey(number, 2), length...), value...)
+}
+
+func protobufString(number int, value string) []byte {
+	return protobufBytes(number, []byte(value))
+}
+
+func protobufDouble(number int, value float64) []byte {
+	bits := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bits, math.Float64bits(value))
+
+	return append(protobufKey(number, 1), bits...)
+}
+
+func protobufFloat(number int, value float32) []byte {
+	bits := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bits, math.Float32bits(value))
+
+	return append(protobufKey(number, 5), bits...)
+}
+
+func riemannAttribute(key, value string) []byte {
+	return protobufBytes(9, append(protobufString(1, key), protobufString(2, value)...))
+}
+
+func riemannMessage(service, name string, metric float64) []byte {
+	var event []byte
+	event = append(event, protobufString(3, service)...)
+	event = append(event, riemannAttribute("name", name)...)
+	event = append(event, protobufDouble(14, metric)...)
+	return protobufBytes(6, event)
+}
+
+var _ = Describe("RiemannReceiver", func() {
+	var receiver *bratsutils.RiemannReceiver
+
+	BeforeEach(func() {
+		var err error
+		receiver, err = bratsutils.NewRiemannReceiver("127.0.0.1")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		receiver.Close()
+	})
+
+	// sendFramed sends a message over TCP with the length prefix the client
+	// puts in front of it, and returns the receiver's reply.
+	sendFramed := func(message []byte) []byte {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", receiver.Port()))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		Expect(binary.Write(conn, binary.BigEndian, uint32(len(message)))).To(Succeed())
+		_, err = conn.Write(message)
+		Expect(err).ToNot(HaveOccurred())
+
+		reply := make([]byte, 6)
+		_, err = io.ReadFull(conn, reply)
+		Expect(err).ToNot(HaveOccurred())
+		return reply
+	}
+
+	It("records events sent over UDP", func() {
+		conn, err := net.Dial("udp", fmt.Sprintf("127.0.0.1:%d", receiver.Port()))
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		_, err = conn.Write(riemannMessage("bosh.hm", "system.load.1m", 0.25))
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(receiver.Events).Should(HaveLen(1))
+		event := receiver.Events()[0]
+		Expect(event.Service).To(Equal("bosh.hm"))
+		Expect(event.Attributes).To(HaveKeyWithValue("name", "system.load.1m"))
+		Expect(event.Metric).To(Equal(0.25))
+	})
+
+	It("acknowledges events sent over TCP", func() {
+		reply := sendFramed(riemannMessage("bosh.hm", "system.healthy", 1))
+		Expect(reply).To(Equal([]byte{0, 0, 0, 2, 0x10, 0x01}))
+
+		Expect(receiver.Events()).To(HaveLen(1))
+		Expect(receiver.Events()[0].Attributes).To(HaveKeyWithValue("name", "system.healthy"))
+	})
+
+	It("decodes every field the health monitor sets", func() {
+		var alert []byte
+		alert = append(alert, protobufVarint(1, 1500000000)...)
+		alert = append(alert, protobufString(2, "critical")...)
+		alert = append(alert, protobufString(3, "bosh.hm")...)
+		alert = append(alert, protobufString(4, "director-host")...)
+		alert = append(alert, protobufString(5, "process is not running")...)
+		alert = append(alert, protobufString(7, "alert")...)
+		alert = append(alert, protobufString(7, "bosh")...)
+		alert = append(alert, riemannAttribute("deployment", "dns")...)
+		alert = append(alert, riemannAttribute("severity", "2")...)
+
+		heartbeat := append(riemannAttribute("name", "system.healthy"), protobufFloat(15, 0.5)...)
+		processes := append(riemannAttribute("name", "system.processes"), protobufVarint(13, 7<<1)...)
+		// Unknown fields of the message, such as states, are skipped.
+		message := append(protobufString(1, "ignored"), protobufBytes(6, alert)...)
+		message = append(message, protobufBytes(6, heartbeat)...)
+		message = append(message, protobufBytes(6, processes)...)
+
+		sendFramed(message)
+
+		Expect(receiver.Events()).To(Equal([]bratsutils.RiemannEvent{
+			{
+				Time:        1500000000,
+				State:       "critical",
+				Service:     "bosh.hm",
+				Host:        "director-host",
+				Description: "process is not running",
+				Tags:        []string{"alert", "bosh"},
+				Attributes:  map[string]string{"deployment": "dns", "severity": "2"},
+			},
+			{Metric: 0.5, Attributes: map[string]string{"name": "system.healthy"}},
+			{Metric: 7, Attributes: map[string]string{"name": "system.processes"}},
+		}))
+	})
+
+	It("prefers the double metric the client sends alongside the others", func() {
+		event := append(protobufVarint(13, 3<<1), protobufFloat(15, 2)...)
+		event = append(event, protobufDouble(14, 1.5)...)
+
+		sendFramed(protobufBytes(6, event))
+
+		Expect(receiver.Events()).To(HaveLen(1))
+		Expect(receiver.Events()[0].Metric).To(Equal(1.5))
+	})
+
+	It("drops messages it cannot decode", func() {
+		truncated := riemannMessage("bosh.hm", "system.healthy", 1)
+		sendFramed(truncated[:len(truncated)-3])
+
+		Expect(receiver.Events()).To(BeEmpty())
+
+		// The receiver keeps serving later messages.
+		sendFramed(riemannMessage("bosh.hm", "system.healthy", 1))
+		Expect(receiver.Events()).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,153 @@
+package bratsutils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// scriptInnerDirector deploys the director with the outer director using the
+// scripts in ci/docker/main-bosh-docker. The scripts call the leased slot
+// the node number and find its directory under inner_bosh_root.
+type scriptInnerDirector struct {
+	scriptsPath    string
+	releasePath    string
+	boshBinaryPath string
+	dir            string
+	directorIP     string
+	slot           int
+	out            io.Writer
+
+	startTimeout   time.Duration
+	stopTimeout    time.Duration
+	prepareTimeout time.Duration
+	collectTimeout time.Duration
+}
+
+func (d *scriptInnerDirector) Prepare() error {
+	cmd := d.command("create-and-upload-release.sh", strconv.Itoa(d.slot))
+	cmd.Env = append(cmd.Env, fmt.Sprintf("bosh_release_path=%s", d.releasePath))
+
+	return runCommand(cmd, d.out, d.prepareTimeout)
+}
+
+func (d *scriptInnerDirector) Start(opsFiles, vars []string) error {
+	args := []string{strconv.Itoa(d.slot)}
+	args = append(args, opsFileFlags(opsFiles)...)
+	args = append(args, vars...)
+
+	return runCommand(d.command("start-inner-bosh-parallel.sh", args...), d.out, d.startTimeout)
+}
+
+func (d *scriptInnerDirector) Stop() error {
+	return runCommand(d.command("destroy-inner-bosh.sh", strconv.Itoa(d.slot)), d.out, d.stopTimeout)
+}
+
+// HostAddress is the gateway of the Docker network the director runs on,
+// which is the Docker host.
+func (d *scriptInnerDirector) HostAddress() string {
+	return "10.245.0.1"
+}
+
+// CPI is the docker_cpi job colocated with the director.
+func (d *scriptInnerDirector) CPI() InnerDirectorCPI {
+	return InnerDirectorCPI{Type: "docker", ExecPath: "/var/vcap/jobs/docker_cpi/bin/cpi"}
+}
+
+func (d *scriptInnerDirector) Exists() bool {
+	// If the inner BOSH has not been started, then the BOSH helper script will
+	// not exist.
+	exists, _ := fileExists(filepath.Join(d.dir, "bosh"))
+	return exists
+}
+
+func (d *scriptInnerDirector) Env() ([]string, error) {
+	creds, err := d.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	return creds.env(), nil
+}
+
+// Credentials reads the vars store written by start-inner-bosh-parallel.sh.
+func (d *scriptInnerDirector) Credentials() (InnerDirectorCredentials, error) {
+	path := filepath.Join(d.dir, "creds.yml")
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return InnerDirectorCredentials{}, bosherr.WrapErrorf(err, "Reading inner director vars store '%s'", path)
+	}
+
+	var creds struct {
+		AdminPassword string `yaml:"admin_password"`
+		DirectorSSL   struct {
+			CA string `yaml:"ca"`
+		} `yaml:"director_ssl"`
+		// bosh-deployment signs director_ssl with default_ca.
+		DefaultCA struct {
+			PrivateKey string `yaml:"private_key"`
+		} `yaml:"default_ca"`
+	}
+	if err := yaml.Unmarshal(contents, &creds); err != nil {
+		return InnerDirectorCredentials{}, bosherr.WrapErrorf(err, "Parsing inner director vars store '%s'", path)
+	}
+
+	return InnerDirectorCredentials{
+		URL:          fmt.Sprintf("https://%s:25555", d.directorIP),
+		CACert:       creds.DirectorSSL.CA,
+		Client:       "admin",
+		ClientSecret: creds.AdminPassword,
+		CAPrivateKey: creds.DefaultCA.PrivateKey,
+	}, nil
+}
+
+// CollectLogs archives the log directories on the director VM over
+// `bosh ssh`, since scp cannot read them as the ssh user, and copies the
+// archive back.
+func (d *scriptInnerDirector) CollectLogs(dest string) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return bosherr.WrapErrorf(err, "Creating '%s'", dest)
+	}
+
+	if err := copyFile(filepath.Join(d.dir, "bosh-director.yml"), filepath.Join(dest, "bosh-director.yml")); err != nil {
+		return err
+	}
+
+	const archive = "/tmp/brats-logs.tgz"
+	deployment := Resources{Slot: d.slot}.DirectorDeploymentName()
+
+	ssh := exec.Command(d.boshBinaryPath, "-d", deployment, "ssh", "bosh", "-c", fmt.Sprintf(
+		"cd /var/vcap/sys/log && sudo tar czf %[1]s $(ls -d %[2]s 2>/dev/null) && sudo chmod 644 %[1]s",
+		archive, strings.Join(innerDirectorLogDirs, " "),
+	))
+	if err := runCommand(ssh, d.out, d.collectTimeout); err != nil {
+		return bosherr.WrapError(err, "Archiving director logs")
+	}
+
+	scp := exec.Command(d.boshBinaryPath, "-d", deployment, "scp", "bosh:"+archive, dest)
+	if err := runCommand(scp, d.out, d.collectTimeout); err != nil {
+		return bosherr.WrapError(err, "Copying director logs")
+	}
+
+	localArchive := filepath.Join(dest, filepath.Base(archive))
+	if err := runCommand(exec.Command("tar", "xzf", localArchive, "-C", dest), d.out, d.collectTimeout); err != nil {
+		return bosherr.WrapError(err, "Extracting director logs")
+	}
+
+	return os.Remove(localArchive)
+}
+
+func (d *scriptInnerDirector) command(script string, args ...string) *exec.Cmd {
+	cmd := exec.Command(filepath.Join(d.scriptsPath, script), args...)
+	cmd.Env = append(os.Environ(), "inner_bosh_root="+filepath.Dir(d.dir))
+	return cmd
+}
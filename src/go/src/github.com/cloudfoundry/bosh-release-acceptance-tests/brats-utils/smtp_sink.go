@@ -0,0 +1,274 @@
+package bratsutils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// SMTPMessage is a message the SMTP sink accepted, along with how it was
+// delivered.
+type SMTPMessage struct {
+	From       string
+	Recipients []string
+	Header     mail.Header
+	Body       string
+
+	// TLS is whether the client switched to TLS with STARTTLS before sending
+	// the message, and Username who it authenticated as, if it did.
+	TLS        bool
+	Username   string
+	ReceivedAt time.Time
+}
+
+func (m SMTPMessage) Subject() string {
+	return m.Header.Get("Subject")
+}
+
+// SMTPSink accepts every message sent to it and keeps it instead of
+// delivering it. It takes any AUTH PLAIN credentials and, when started with
+// STARTTLS, upgrades connections with a self-signed certificate.
+type SMTPSink struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	mu       sync.Mutex
+	messages []SMTPMessage
+}
+
+// NewSMTPSink listens on a free port of host.
+func NewSMTPSink(host string, startTLS bool) (*SMTPSink, error) {
+	s := &SMTPSink{}
+
+	if startTLS {
+		cert, key, err := selfSignedCertificate("127.0.0.1")
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Loading SMTP sink certificate")
+		}
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Listening on '%s'", host)
+	}
+	s.listener = listener
+
+	go acceptConnections(listener, s.serve)
+	return s, nil
+}
+
+func (s *SMTPSink) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *SMTPSink) Close() error {
+	return s.listener.Close()
+}
+
+// Messages returns every message accepted so far.
+func (s *SMTPSink) Messages() []SMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SMTPMessage{}, s.messages...)
+}
+
+// Reset forgets every message accepted so far.
+func (s *SMTPSink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
+
+// smtpSession is the state of one connection.
+type smtpSession struct {
+	conn     *textproto.Conn
+	tls      bool
+	username string
+
+	from       string
+	recipients []string
+}
+
+func (s *SMTPSink) serve(conn net.Conn) {
+	session := &smtpSession{conn: textproto.NewConn(conn)}
+	defer func() { session.conn.Close() }()
+
+	session.reply(220, "brats ESMTP sink")
+
+	for {
+		line, err := session.conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, argument := line, ""
+		if i := strings.Index(line, " "); i >= 0 {
+			verb, argument = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			session.reply(250, "brats")
+		case "EHLO":
+			extensions := []string{"brats", "AUTH PLAIN"}
+			if s.tlsConfig != nil && !session.tls {
+				extensions = append(extensions, "STARTTLS")
+			}
+			for _, extension := range extensions[:len(extensions)-1] {
+				session.conn.PrintfLine("250-%s", extension)
+			}
+			session.reply(250, extensions[len(extensions)-1])
+		case "STARTTLS":
+			if s.tlsConfig == nil || session.tls {
+				session.reply(502, "STARTTLS not available")
+				continue
+			}
+			session.reply(220, "Ready to start TLS")
+
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			// The client starts over after the handshake.
+			session = &smtpSession{conn: textproto.NewConn(tlsConn), tls: true}
+		case "AUTH":
+			session.auth(argument)
+		case "MAIL":
+			session.from = smtpAddress(argument, "FROM:")
+			session.recipients = nil
+			session.reply(250, "OK")
+		case "RCPT":
+			session.recipients = append(session.recipients, smtpAddress(argument, "TO:"))
+			session.reply(250, "OK")
+		case "DATA":
+			if len(session.recipients) == 0 {
+				session.reply(503, "RCPT first")
+				continue
+			}
+			session.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+			data, err := ioutil.ReadAll(session.conn.DotReader())
+			if err != nil {
+				return
+			}
+			message, err := session.message(data)
+			if err != nil {
+				session.reply(554, err.Error())
+				continue
+			}
+
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+
+			session.from, session.recipients = "", nil
+			session.reply(250, "OK")
+		case "RSET":
+			session.from, session.recipients = "", nil
+			session.reply(250, "OK")
+		case "NOOP":
+			session.reply(250, "OK")
+		case "QUIT":
+			session.reply(221, "Bye")
+			return
+		default:
+			session.reply(502, "Command not implemented")
+		}
+	}
+}
+
+func (s *smtpSession) reply(code int, message string) {
+	s.conn.PrintfLine("%d %s", code, message)
+}
+
+// auth accepts AUTH PLAIN, with the credentials either on the same line or
+// after a continuation.
+func (s *smtpSession) auth(argument string) {
+	fields := strings.Fields(argument)
+	if len(fields) == 0 || strings.ToUpper(fields[0]) != "PLAIN" {
+		s.reply(504, "Only PLAIN is supported")
+		return
+	}
+
+	encoded := ""
+	if len(fields) > 1 {
+		encoded = fields[1]
+	} else {
+		s.reply(334, "")
+		line, err := s.conn.ReadLine()
+		if err != nil {
+			return
+		}
+		encoded = line
+	}
+
+	credentials, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		s.reply(501, "Malformed credentials")
+		return
+	}
+
+	// authorization identity \0 username \0 password
+	parts := bytes.Split(credentials, []byte{0})
+	if len(parts) != 3 {
+		s.reply(501, "Malformed credentials")
+		return
+	}
+
+	s.username = string(parts[1])
+	s.reply(235, "Authentication successful")
+}
+
+func (s *smtpSession) message(data []byte) (SMTPMessage, error) {
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return SMTPMessage{}, bosherr.WrapError(err, "Parsing message")
+	}
+
+	body, err := ioutil.ReadAll(parsed.Body)
+	if err != nil {
+		return SMTPMessage{}, bosherr.WrapError(err, "Reading message body")
+	}
+
+	return SMTPMessage{
+		From:       s.from,
+		Recipients: s.recipients,
+		Header:     parsed.Header,
+		Body:       string(body),
+		TLS:        s.tls,
+		Username:   s.username,
+		ReceivedAt: time.Now(),
+	}, nil
+}
+
+// smtpAddress extracts the address of a MAIL FROM:<address> or RCPT
+// TO:<address> argument.
+func smtpAddress(argument, prefix string) string {
+	if len(argument) >= len(prefix) && strings.EqualFold(argument[:len(prefix)], prefix) {
+		argument = argument[len(prefix):]
+	}
+	argument = strings.TrimSpace(argument)
+	if i := strings.Index(argument, ">"); strings.HasPrefix(argument, "<") && i > 0 {
+		return argument[1:i]
+	}
+
+	fields := strings.Fields(argument)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
@@ -0,0 +1,104 @@
+package bratsutils_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/smtp"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SMTPSink", func() {
+	const message = "From: hm@brats.test\r\n" +
+		"To: ops@brats.test, oncall@brats.test\r\n" +
+		"Subject: 2 alerts from BOSH Health Monitor\r\n" +
+		"\r\n" +
+		"first alert\r\n" +
+		".leading dot\r\n"
+
+	send := func(sink *bratsutils.SMTPSink, startTLS bool) error {
+		client, err := smtp.Dial(fmt.Sprintf("127.0.0.1:%d", sink.Port()))
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if err := client.Hello("brats.test"); err != nil {
+			return err
+		}
+		if startTLS {
+			if err := client.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+				return err
+			}
+		}
+		if err := client.Auth(smtp.PlainAuth("", "hm", "secret", "127.0.0.1")); err != nil {
+			return err
+		}
+		if err := client.Mail("hm@brats.test"); err != nil {
+			return err
+		}
+		for _, recipient := range []string{"ops@brats.test", "oncall@brats.test"} {
+			if err := client.Rcpt(recipient); err != nil {
+				return err
+			}
+		}
+
+		data, err := client.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := data.Write([]byte(message)); err != nil {
+			return err
+		}
+		if err := data.Close(); err != nil {
+			return err
+		}
+		return client.Quit()
+	}
+
+	It("captures messages sent over plain SMTP", func() {
+		sink, err := bratsutils.NewSMTPSink("127.0.0.1", false)
+		Expect(err).ToNot(HaveOccurred())
+		defer sink.Close()
+
+		Expect(send(sink, false)).To(Succeed())
+
+		messages := sink.Messages()
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].From).To(Equal("hm@brats.test"))
+		Expect(messages[0].Recipients).To(Equal([]string{"ops@brats.test", "oncall@brats.test"}))
+		Expect(messages[0].Subject()).To(Equal("2 alerts from BOSH Health Monitor"))
+		Expect(messages[0].Header.Get("To")).To(Equal("ops@brats.test, oncall@brats.test"))
+		Expect(messages[0].Body).To(Equal("first alert\n.leading dot\n"))
+		Expect(messages[0].TLS).To(BeFalse())
+		Expect(messages[0].Username).To(Equal("hm"))
+
+		sink.Reset()
+		Expect(sink.Messages()).To(BeEmpty())
+	})
+
+	It("captures messages sent after STARTTLS", func() {
+		sink, err := bratsutils.NewSMTPSink("127.0.0.1", true)
+		Expect(err).ToNot(HaveOccurred())
+		defer sink.Close()
+
+		Expect(send(sink, true)).To(Succeed())
+
+		messages := sink.Messages()
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].TLS).To(BeTrue())
+		Expect(messages[0].Username).To(Equal("hm"))
+	})
+
+	It("doesn't offer STARTTLS unless started with it", func() {
+		sink, err := bratsutils.NewSMTPSink("127.0.0.1", false)
+		Expect(err).ToNot(HaveOccurred())
+		defer sink.Close()
+
+		Expect(send(sink, true)).To(MatchError(ContainSubstring("STARTTLS")))
+		Expect(sink.Messages()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,326 @@
+package bratsutils
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const (
+	SyslogRFC5424 = "RFC5424"
+	SyslogRFC3164 = "RFC3164"
+)
+
+// SyslogMessage is a parsed syslog message. RFC3164 messages have no
+// structured data, process ID or message ID, and their timestamps no year.
+type SyslogMessage struct {
+	Format    string
+	Facility  int
+	Severity  int
+	Timestamp time.Time
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+
+	// StructuredData maps the ID of every element, like "instance@47450",
+	// to its parameters.
+	StructuredData map[string]map[string]string
+
+	Message string
+}
+
+// SyslogReceiver accepts syslog messages over both TCP and UDP on the same
+// port. Over TCP it takes both octet-counted and newline-terminated frames
+// (RFC6587), which is what rsyslog sends depending on its template.
+type SyslogReceiver struct {
+	listener net.Listener
+	packets  net.PacketConn
+
+	mu  sync.Mutex
+	raw []string
+}
+
+func NewSyslogReceiver(host string) (*SyslogReceiver, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Listening on '%s'", host)
+	}
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	packets, err := net.ListenPacket("udp", net.JoinHostPort(host, port))
+	if err != nil {
+		listener.Close()
+		return nil, bosherr.WrapErrorf(err, "Listening for UDP on port %s", port)
+	}
+
+	r := &SyslogReceiver{listener: listener, packets: packets}
+	go acceptConnections(listener, r.readTCP)
+	go r.readUDP()
+	return r, nil
+}
+
+func (r *SyslogReceiver) Port() int {
+	return r.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (r *SyslogReceiver) Close() error {
+	r.packets.Close()
+	return r.listener.Close()
+}
+
+// Raw returns every message received so far, as it came in.
+func (r *SyslogReceiver) Raw() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.raw...)
+}
+
+// Messages returns the messages received so far that parse as either
+// RFC5424 or RFC3164.
+func (r *SyslogReceiver) Messages() []SyslogMessage {
+	var messages []SyslogMessage
+	for _, raw := range r.Raw() {
+		message, err := ParseSyslogMessage(raw)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// Reset forgets every message received so far.
+func (r *SyslogReceiver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.raw = nil
+}
+
+func (r *SyslogReceiver) record(message string) {
+	message = strings.TrimRight(message, "\r\n\x00")
+	if message == "" {
+		return
+	}
+
+	r.mu.Lock()
+	r.raw = append(r.raw, message)
+	r.mu.Unlock()
+}
+
+func (r *SyslogReceiver) readTCP(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+
+		// An octet-counted frame starts with its length, a message with "<".
+		if first[0] >= '1' && first[0] <= '9' {
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil {
+				return
+			}
+
+			message := make([]byte, n)
+			if _, err := io.ReadFull(reader, message); err != nil {
+				return
+			}
+			r.record(string(message))
+			continue
+		}
+
+		line, err := reader.ReadString('\n')
+		r.record(line)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *SyslogReceiver) readUDP() {
+	buffer := make([]byte, 65536)
+	for {
+		n, _, err := r.packets.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		r.record(string(buffer[:n]))
+	}
+}
+
+// ParseSyslogMessage parses an RFC5424 message, or failing that an RFC3164
+// one.
+func ParseSyslogMessage(raw string) (SyslogMessage, error) {
+	if !strings.HasPrefix(raw, "<") {
+		return SyslogMessage{}, bosherr.Errorf("Expected syslog message '%s' to start with a priority", raw)
+	}
+	end := strings.Index(raw, ">")
+	if end < 2 || end > 4 {
+		return SyslogMessage{}, bosherr.Errorf("Expected syslog message '%s' to start with a priority", raw)
+	}
+	priority, err := strconv.Atoi(raw[1:end])
+	if err != nil || priority > 191 {
+		return SyslogMessage{}, bosherr.Errorf("Invalid priority '%s'", raw[1:end])
+	}
+
+	message := SyslogMessage{Facility: priority / 8, Severity: priority % 8}
+	rest := raw[end+1:]
+
+	if strings.HasPrefix(rest, "1 ") {
+		return parseRFC5424(message, rest[2:])
+	}
+	return parseRFC3164(message, rest)
+}
+
+func parseRFC5424(message SyslogMessage, rest string) (SyslogMessage, error) {
+	message.Format = SyslogRFC5424
+
+	fields := make([]string, 5)
+	for i := range fields {
+		space := strings.Index(rest, " ")
+		if space < 0 {
+			return SyslogMessage{}, bosherr.Errorf("Expected an RFC5424 header in '%s'", rest)
+		}
+		fields[i], rest = rest[:space], rest[space+1:]
+	}
+
+	if fields[0] != "-" {
+		timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return SyslogMessage{}, bosherr.WrapErrorf(err, "Parsing timestamp '%s'", fields[0])
+		}
+		message.Timestamp = timestamp
+	}
+	message.Hostname = nilValue(fields[1])
+	message.AppName = nilValue(fields[2])
+	message.ProcID = nilValue(fields[3])
+	message.MsgID = nilValue(fields[4])
+
+	structuredData, rest, err := parseStructuredData(rest)
+	if err != nil {
+		return SyslogMessage{}, err
+	}
+	message.StructuredData = structuredData
+	message.Message = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\xef\xbb\xbf")
+
+	return message, nil
+}
+
+func nilValue(field string) string {
+	if field == "-" {
+		return ""
+	}
+	return field
+}
+
+// parseStructuredData parses the elements at the start of rest and returns
+// what follows them.
+func parseStructuredData(rest string) (map[string]map[string]string, string, error) {
+	elements := map[string]map[string]string{}
+
+	if strings.HasPrefix(rest, "-") {
+		return elements, rest[1:], nil
+	}
+
+	for strings.HasPrefix(rest, "[") {
+		rest = rest[1:]
+
+		idEnd := strings.IndexAny(rest, " ]")
+		if idEnd <= 0 {
+			return nil, "", bosherr.Error("Expected a structured data ID")
+		}
+		id := rest[:idEnd]
+		params := map[string]string{}
+		rest = rest[idEnd:]
+
+		for strings.HasPrefix(rest, " ") {
+			rest = rest[1:]
+
+			nameEnd := strings.Index(rest, `="`)
+			if nameEnd <= 0 {
+				return nil, "", bosherr.Errorf("Expected a parameter in structured data element '%s'", id)
+			}
+			name := rest[:nameEnd]
+			rest = rest[nameEnd+2:]
+
+			var value []byte
+			closed := false
+			for i := 0; i < len(rest); i++ {
+				if rest[i] == '\\' && i+1 < len(rest) && strings.IndexByte(`"\]`, rest[i+1]) >= 0 {
+					value = append(value, rest[i+1])
+					i++
+					continue
+				}
+				if rest[i] == '"' {
+					rest = rest[i+1:]
+					closed = true
+					break
+				}
+				value = append(value, rest[i])
+			}
+			if !closed {
+				return nil, "", bosherr.Errorf("Unterminated value of parameter '%s'", name)
+			}
+			params[name] = string(value)
+		}
+
+		if !strings.HasPrefix(rest, "]") {
+			return nil, "", bosherr.Errorf("Unterminated structured data element '%s'", id)
+		}
+		rest = rest[1:]
+		elements[id] = params
+	}
+
+	if len(elements) == 0 {
+		return nil, "", bosherr.Error("Expected structured data or '-'")
+	}
+	return elements, rest, nil
+}
+
+// parseRFC3164 parses "Mmm dd hh:mm:ss hostname tag[pid]: message".
+func parseRFC3164(message SyslogMessage, rest string) (SyslogMessage, error) {
+	message.Format = SyslogRFC3164
+
+	if len(rest) < len(time.Stamp)+1 {
+		return SyslogMessage{}, bosherr.Errorf("Expected an RFC3164 header in '%s'", rest)
+	}
+	timestamp, err := time.Parse(time.Stamp, rest[:len(time.Stamp)])
+	if err != nil {
+		return SyslogMessage{}, bosherr.WrapErrorf(err, "Parsing timestamp '%s'", rest[:len(time.Stamp)])
+	}
+	message.Timestamp = timestamp
+	rest = strings.TrimPrefix(rest[len(time.Stamp):], " ")
+
+	space := strings.Index(rest, " ")
+	if space <= 0 {
+		return SyslogMessage{}, bosherr.Errorf("Expected a hostname in '%s'", rest)
+	}
+	message.Hostname, rest = rest[:space], rest[space+1:]
+
+	if colon := strings.Index(rest, ": "); colon > 0 && !strings.Contains(rest[:colon], " ") {
+		tag := rest[:colon]
+		if open := strings.Index(tag, "["); open > 0 && strings.HasSuffix(tag, "]") {
+			message.ProcID = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		message.AppName = tag
+		rest = rest[colon+2:]
+	}
+	message.Message = rest
+
+	return message, nil
+}
@@ -0,0 +1,130 @@
+package bratsutils_test
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SyslogReceiver", func() {
+	const forwarded = `<14>1 2018-03-01T12:34:56.789Z 10.244.0.2 health_monitor - - ` +
+		`[instance@47450 director="" deployment="bosh" group="bosh" az="z1" id="a-b\"c\]"] ` +
+		`I, [2018-03-01T12:34:56]  INFO : [ALERT] Alert @ 2018-03-01 12:34:56 UTC, severity 4: Finish update deployment`
+
+	Describe("ParseSyslogMessage", func() {
+		It("parses RFC5424 messages with structured data", func() {
+			message, err := bratsutils.ParseSyslogMessage(forwarded)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(message.Format).To(Equal(bratsutils.SyslogRFC5424))
+			Expect(message.Facility).To(Equal(1))
+			Expect(message.Severity).To(Equal(6))
+			Expect(message.Timestamp).To(Equal(time.Date(2018, 3, 1, 12, 34, 56, 789000000, time.UTC)))
+			Expect(message.Hostname).To(Equal("10.244.0.2"))
+			Expect(message.AppName).To(Equal("health_monitor"))
+			Expect(message.ProcID).To(BeEmpty())
+			Expect(message.MsgID).To(BeEmpty())
+			Expect(message.StructuredData).To(Equal(map[string]map[string]string{
+				"instance@47450": {"director": "", "deployment": "bosh", "group": "bosh", "az": "z1", "id": `a-b"c]`},
+			}))
+			Expect(message.Message).To(HavePrefix("I, [2018-03-01T12:34:56]"))
+		})
+
+		It("parses RFC5424 messages without structured data", func() {
+			message, err := bratsutils.ParseSyslogMessage("<165>1 - host app 42 ID47 - hello")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(message.Facility).To(Equal(20))
+			Expect(message.Severity).To(Equal(5))
+			Expect(message.Timestamp).To(BeZero())
+			Expect(message.ProcID).To(Equal("42"))
+			Expect(message.MsgID).To(Equal("ID47"))
+			Expect(message.StructuredData).To(BeEmpty())
+			Expect(message.Message).To(Equal("hello"))
+		})
+
+		It("parses RFC3164 messages", func() {
+			message, err := bratsutils.ParseSyslogMessage("<30>Mar  1 12:34:56 bosh-vm monit[1234]: 'agent' process is running")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(message.Format).To(Equal(bratsutils.SyslogRFC3164))
+			Expect(message.Facility).To(Equal(3))
+			Expect(message.Severity).To(Equal(6))
+			Expect(message.Timestamp.Month()).To(Equal(time.March))
+			Expect(message.Timestamp.Day()).To(Equal(1))
+			Expect(message.Hostname).To(Equal("bosh-vm"))
+			Expect(message.AppName).To(Equal("monit"))
+			Expect(message.ProcID).To(Equal("1234"))
+			Expect(message.Message).To(Equal("'agent' process is running"))
+		})
+
+		It("rejects messages without a priority", func() {
+			_, err := bratsutils.ParseSyslogMessage("1 2018-03-01T12:34:56Z host app - - - hello")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects unterminated structured data", func() {
+			_, err := bratsutils.ParseSyslogMessage(`<14>1 - host app - - [instance@47450 id="a`)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("receiving", func() {
+		var receiver *bratsutils.SyslogReceiver
+
+		BeforeEach(func() {
+			var err error
+			receiver, err = bratsutils.NewSyslogReceiver("127.0.0.1")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			receiver.Close()
+		})
+
+		It("records messages sent over UDP", func() {
+			conn, err := net.Dial("udp", fmt.Sprintf("127.0.0.1:%d", receiver.Port()))
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			_, err = conn.Write([]byte(forwarded))
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(receiver.Messages).Should(HaveLen(1))
+			Expect(receiver.Messages()[0].AppName).To(Equal("health_monitor"))
+		})
+
+		It("records octet-counted and newline-terminated messages sent over TCP", func() {
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", receiver.Port()))
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			_, err = fmt.Fprintf(conn, "%d %s<14>1 - host app - - - second\n", len(forwarded), forwarded)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(receiver.Messages).Should(HaveLen(2))
+			Expect(receiver.Messages()[0].StructuredData).To(HaveKey("instance@47450"))
+			Expect(receiver.Messages()[1].Message).To(Equal("second"))
+		})
+
+		It("keeps messages it can't parse apart", func() {
+			conn, err := net.Dial("udp", fmt.Sprintf("127.0.0.1:%d", receiver.Port()))
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			_, err = conn.Write([]byte("not syslog"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(receiver.Raw).Should(Equal([]string{"not syslog"}))
+			Expect(receiver.Messages()).To(BeEmpty())
+
+			receiver.Reset()
+			Expect(receiver.Raw()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,248 @@
+package bratsutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"github.com/onsi/gomega/gexec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// TaskDirector is the part of the director API the task tracker relies on.
+type TaskDirector interface {
+	Task(id int) (director.Task, error)
+	Tasks(filter director.TasksFilter) ([]director.Task, error)
+	TaskOutput(id int, outputType string) (string, error)
+}
+
+type TaskResult struct {
+	ID          int
+	State       string
+	Description string
+	Result      string
+	Duration    time.Duration
+
+	// DebugLog is only fetched when the task did not succeed.
+	DebugLog string
+}
+
+func (r TaskResult) Succeeded() bool {
+	return r.State == "done"
+}
+
+func (r TaskResult) String() string {
+	summary := fmt.Sprintf("Task %d '%s' finished in state '%s' after %s: %s", r.ID, r.Description, r.State, r.Duration, r.Result)
+	if r.DebugLog != "" {
+		summary += "\n\nDebug log:\n" + r.DebugLog
+	}
+	return summary
+}
+
+type TaskTracker struct {
+	director     TaskDirector
+	out          io.Writer
+	pollInterval time.Duration
+}
+
+func NewTaskTracker(director TaskDirector, out io.Writer, pollInterval time.Duration) *TaskTracker {
+	return &TaskTracker{
+		director:     director,
+		out:          out,
+		pollInterval: pollInterval,
+	}
+}
+
+// Follow polls the task until the director reports it finished, writing new
+// event output as it arrives. It only returns an error if the director could
+// not be queried or the timeout elapsed; a failed task is a valid result.
+func (t *TaskTracker) Follow(taskID int, timeout time.Duration) (TaskResult, error) {
+	startedAt := time.Now()
+	deadline := startedAt.Add(timeout)
+	eventOffset := 0
+
+	for {
+		task, err := t.director.Task(taskID)
+		if err != nil {
+			return TaskResult{}, bosherr.WrapErrorf(err, "Fetching task %d", taskID)
+		}
+
+		events, err := t.director.TaskOutput(taskID, director.TaskOutputEvent)
+		if err != nil {
+			return TaskResult{}, bosherr.WrapErrorf(err, "Fetching event output of task %d", taskID)
+		}
+		if len(events) > eventOffset {
+			t.writeEvents(taskID, events[eventOffset:])
+			eventOffset = len(events)
+		}
+
+		if !task.IsRunning() {
+			return t.result(task, time.Since(startedAt))
+		}
+
+		if time.Now().After(deadline) {
+			return TaskResult{}, bosherr.Errorf("Timed out after %s waiting for task %d in state '%s'", timeout, taskID, task.State)
+		}
+
+		time.Sleep(t.pollInterval)
+	}
+}
+
+// LatestTaskID returns the id of the most recently created task for the
+// deployment, among the types the CLI lists by default.
+func (t *TaskTracker) LatestTaskID(deployment string) (int, error) {
+	tasks, err := t.director.Tasks(director.TasksFilter{Deployment: deployment, Limit: 1})
+	if err != nil {
+		return 0, bosherr.WrapErrorf(err, "Listing tasks for deployment '%s'", deployment)
+	}
+
+	if len(tasks) == 0 {
+		return 0, bosherr.Errorf("Deployment '%s' has no tasks", deployment)
+	}
+
+	return tasks[0].ID, nil
+}
+
+func (t *TaskTracker) result(task director.Task, observed time.Duration) (TaskResult, error) {
+	result := TaskResult{
+		ID:          task.ID,
+		State:       task.State,
+		Description: task.Description,
+		Result:      task.Result,
+		Duration:    observed,
+	}
+
+	// The director bumps the timestamp when a task finishes, which makes it a
+	// better measure than how long we happened to be polling.
+	if task.StartedAt != nil && task.Timestamp >= *task.StartedAt {
+		result.Duration = time.Duration(task.Timestamp-*task.StartedAt) * time.Second
+	}
+
+	if !result.Succeeded() {
+		debugLog, err := t.director.TaskOutput(task.ID, director.TaskOutputDebug)
+		if err != nil {
+			return TaskResult{}, bosherr.WrapErrorf(err, "Fetching debug output of task %d", task.ID)
+		}
+		result.DebugLog = debugLog
+
+		fmt.Fprintf(t.out, "Task %d | %s\n%s\n", task.ID, task.State, debugLog)
+	}
+
+	return result, nil
+}
+
+type taskEvent struct {
+	Time     int64    `json:"time"`
+	Stage    string   `json:"stage"`
+	Tags     []string `json:"tags"`
+	Task     string   `json:"task"`
+	State    string   `json:"state"`
+	Type     string   `json:"type"`
+	Message  string   `json:"message"`
+	Progress int      `json:"progress"`
+	Error    *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (t *TaskTracker) writeEvents(taskID int, output string) {
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+		fmt.Fprintln(t.out, formatTaskEvent(taskID, line))
+	}
+}
+
+func formatTaskEvent(taskID int, line string) string {
+	var event taskEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return fmt.Sprintf("Task %d | %s", taskID, line)
+	}
+
+	prefix := fmt.Sprintf("Task %d | %s |", taskID, time.Unix(event.Time, 0).UTC().Format("15:04:05"))
+
+	switch {
+	case event.Error != nil:
+		return fmt.Sprintf("%s Error: %s (code %d)", prefix, event.Error.Message, event.Error.Code)
+	case event.Type == "deprecation" || event.Type == "warning":
+		return fmt.Sprintf("%s %s: %s", prefix, event.Type, event.Message)
+	case len(event.Tags) > 0:
+		return fmt.Sprintf("%s %s %s: %s (%s)", prefix, event.Stage, strings.Join(event.Tags, ", "), event.Task, event.State)
+	default:
+		return fmt.Sprintf("%s %s: %s (%s)", prefix, event.Stage, event.Task, event.State)
+	}
+}
+
+// TrackTask follows a task of the inner director to completion, streaming its
+// events to GinkgoWriter.
+func TrackTask(taskID int, timeout time.Duration) TaskResult {
+	result, err := NewTaskTracker(Director(), GinkgoWriter, 2*time.Second).Follow(taskID, timeout)
+	Expect(err).ToNot(HaveOccurred())
+	return result
+}
+
+var cliTaskPattern = regexp.MustCompile(`(?m)^Task (\d+)$`)
+
+// CLITaskID returns the task a CLI command started, from the line it prints
+// before following it.
+func CLITaskID(output string) (int, bool) {
+	match := cliTaskPattern.FindStringSubmatch(output)
+	if match == nil {
+		return 0, false
+	}
+
+	taskID, err := strconv.Atoi(match[1])
+	return taskID, err == nil
+}
+
+// TrackLatestTask follows the most recent task for the deployment. Calling it
+// once the CLI has exited turns a bare exit status into the director's error.
+func TrackLatestTask(deployment string, timeout time.Duration) TaskResult {
+	tracker := NewTaskTracker(Director(), GinkgoWriter, 2*time.Second)
+
+	taskID, err := tracker.LatestTaskID(deployment)
+	Expect(err).ToNot(HaveOccurred())
+
+	result, err := tracker.Follow(taskID, timeout)
+	Expect(err).ToNot(HaveOccurred())
+	return result
+}
+
+// ExpectDeployExit waits for a CLI deploy to exit and, if the exit status is
+// not the expected one, fails with the director's account of what happened.
+func ExpectDeployExit(session *gexec.Session, deployment string, timeout time.Duration, expectedExitCode int) {
+	defer StartPhase(PhaseDeploy)()
+
+	Eventually(session, timeout).Should(gexec.Exit())
+
+	if session.ExitCode() != expectedExitCode {
+		Expect(session.ExitCode()).To(Equal(expectedExitCode), "Deploying '%s' exited with %d\n\n%s",
+			deployment, session.ExitCode(), deployTaskSummary(session))
+	}
+}
+
+// deployTaskSummary describes the task a failed CLI deploy ran. Not finding
+// it is part of the summary rather than a failure of its own, which would
+// hide the exit status.
+func deployTaskSummary(session *gexec.Session) string {
+	taskID, found := CLITaskID(string(session.Out.Contents()))
+	if !found {
+		return "The CLI started no task"
+	}
+
+	result, err := NewTaskTracker(Director(), GinkgoWriter, 2*time.Second).Follow(taskID, time.Minute)
+	if err != nil {
+		return fmt.Sprintf("Following task %d: %s", taskID, err)
+	}
+	return result.String()
+}
@@ -0,0 +1,155 @@
+package bratsutils_test
+
+import (
+	"errors"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	"github.com/onsi/gomega/gbytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// taskPoll is what the fake director answers for one poll of the task.
+type taskPoll struct {
+	task   director.Task
+	events string
+}
+
+type fakeTaskDirector struct {
+	polls       []taskPoll
+	next        int
+	last        int
+	debugLog    string
+	tasks       []director.Task
+	tasksFilter director.TasksFilter
+	taskErr     error
+}
+
+func (f *fakeTaskDirector) Task(id int) (director.Task, error) {
+	if f.taskErr != nil {
+		return director.Task{}, f.taskErr
+	}
+
+	f.last = f.next
+	if f.next < len(f.polls)-1 {
+		f.next++
+	}
+	return f.polls[f.last].task, nil
+}
+
+func (f *fakeTaskDirector) Tasks(filter director.TasksFilter) ([]director.Task, error) {
+	f.tasksFilter = filter
+	return f.tasks, nil
+}
+
+func (f *fakeTaskDirector) TaskOutput(id int, outputType string) (string, error) {
+	if outputType == director.TaskOutputDebug {
+		return f.debugLog, nil
+	}
+	return f.polls[f.last].events, nil
+}
+
+var _ = Describe("TaskTracker", func() {
+	var (
+		fake    *fakeTaskDirector
+		out     *gbytes.Buffer
+		tracker *bratsutils.TaskTracker
+	)
+
+	started := int64(1500000000)
+
+	BeforeEach(func() {
+		fake = &fakeTaskDirector{debugLog: "D, [2018-01-01] DEBUG -- boom"}
+		out = gbytes.NewBuffer()
+		tracker = bratsutils.NewTaskTracker(fake, out, time.Millisecond)
+	})
+
+	It("streams each event once and returns the finished task", func() {
+		startedEvent := `{"time":1500000000,"stage":"Updating instance","tags":["provider"],"task":"provider/abc (0)","state":"started"}` + "\n"
+		finishedEvent := `{"time":1500000090,"stage":"Updating instance","tags":["provider"],"task":"provider/abc (0)","state":"finished"}` + "\n"
+
+		fake.polls = []taskPoll{
+			{task: director.Task{ID: 5, State: "queued", Description: "create deployment"}},
+			{task: director.Task{ID: 5, State: "processing", Description: "create deployment", StartedAt: &started}, events: startedEvent},
+			{task: director.Task{ID: 5, State: "done", Description: "create deployment", StartedAt: &started, Timestamp: started + 90, Result: "/deployments/dns"}, events: startedEvent + finishedEvent},
+		}
+
+		result, err := tracker.Follow(5, time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.Succeeded()).To(BeTrue())
+		Expect(result.Result).To(Equal("/deployments/dns"))
+		Expect(result.Duration).To(Equal(90 * time.Second))
+		Expect(result.DebugLog).To(BeEmpty())
+
+		Expect(out).To(gbytes.Say(`Task 5 \| 02:40:00 \| Updating instance provider: provider/abc \(0\) \(started\)`))
+		Expect(out).To(gbytes.Say(`Task 5 \| 02:41:30 \| Updating instance provider: provider/abc \(0\) \(finished\)`))
+		Expect(out).ToNot(gbytes.Say(`started`))
+	})
+
+	It("attaches the debug log when the task fails", func() {
+		fake.polls = []taskPoll{{
+			task:   director.Task{ID: 6, State: "error", Description: "create deployment", Result: "Action Failed get_task"},
+			events: `{"time":1500000000,"error":{"code":450001,"message":"Action Failed get_task"}}`,
+		}}
+
+		result, err := tracker.Follow(6, time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.Succeeded()).To(BeFalse())
+		Expect(result.DebugLog).To(Equal(fake.debugLog))
+		Expect(result.String()).To(ContainSubstring("finished in state 'error'"))
+		Expect(result.String()).To(ContainSubstring("DEBUG -- boom"))
+
+		Expect(out).To(gbytes.Say(`Error: Action Failed get_task \(code 450001\)`))
+		Expect(out).To(gbytes.Say(`DEBUG -- boom`))
+	})
+
+	It("times out when the task keeps running", func() {
+		fake.polls = []taskPoll{{task: director.Task{ID: 7, State: "processing"}}}
+
+		_, err := tracker.Follow(7, 10*time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("Timed out")))
+	})
+
+	It("returns errors from the director", func() {
+		fake.taskErr = errors.New("connection refused")
+
+		_, err := tracker.Follow(8, time.Minute)
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+	})
+
+	Describe("LatestTaskID", func() {
+		It("returns the newest task of the deployment", func() {
+			fake.tasks = []director.Task{{ID: 12}}
+
+			taskID, err := tracker.LatestTaskID("dns")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(taskID).To(Equal(12))
+			Expect(fake.tasksFilter).To(Equal(director.TasksFilter{Deployment: "dns", Limit: 1}))
+		})
+
+		It("fails when the deployment has no tasks", func() {
+			_, err := tracker.LatestTaskID("dns")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("CLITaskID", func() {
+		It("finds the task the CLI followed", func() {
+			output := "Using deployment 'dns'\n\nTask 17\n\nTask 17 | 10:00:00 | Preparing deployment: Preparing deployment (00:00:01)\n\nTask 17 done\n"
+
+			taskID, found := bratsutils.CLITaskID(output)
+			Expect(found).To(BeTrue())
+			Expect(taskID).To(Equal(17))
+		})
+
+		It("finds nothing when the CLI started no task", func() {
+			_, found := bratsutils.CLITaskID("Expected manifest to specify deployment name\n\nExit code 1\n")
+			Expect(found).To(BeFalse())
+		})
+	})
+})
@@ -7,12 +7,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/onsi/ginkgo/config"
-	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 
 	. "github.com/onsi/ginkgo"
@@ -47,25 +44,49 @@ var (
 	innerDirectorIP,
 	innerDirectorUser,
 	boshDirectorReleasePath,
+	boshDeploymentPath,
 	stemcellOS string
+
+	innerDirector       InnerDirector
+	innerDirectorOutput *CapturingWriter
+	innerDirectorPool   *InnerDirectorPool
 )
 
 func Bootstrap() {
-	outerBoshBinaryPath = AssertEnvExists("BOSH_BINARY_PATH")
+	RequireConfig(
+		ConfigBoshBinaryPath,
+		ConfigBoshEnvironment,
+		ConfigBoshDeploymentPath,
+		ConfigBoshDirectorReleasePath,
+		ConfigStemcellOS,
+	)
+	suite := SuiteConfig()
+
+	outerBoshBinaryPath = suite.BoshBinaryPath
+
+	resources := LeaseResources()
 
 	innerDirectorUser = "jumpbox"
-	innerBoshPath = fmt.Sprintf("/tmp/inner-bosh/director/%d", config.GinkgoConfig.ParallelNode)
+	innerBoshPath = suite.InnerDirectorPath(resources)
 	boshBinaryPath = filepath.Join(innerBoshPath, "bosh")
 	innerBoshJumpboxPrivateKeyPath = filepath.Join(innerBoshPath, "jumpbox_private_key.pem")
-	innerDirectorIP = fmt.Sprintf("10.245.0.%d", 10+config.GinkgoConfig.ParallelNode)
-	boshDirectorReleasePath = AssertEnvExists("BOSH_DIRECTOR_RELEASE_PATH")
-	stemcellOS = AssertEnvExists("STEMCELL_OS")
+	innerDirectorIP = resources.DirectorIP()
+	boshDirectorReleasePath = suite.BoshDirectorReleasePath
+	boshDeploymentPath = suite.BoshDeploymentPath
+	stemcellOS = suite.StemcellOS
+
+	var err error
+	innerDirectorOutput = NewCapturingWriter(GinkgoWriter)
+	innerDirector, err = NewInnerDirector(suite, resources, innerDirectorOutput)
+	Expect(err).ToNot(HaveOccurred())
 
-	AssertEnvExists("BOSH_ENVIRONMENT")
-	AssertEnvExists("BOSH_DEPLOYMENT_PATH")
+	innerDirectorPool = NewInnerDirectorPool(innerDirector, filepath.Join(innerBoshPath, "fingerprint"), innerBoshReset{}, GinkgoWriter)
 }
 
 func LoadExternalDBConfig(DBaaS string, mutualTLSEnabled bool, tmpCertDir string) *ExternalDBConfig {
+	RequireConfig(ExternalDBConfigFields(DBaaS, mutualTLSEnabled)...)
+	settings := SuiteConfig().ExternalDB(DBaaS)
+
 	var databaseType string
 	if strings.HasSuffix(DBaaS, mysqlDBType) {
 		databaseType = mysqlDBType
@@ -75,15 +96,15 @@ func LoadExternalDBConfig(DBaaS string, mutualTLSEnabled bool, tmpCertDir string
 
 	config := ExternalDBConfig{
 		Type:                  databaseType,
-		Host:                  AssertEnvExists(fmt.Sprintf("%s_EXTERNAL_DB_HOST", strings.ToUpper(DBaaS))),
-		User:                  AssertEnvExists(fmt.Sprintf("%s_EXTERNAL_DB_USER", strings.ToUpper(DBaaS))),
-		Password:              AssertEnvExists(fmt.Sprintf("%s_EXTERNAL_DB_PASSWORD", strings.ToUpper(DBaaS))),
-		DBName:                fmt.Sprintf("db_%s_%d", databaseType, config.GinkgoConfig.ParallelNode),
+		Host:                  settings.Host,
+		User:                  settings.User,
+		Password:              settings.Password,
+		DBName:                LeaseResources().DBName(databaseType),
 		ConnectionVarFile:     fmt.Sprintf("external_db/%s.yml", DBaaS),
 		ConnectionOptionsFile: fmt.Sprintf("external_db/%s_connection_options.yml", DBaaS),
 	}
 
-	caContents := []byte(os.Getenv(fmt.Sprintf("%s_EXTERNAL_DB_CA", strings.ToUpper(DBaaS))))
+	caContents := []byte(settings.CA)
 	if len(caContents) == 0 {
 		var err error
 		caContents, err = exec.Command(outerBoshBinaryPath, "int", AssetPath(config.ConnectionVarFile), "--path", "/db_ca").Output()
@@ -99,8 +120,8 @@ func LoadExternalDBConfig(DBaaS string, mutualTLSEnabled bool, tmpCertDir string
 	config.CACertPath = caFile.Name()
 
 	if mutualTLSEnabled {
-		clientCertContents := AssertEnvExists(fmt.Sprintf("%s_EXTERNAL_DB_CLIENT_CERTIFICATE", strings.ToUpper(DBaaS)))
-		clientKeyContents := AssertEnvExists(fmt.Sprintf("%s_EXTERNAL_DB_CLIENT_PRIVATE_KEY", strings.ToUpper(DBaaS)))
+		clientCertContents := settings.ClientCertificate
+		clientKeyContents := settings.ClientPrivateKey
 
 		clientCertFile, err := ioutil.TempFile(tmpCertDir, "client_cert")
 		Expect(err).ToNot(HaveOccurred())
@@ -300,69 +321,90 @@ func StartInnerBosh(args ...string) {
 }
 
 func StartInnerBoshWithExpectation(expectedFailure bool, expectedErrorToMatch string, args ...string) {
-	effectiveArgs := []string{strconv.Itoa(config.GinkgoConfig.ParallelNode)}
-	effectiveArgs = append(effectiveArgs, args...)
+	defer StartPhase(PhaseInnerDirectorStart)()
 
-	if stemcellOS == "ubuntu-xenial" {
-		effectiveArgs = append(effectiveArgs, "-o", AssetPath("inner-bosh-xenial-ops.yml"))
+	opsFiles, vars := splitInnerBoshArgs(args)
+
+	// The xenial ops file targets the bosh-deployment manifest, which only the
+	// script driver deploys.
+	if _, scripted := innerDirector.(*scriptInnerDirector); scripted && stemcellOS == "ubuntu-xenial" {
+		opsFiles = append(opsFiles, AssetPath("inner-bosh-xenial-ops.yml"))
 	}
 
-	cmd := exec.Command(
-		fmt.Sprintf("../../../../../../../ci/docker/main-bosh-docker/start-inner-bosh-parallel.sh"),
-		effectiveArgs...,
-	)
-	cmd.Env = os.Environ()
+	if expectedFailure {
+		Expect(innerDirectorPool.Invalidate()).To(Succeed())
+
+		// The error only has the end of the output, and the expected error
+		// may come long before it.
+		stopCapture := innerDirectorOutput.Capture()
+		err := innerDirector.Start(opsFiles, vars)
+		output := stopCapture()
+
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error() + "\n" + output).To(MatchRegexp(expectedErrorToMatch))
+		return
+	}
 
-	session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+	reused, err := innerDirectorPool.Acquire(opsFiles, vars)
 	Expect(err).ToNot(HaveOccurred())
+	if reused {
+		fmt.Fprintln(GinkgoWriter, "Reusing the inner director, its configuration has not changed")
+	}
+}
 
-	if expectedFailure {
-		Eventually(session, 25*time.Minute).Should(gbytes.Say(expectedErrorToMatch))
-		Eventually(session, 25*time.Minute).Should(gexec.Exit(1))
-	} else {
-		Eventually(session, 25*time.Minute).Should(gexec.Exit(0))
+// innerBoshReset resets the inner director for the pool to reuse it without
+// redeploying. Each call needs a new client, since redeploying the director
+// changes its credentials.
+type innerBoshReset struct{}
+
+func (innerBoshReset) Snapshot() error {
+	return withDirectorReset(DirectorReset.Snapshot)
+}
+
+func (innerBoshReset) Reset() error {
+	return withDirectorReset(DirectorReset.Reset)
+}
+
+func withDirectorReset(step func(DirectorReset) error) error {
+	client, err := newDirectorClient()
+	if err != nil {
+		return err
 	}
+
+	return step(DirectorReset{
+		Director:        client,
+		Tracker:         NewTaskTracker(client, GinkgoWriter, 2*time.Second),
+		TaskTimeout:     5 * time.Minute,
+		CloudConfigPath: filepath.Join(innerBoshPath, "cloud-config.yml"),
+	})
 }
 
 func CreateAndUploadBOSHRelease() {
-	cmd := exec.Command(
-		fmt.Sprintf("../../../../../../../ci/docker/main-bosh-docker/create-and-upload-release.sh"),
-		strconv.Itoa(config.GinkgoConfig.ParallelNode),
-	)
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, fmt.Sprintf("bosh_release_path=%s", boshDirectorReleasePath))
-
-	session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
-	Expect(err).ToNot(HaveOccurred())
-	Eventually(session, 5*time.Minute).Should(gexec.Exit(0))
+	defer StartPhase(PhasePrepare)()
+	Expect(innerDirector.Prepare()).To(Succeed())
 }
 
+// StopInnerBosh first collects the artifacts of a failed spec, which would
+// be gone by the time the top-level AfterEach gets to them.
 func StopInnerBosh() {
-	session, err := gexec.Start(
-		exec.Command(
-			"../../../../../../../ci/docker/main-bosh-docker/destroy-inner-bosh.sh",
-			strconv.Itoa(config.GinkgoConfig.ParallelNode),
-		),
-		GinkgoWriter,
-		GinkgoWriter,
-	)
-	Expect(err).ToNot(HaveOccurred())
-	Eventually(session, 15*time.Minute).Should(gexec.Exit(0))
+	CollectFailureArtifacts()
+
+	defer StartPhase(PhaseTeardown)()
+	Expect(innerDirectorPool.Invalidate()).To(Succeed())
+	Expect(innerDirector.Stop()).To(Succeed())
 }
 
 func InnerBoshExists() bool {
-	// If the inner BOSH has not been started, then the BOSH helper script will
-	// not exist.
-	_, err := os.Stat(BoshBinaryPath())
-	if os.IsNotExist(err) {
-		return false
-	}
-	Expect(err).NotTo(HaveOccurred())
-	return true
+	return innerDirector.Exists()
+}
+
+// InnerBoshDirector returns the driver managing the director under test.
+func InnerBoshDirector() InnerDirector {
+	return innerDirector
 }
 
 func BoshDeploymentAssetPath(assetPath string) string {
-	return filepath.Join(os.Getenv("BOSH_DEPLOYMENT_PATH"), assetPath)
+	return filepath.Join(boshDeploymentPath, assetPath)
 }
 
 func OuterBosh(args ...string) *gexec.Session {
@@ -378,17 +420,55 @@ func Bosh(args ...string) *gexec.Session {
 }
 
 func UploadStemcell(stemcellURL string) {
+	defer StartPhase(PhaseStemcellUpload)()
+
 	session := Bosh("-n", "upload-stemcell", stemcellURL)
 	Eventually(session, 10*time.Minute).Should(gexec.Exit(0))
 }
 
 func UploadRelease(releaseURL string) {
+	defer StartPhase(PhaseReleaseUpload)()
+
 	session := Bosh("-n", "upload-release", releaseURL)
 	Eventually(session, 4*time.Minute).Should(gexec.Exit(0))
 }
 
+// StopAgent stops the agent of a deployed instance, which the health monitor
+// reports as timed out a minute later. It waits for the ssh session to be
+// cleaned up first, which needs the agent.
+func StopAgent(deployment, instance string) {
+	session := Bosh("-d", deployment, "ssh", instance, "-c",
+		`sudo nohup sh -c 'sleep 10; sv stop agent' >/dev/null 2>&1 &`)
+	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+}
+
+// PauseAgent freezes the agent of a deployed instance for a while, after the
+// same delay as StopAgent, and then lets it carry on.
+func PauseAgent(deployment, instance string, pause time.Duration) {
+	session := Bosh("-d", deployment, "ssh", instance, "-c", fmt.Sprintf(
+		`sudo nohup sh -c 'sleep 10; pkill -STOP -x bosh-agent; sleep %d; pkill -CONT -x bosh-agent' >/dev/null 2>&1 &`,
+		int(pause.Seconds())))
+	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+}
+
+// HealthMonitorLog returns the log of the inner director's health monitor,
+// where its logger plugin writes every alert.
+func HealthMonitorLog() string {
+	session := OuterBoshQuiet("-d", InnerBoshDirectorName(), "ssh", "bosh", "-c",
+		"sudo cat /var/vcap/sys/log/health_monitor/health_monitor.log")
+	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+	return string(session.Out.Contents())
+}
+
+// InnerBoshLog returns the contents of a log on the inner director's VM.
+func InnerBoshLog(path string) string {
+	session := OuterBoshQuiet("-d", InnerBoshDirectorName(), "ssh", "bosh", "-c", "sudo cat "+path)
+	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+	return string(sshStdout(session.Out.Contents()))
+}
+
 func InnerBoshDirectorName() string {
-	return fmt.Sprintf("bosh-%d", config.GinkgoConfig.ParallelNode)
+	return LeaseResources().DirectorDeploymentName()
 }
 
 func InnerBoshWithExternalDBOptions(dbConfig *ExternalDBConfig) []string {
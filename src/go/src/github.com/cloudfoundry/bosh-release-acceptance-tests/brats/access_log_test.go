@@ -0,0 +1,252 @@
+package brats_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	blobstoreBratsUser     = "brats-agent"
+	blobstoreBratsPassword = "brats-agent-password"
+)
+
+// rackTrustedProxy is what Rack 1.6 takes for a proxy when working out
+// where a request came from, falling back to the director's nginx.
+var rackTrustedProxy = regexp.MustCompile(`(?i)\A127\.0\.0\.1\z|\A(10|172\.(1[6-9]|2[0-9]|30|31)|192\.168)\.|\A::1\z|\Afd[0-9a-f]{2}:.+|\Alocalhost\z`)
+
+// sourceAddressTowards returns the address this host sends from when
+// talking to a host, which is what its access logs see.
+func sourceAddressTowards(host string) string {
+	conn, err := net.Dial("udp", net.JoinHostPort(host, "9"))
+	Expect(err).ToNot(HaveOccurred())
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// accessLogRequest sends a request, with basic auth unless the user is
+// empty, and returns the response status.
+func accessLogRequest(client *http.Client, method, url, user, password, body string) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	Expect(err).ToNot(HaveOccurred())
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+
+	resp, err := client.Do(req)
+	Expect(err).ToNot(HaveOccurred())
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+// accessLogged returns the CEF records of a log on the inner director's VM
+// for requests to a path from a source address.
+func accessLogged(logPath, name, src string) []bratsutils.CEFEvent {
+	all, err := bratsutils.ParseCEFLog(bratsutils.InnerBoshLog(logPath))
+	Expect(err).ToNot(HaveOccurred())
+
+	var events []bratsutils.CEFEvent
+	for _, event := range all {
+		if event.Name == name && event.Extension["src"] == src {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func expectSeverityFor(event bratsutils.CEFEvent, status int) {
+	if status >= 400 {
+		Expect(event.Severity).To(Equal("7"))
+	} else {
+		Expect(event.Severity).To(Equal("1"))
+	}
+}
+
+var _ = Describe("CEF access logs", func() {
+	var src string
+
+	BeforeEach(func() {
+		src = sourceAddressTowards(bratsutils.InnerDirectorIP())
+	})
+
+	Context("Blobstore", func() {
+		var (
+			blob      string
+			blobURL   string
+			blobstore *http.Client
+		)
+
+		BeforeEach(func() {
+			bratsutils.StartInnerBosh(
+				"-o", bratsutils.AssetPath("ops-blobstore-brats-user.yml"),
+				"-v", fmt.Sprintf("blobstore-brats-user=%s", blobstoreBratsUser),
+				"-v", fmt.Sprintf("blobstore-brats-password=%s", blobstoreBratsPassword),
+			)
+
+			blob = fmt.Sprintf("/brats/access-log-%d", time.Now().UnixNano())
+			blobURL = fmt.Sprintf("https://%s:25250%s", bratsutils.InnerDirectorIP(), blob)
+
+			// The blobstore's certificate is signed by a CA only the inner
+			// director's vars store has; what is logged doesn't depend on it.
+			blobstore = &http.Client{
+				Timeout:   time.Minute,
+				Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+			}
+		})
+
+		It("logs who sent each request, how, and how it was answered", func() {
+			Expect(accessLogRequest(blobstore, "PUT", blobURL, blobstoreBratsUser, blobstoreBratsPassword, "brats")).To(Equal(http.StatusCreated))
+			Expect(accessLogRequest(blobstore, "GET", blobURL, "", "", "")).To(Equal(http.StatusUnauthorized))
+			Expect(accessLogRequest(blobstore, "GET", blobURL, blobstoreBratsUser, "wrong-password", "")).To(Equal(http.StatusUnauthorized))
+
+			events := accessLogged(BLOBSTORE_ACCESS_LOG, blob, src)
+			Expect(events).To(HaveLen(3))
+
+			expected := []struct {
+				method string
+				user   string
+				status int
+			}{
+				{"PUT", blobstoreBratsUser, http.StatusCreated},
+				// nginx logs empty variables as a dash.
+				{"GET", "-", http.StatusUnauthorized},
+				// The user is logged as sent, even though its password is wrong.
+				{"GET", blobstoreBratsUser, http.StatusUnauthorized},
+			}
+			for i, event := range events {
+				Expect(event.Version).To(Equal(0))
+				Expect(event.DeviceVendor).To(Equal("CloudFoundry"))
+				Expect(event.DeviceProduct).To(Equal("BOSH"))
+				Expect(event.DeviceVersion).To(Equal("-"))
+				Expect(event.SignatureID).To(Equal("blobstore_api"))
+				expectSeverityFor(event, expected[i].status)
+
+				Expect(event.Extension).To(HaveKeyWithValue("requestMethod", expected[i].method))
+				Expect(event.Extension).To(HaveKeyWithValue("src", src))
+				Expect(event.Extension).To(HaveKeyWithValue("spt", MatchRegexp(`^\d+$`)))
+				Expect(event.Extension).To(HaveKeyWithValue("requestClientApplication", expected[i].user))
+				Expect(event.Extension).To(HaveKeyWithValue("cs1", "Basic"))
+				Expect(event.Extension).To(HaveKeyWithValue("cs1Label", "authType"))
+				Expect(event.Extension).To(HaveKeyWithValue("cs2", strconv.Itoa(expected[i].status)))
+				Expect(event.Extension).To(HaveKeyWithValue("cs2Label", "responseStatus"))
+			}
+		})
+	})
+
+	Context("Director", func() {
+		It("refuses the removed log_access_events_to_syslog", func() {
+			bratsutils.StartInnerBoshWithExpectation(true, "property director.log_access_events_to_syslog has been removed",
+				"-o", bratsutils.AssetPath("ops-director-log-access-events-to-syslog.yml"),
+			)
+		})
+
+		Context("with director.log_access_events", func() {
+			var (
+				creds    bratsutils.InnerDirectorCredentials
+				director *http.Client
+			)
+
+			BeforeEach(func() {
+				bratsutils.StartInnerBosh(
+					"-o", bratsutils.AssetPath("ops-director-log-access-events.yml"),
+				)
+
+				var err error
+				creds, err = bratsutils.InnerBoshDirector().Credentials()
+				Expect(err).ToNot(HaveOccurred())
+
+				caCerts := x509.NewCertPool()
+				Expect(caCerts.AppendCertsFromPEM([]byte(creds.CACert))).To(BeTrue())
+				director = &http.Client{
+					Timeout:   time.Minute,
+					Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: caCerts}},
+				}
+			})
+
+			It("logs who sent each request, how, and how it was answered", func() {
+				info, err := bratsutils.Director().Info()
+				Expect(err).ToNot(HaveOccurred())
+
+				// nginx passes the address on, but Rack ignores it when it
+				// looks like another proxy's.
+				loggedSrc := src
+				if rackTrustedProxy.MatchString(src) {
+					loggedSrc = "127.0.0.1"
+				}
+				// That is also where the health monitor's requests seem to
+				// come from then, but nginx still passes the real address.
+				realIP := regexp.MustCompile(`(^|&)X_REAL_IP=` + regexp.QuoteMeta(src) + `(&|$)`)
+				ours := func() []bratsutils.CEFEvent {
+					var events []bratsutils.CEFEvent
+					for _, event := range accessLogged(DIRECTOR_AUDIT_LOG, "/deployments", loggedSrc) {
+						if realIP.MatchString(event.Extension["cs2"]) {
+							events = append(events, event)
+						}
+					}
+					return events
+				}
+				loggedBefore := len(ours())
+
+				_, err = bratsutils.Director().Deployments()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(accessLogRequest(director, "GET", creds.URL+"/deployments", "", "", "")).To(Equal(http.StatusUnauthorized))
+				Expect(accessLogRequest(director, "GET", creds.URL+"/deployments", creds.Client, "wrong-password", "")).To(Equal(http.StatusUnauthorized))
+
+				events := ours()
+				Expect(events).To(HaveLen(loggedBefore + 3))
+				events = events[loggedBefore:]
+
+				for i, event := range events {
+					Expect(event.Version).To(Equal(0))
+					Expect(event.DeviceVendor).To(Equal("CloudFoundry"))
+					Expect(event.DeviceProduct).To(Equal("BOSH"))
+					Expect(event.SignatureID).To(Equal("director_api"))
+
+					Expect(event.Extension).To(HaveKeyWithValue("requestMethod", "GET"))
+					Expect(event.Extension).To(HaveKeyWithValue("src", loggedSrc))
+					Expect(event.Extension).To(HaveKeyWithValue("cs1Label", "ips"))
+					Expect(strings.Split(event.Extension["cs1"], ",")).To(ContainElement(bratsutils.InnerDirectorIP()))
+					Expect(event.Extension).To(HaveKeyWithValue("cs2Label", "httpHeaders"))
+					Expect(event.Extension).To(HaveKeyWithValue("cs3Label", "authType"))
+					Expect(event.Extension).To(HaveKeyWithValue("cs4Label", "responseStatus"))
+
+					if i == 0 {
+						expectSeverityFor(event, http.StatusOK)
+						Expect(event.Extension).To(HaveKeyWithValue("cs3", info.UserAuthentication.Type))
+						Expect(event.Extension).To(HaveKeyWithValue("cs4", "200"))
+						Expect(event.Extension).ToNot(HaveKey("cs5"))
+
+						// Local users have names, UAA clients only client IDs.
+						if info.UserAuthentication.Type == "basic" {
+							Expect(event.Extension).To(HaveKeyWithValue("duser", creds.Client))
+						} else {
+							Expect(event.Extension).To(HaveKeyWithValue("requestClientApplication", creds.Client))
+						}
+						continue
+					}
+
+					// Whether credentials were sent or not, a rejected
+					// request has no user.
+					expectSeverityFor(event, http.StatusUnauthorized)
+					Expect(event.Extension).To(HaveKeyWithValue("cs3", "none"))
+					Expect(event.Extension).To(HaveKeyWithValue("cs4", "401"))
+					Expect(event.Extension).To(HaveKeyWithValue("cs5Label", "statusReason"))
+					Expect(event.Extension).ToNot(HaveKey("duser"))
+					Expect(event.Extension).ToNot(HaveKey("requestClientApplication"))
+				}
+			})
+		})
+	})
+})
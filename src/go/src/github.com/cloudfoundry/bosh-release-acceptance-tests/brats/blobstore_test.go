@@ -2,7 +2,6 @@ package brats_test
 
 import (
 	"io/ioutil"
-	"os"
 	"path/filepath"
 
 	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
@@ -18,6 +17,8 @@ import (
 var _ = Describe("Blobstore", func() {
 	Context("SSL", func() {
 		testDeployment := func(allowHttp bool, schema string, errorCode int) {
+			bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
 			By(fmt.Sprintf("specifying blobstore.allow_http (%v) and agent.env.bosh.blobstores (%v)", allowHttp, schema))
 			bratsutils.StartInnerBosh(
 				fmt.Sprintf("-o %s", bratsutils.AssetPath("op-blobstore-https.yml")),
@@ -25,14 +26,14 @@ var _ = Describe("Blobstore", func() {
 				fmt.Sprintf("-v agent_blobstore_endpoint=%s://%s:25250", schema, bratsutils.InnerDirectorIP()),
 			)
 
-			bratsutils.UploadRelease("https://bosh.io/d/github.com/cloudfoundry/syslog-release?v=11")
+			bratsutils.UploadRelease(bratsutils.ResolveArtifact("syslog@11"))
 			bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
 
 			session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("syslog-manifest.yml"),
 				"-d", "syslog-deployment",
 				"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
 			)
-			Eventually(session, 10*time.Minute).Should(gexec.Exit(errorCode))
+			bratsutils.ExpectDeployExit(session, "syslog-deployment", 10*time.Minute, errorCode)
 		}
 
 		DescribeTable("with allow_http true", testDeployment,
@@ -50,11 +51,10 @@ var _ = Describe("Blobstore", func() {
 		var tempBlobstoreDir string
 
 		BeforeEach(func() {
+			bratsutils.SkipUnlessConfigured(bratsutils.ConfigBoshRelease)
 			bratsutils.StartInnerBosh()
 
-			var err error
-			tempBlobstoreDir, err = ioutil.TempDir(os.TempDir(), "blobstore_access")
-			Expect(err).ToNot(HaveOccurred())
+			tempBlobstoreDir = bratsutils.TempDir("blobstore_access")
 
 			bratsutils.UploadRelease(boshRelease)
 
@@ -65,7 +65,16 @@ var _ = Describe("Blobstore", func() {
 		It("Should log in correct format", func() {
 			accessContent, err := ioutil.ReadFile(filepath.Join(tempBlobstoreDir, "blobstore_access.log"))
 			Expect(err).ToNot(HaveOccurred())
-			Expect(string(accessContent)).To(ContainSubstring("CEF:0|CloudFoundry|BOSH|-|blobstore_api|"))
+			events, err := bratsutils.ParseCEFLog(string(accessContent))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).ToNot(BeEmpty())
+			for _, event := range events {
+				Expect(event.DeviceVendor).To(Equal("CloudFoundry"))
+				Expect(event.DeviceProduct).To(Equal("BOSH"))
+				Expect(event.SignatureID).To(Equal("blobstore_api"))
+				Expect(event.Extension).To(HaveKey("requestMethod"))
+				Expect(event.Extension).To(HaveKeyWithValue("cs2Label", "responseStatus"))
+			}
 		})
 	})
 })
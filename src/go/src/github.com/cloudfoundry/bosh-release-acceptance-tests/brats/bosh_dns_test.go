@@ -2,7 +2,6 @@ package brats_test
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -18,16 +17,19 @@ import (
 
 const deploymentName = "dns-with-templates"
 
-func extractAzIpsMap(regex *regexp.Regexp, contents string) map[string][]string {
-	out := map[string][]string{
-		"z1": {},
-		"z2": {},
+func providerIPsByAZ(azs ...string) map[string][]string {
+	out := map[string][]string{}
+	for _, az := range azs {
+		out[az] = []string{}
 	}
 
-	instances := regex.FindAllStringSubmatch(contents, -1)
-	Expect(instances).ToNot(BeNil())
-	for _, q := range instances {
-		out[q[1]] = append(out[q[1]], q[2])
+	instances, err := bratsutils.Director().Instances(deploymentName)
+	Expect(err).ToNot(HaveOccurred())
+
+	for _, instance := range instances {
+		if _, wanted := out[instance.AZ]; instance.Job == "provider" && wanted {
+			out[instance.AZ] = append(out[instance.AZ], instance.IPs...)
+		}
 	}
 
 	return out
@@ -71,6 +73,12 @@ var _ = Describe("BoshDns", func() {
 	)
 
 	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(
+			bratsutils.ConfigCandidateStemcellTarballPath,
+			bratsutils.ConfigDNSReleasePath,
+			bratsutils.ConfigBoshDNSAddonOpsFilePath,
+		)
+
 		bratsutils.StartInnerBosh()
 		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
 
@@ -83,7 +91,7 @@ var _ = Describe("BoshDns", func() {
 			opFilePath := bratsutils.AssetPath("op-enable-short-dns-addresses.yml")
 
 			session := bratsutils.Bosh("deploy", "-n", "-d", deploymentName, manifestPath,
-				"-o", os.Getenv("BOSH_DNS_ADDON_OPS_FILE_PATH"),
+				"-o", boshDNSAddonOpsFilePath,
 				"-o", opFilePath,
 				"-v", fmt.Sprintf("dns-release-path=%s", dnsReleasePath),
 				"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
@@ -94,19 +102,9 @@ var _ = Describe("BoshDns", func() {
 		})
 
 		It("can find instances using the address helper with short names", func() {
-			session := bratsutils.Bosh("-n", "-d", deploymentName, "instances",
-				"--column", "instance",
-				"--column", "az",
-				"--column", "ips",
-			)
-			Eventually(session, time.Minute).Should(gexec.Exit(0))
+			knownProviders := providerIPsByAZ("z1", "z2")
 
-			instanceList := session.Out.Contents()
-
-			matchExpression := regexp.MustCompile(`provider\S+\s+(z1|z2)\s+(\S+)`)
-			knownProviders := extractAzIpsMap(matchExpression, string(instanceList))
-
-			session = bratsutils.Bosh("-d", deploymentName, "run-errand", "query-all")
+			session := bratsutils.Bosh("-d", deploymentName, "run-errand", "query-all")
 			Eventually(session, time.Minute).Should(gexec.Exit(0))
 
 			Expect(session.Out).To(gbytes.Say("ANSWER: 3"))
@@ -121,19 +119,9 @@ var _ = Describe("BoshDns", func() {
 		})
 
 		It("can find instances using the address helper with short names by network and instance ID", func() {
-			session := bratsutils.Bosh("-n", "-d", deploymentName, "instances",
-				"--column", "instance",
-				"--column", "az",
-				"--column", "ips",
-			)
-			Eventually(session, time.Minute).Should(gexec.Exit(0))
-
-			instanceList := session.Out.Contents()
+			knownProviders := providerIPsByAZ("z1")
 
-			matchExpression := regexp.MustCompile(`provider\S+\s+(z1)\s+(\S+)`)
-			knownProviders := extractAzIpsMap(matchExpression, string(instanceList))
-
-			session = bratsutils.Bosh("-d", deploymentName, "run-errand", "query-individual-instance")
+			session := bratsutils.Bosh("-d", deploymentName, "run-errand", "query-individual-instance")
 			Eventually(session, time.Minute).Should(gexec.Exit(0))
 
 			Expect(session.Out).To(gbytes.Say("ANSWER: 1"))
@@ -149,7 +137,7 @@ var _ = Describe("BoshDns", func() {
 	Context("When deploying vms across different azs", func() {
 		BeforeEach(func() {
 			session := bratsutils.Bosh("deploy", "-n", "-d", deploymentName, manifestPath,
-				"-o", os.Getenv("BOSH_DNS_ADDON_OPS_FILE_PATH"),
+				"-o", boshDNSAddonOpsFilePath,
 				"-v", fmt.Sprintf("dns-release-path=%s", dnsReleasePath),
 				"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
 				"-v", fmt.Sprintf("linked-template-release-path=%s", linkedTemplateReleasePath),
@@ -159,20 +147,10 @@ var _ = Describe("BoshDns", func() {
 		})
 
 		It("can find instances using the address helper", func() {
-			session := bratsutils.Bosh("-n", "-d", deploymentName, "instances",
-				"--column", "instance",
-				"--column", "az",
-				"--column", "ips",
-			)
-			Eventually(session, time.Minute).Should(gexec.Exit(0))
-
-			instanceList := session.Out.Contents()
-
 			By("finding instances in all AZs", func() {
-				matchExpression := regexp.MustCompile(`provider\S+\s+(z1|z2)\s+(\S+)`)
-				knownProviders := extractAzIpsMap(matchExpression, string(instanceList))
+				knownProviders := providerIPsByAZ("z1", "z2")
 
-				session = bratsutils.Bosh("-d", deploymentName, "run-errand", "query-all")
+				session := bratsutils.Bosh("-d", deploymentName, "run-errand", "query-all")
 				Eventually(session, time.Minute).Should(gexec.Exit(0))
 
 				Expect(session.Out).To(gbytes.Say("ANSWER: 3"))
@@ -186,10 +164,9 @@ var _ = Describe("BoshDns", func() {
 			})
 
 			By("finding instances filtering by AZ", func() {
-				matchExpression := regexp.MustCompile(`provider\S+\s+(z1)\s+(\S+)`)
-				knownProviders := extractAzIpsMap(matchExpression, string(instanceList))
+				knownProviders := providerIPsByAZ("z1")
 
-				session = bratsutils.Bosh("-d", deploymentName, "run-errand", "query-with-az-filter")
+				session := bratsutils.Bosh("-d", deploymentName, "run-errand", "query-with-az-filter")
 				Eventually(session, time.Minute).Should(gexec.Exit(0))
 
 				Expect(session.Out).To(gbytes.Say("ANSWER: 2"))
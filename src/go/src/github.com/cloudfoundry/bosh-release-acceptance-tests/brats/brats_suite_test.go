@@ -1,31 +1,28 @@
 package brats_test
 
 import (
-	"strings"
-
 	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
-	"fmt"
 	"testing"
-
-	"time"
-
-	"github.com/onsi/gomega/gexec"
 )
 
-const BLOBSTORE_ACCESS_LOG = "/var/vcap/sys/log/blobstore/blobstore_access.log"
+const (
+	BLOBSTORE_ACCESS_LOG = "/var/vcap/sys/log/blobstore/blobstore_access.log"
+	DIRECTOR_AUDIT_LOG   = "/var/vcap/sys/log/director/audit.log"
+)
 
 func TestBrats(t *testing.T) {
 	RegisterFailHandler(Fail)
-	RunSpecs(t, "Brats Suite")
+	bratsutils.RunSpecsWithReports(t, "Brats Suite")
 }
 
 var (
 	boshRelease,
 	candidateWardenLinuxStemcellPath,
-	dnsReleasePath string
+	dnsReleasePath,
+	boshDNSAddonOpsFilePath string
 )
 
 var _ = SynchronizedBeforeSuite(func() []byte {
@@ -36,31 +33,19 @@ var _ = SynchronizedBeforeSuite(func() []byte {
 	return nil
 }, func(data []byte) {
 	bratsutils.Bootstrap()
-	boshRelease = bratsutils.AssertEnvExists("BOSH_RELEASE")
-	dnsReleasePath = bratsutils.AssertEnvExists("DNS_RELEASE_PATH")
-	candidateWardenLinuxStemcellPath = bratsutils.AssertEnvExists("CANDIDATE_STEMCELL_TARBALL_PATH")
+
+	// Specs skip themselves when the inputs they need are not configured.
+	suiteConfig := bratsutils.SuiteConfig()
+	boshRelease = suiteConfig.BoshRelease
+	dnsReleasePath = suiteConfig.DNSReleasePath
+	boshDNSAddonOpsFilePath = suiteConfig.BoshDNSAddonOpsFilePath
+	candidateWardenLinuxStemcellPath = suiteConfig.CandidateStemcellTarballPath
 })
 
 var _ = AfterSuite(func() {
 	bratsutils.StopInnerBosh()
 })
 
-var _ = AfterEach(func() {
-	if !bratsutils.InnerBoshExists() {
-		return
-	}
-
-	By("cleaning up deployments")
-	session := bratsutils.Bosh("deployments", "--column=name")
-	Eventually(session, 1*time.Minute).Should(gexec.Exit())
-	deployments := strings.Fields(string(session.Out.Contents()))
-
-	for _, deploymentName := range deployments {
-		By(fmt.Sprintf("deleting deployment %v", deploymentName))
-		if deploymentName == "" {
-			continue
-		}
-		session := bratsutils.Bosh("delete-deployment", "-n", "-d", deploymentName)
-		Eventually(session, 5*time.Minute).Should(gexec.Exit())
-	}
-})
+// Deployments are left in place for the artifacts; the next StartInnerBosh
+// resets the director before handing it out again.
+var _ = AfterEach(bratsutils.CollectFailureArtifacts)
@@ -0,0 +1,204 @@
+package brats_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	configServerDeployment   = "config-server-deployment"
+	configServerClientID     = "director_to_credhub"
+	configServerClientSecret = "brats-config-server-secret"
+)
+
+// Kept across specs so that its CA, and with it the director, is reused. The
+// director fingerprint includes the path of the CA file, so it is written
+// only once too.
+var (
+	configServer       *bratsutils.ConfigServer
+	configServerCAPath string
+)
+
+func startConfigServer() {
+	if configServer == nil {
+		var err error
+		configServer, err = bratsutils.NewConfigServer("0.0.0.0", bratsutils.InnerBoshDirector().HostAddress(),
+			configServerClientID, configServerClientSecret)
+		Expect(err).ToNot(HaveOccurred())
+
+		configServerCAPath = filepath.Join(bratsutils.TempDir("config-server"), "ca.pem")
+		Expect(ioutil.WriteFile(configServerCAPath, []byte(configServer.CACert), 0644)).To(Succeed())
+	}
+
+	Expect(configServer.Start()).To(Succeed())
+	configServer.Reset()
+}
+
+func deployConfigServerDeployment(expectedExitCode int) {
+	session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("config-server-manifest.yml"),
+		"-d", configServerDeployment,
+		"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+	)
+	bratsutils.ExpectDeployExit(session, configServerDeployment, 10*time.Minute, expectedExitCode)
+}
+
+// configServerVariable returns the absolute name the director gives a
+// variable of the deployment in the config server.
+func configServerVariable(name string) string {
+	info, err := bratsutils.Director().Info()
+	Expect(err).ToNot(HaveOccurred())
+	return fmt.Sprintf("/%s/%s/%s", info.Name, configServerDeployment, name)
+}
+
+func currentConfigServerCredential(name string) bratsutils.ConfigServerCredential {
+	credential, found := configServer.Current(configServerVariable(name))
+	Expect(found).To(BeTrue(), "no credential '%s'", configServerVariable(name))
+	return credential
+}
+
+// deployedVariables returns the ID of every variable's version the
+// deployment uses, by name, as `bosh variables` lists them.
+func deployedVariables() map[string]string {
+	session := bratsutils.Bosh("-d", configServerDeployment, "variables", "--json")
+	Eventually(session, time.Minute).Should(gexec.Exit(0))
+
+	var output struct {
+		Tables []struct {
+			Rows []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			}
+		}
+	}
+	Expect(json.Unmarshal(session.Out.Contents(), &output)).To(Succeed())
+	Expect(output.Tables).To(HaveLen(1))
+
+	variables := map[string]string{}
+	for _, row := range output.Tables[0].Rows {
+		variables[row.Name] = row.ID
+	}
+	return variables
+}
+
+func authorizedKeys() string {
+	session := bratsutils.Bosh("-d", configServerDeployment, "ssh", "test-brats/0", "-c",
+		"sudo cat /home/brats/.ssh/authorized_keys")
+	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+	return string(session.Out.Contents())
+}
+
+var _ = Describe("Config server", func() {
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+		startConfigServer()
+
+		host := bratsutils.InnerBoshDirector().HostAddress()
+		bratsutils.StartInnerBosh(
+			"-o", bratsutils.AssetPath("ops-config-server.yml"),
+			"-v", fmt.Sprintf("config-server-url=%s", configServer.URL(host)),
+			"-v", fmt.Sprintf("config-server-uaa-url=%s", configServer.UAAURL(host)),
+			"-v", fmt.Sprintf("config-server-client-id=%s", configServerClientID),
+			"-v", fmt.Sprintf("config-server-client-secret=%s", configServerClientSecret),
+			fmt.Sprintf("--var-file=config-server-ca=%s", configServerCAPath),
+		)
+
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		bratsutils.UploadRelease(bratsutils.ResolveArtifact("os-conf@12"))
+
+		deployConfigServerDeployment(0)
+	})
+
+	It("generates every type of variable in the config server and lists the versions it deployed", func() {
+		password := currentConfigServerCredential("brats-password")
+		ca := currentConfigServerCredential("brats-ca")
+		certificate := currentConfigServerCredential("brats-certificate")
+		ssh := currentConfigServerCredential("brats-ssh")
+
+		Expect(password.Type).To(Equal("password"))
+		Expect(password.StringValue("")).ToNot(BeEmpty())
+
+		Expect(ca.Type).To(Equal("certificate"))
+		Expect(certificate.Type).To(Equal("certificate"))
+		Expect(certificate.StringValue("ca")).To(Equal(ca.StringValue("certificate")))
+		// The director makes the CA's name absolute before asking for the certificate.
+		Expect(certificate.Parameters).To(HaveKeyWithValue("ca", configServerVariable("brats-ca")))
+
+		Expect(ssh.Type).To(Equal("ssh"))
+		Expect(authorizedKeys()).To(ContainSubstring(ssh.StringValue("public_key")))
+
+		Expect(deployedVariables()).To(Equal(map[string]string{
+			configServerVariable("brats-password"):    password.ID,
+			configServerVariable("brats-ca"):          ca.ID,
+			configServerVariable("brats-certificate"): certificate.ID,
+			configServerVariable("brats-ssh"):         ssh.ID,
+		}))
+	})
+
+	It("deploys the versions a rotation adds on the next deploy only", func() {
+		before := deployedVariables()
+		oldKey := currentConfigServerCredential("brats-ssh").StringValue("public_key")
+
+		By("regenerating the password and ssh key behind the director's back")
+		password, err := configServer.Regenerate(configServerVariable("brats-password"))
+		Expect(err).ToNot(HaveOccurred())
+		ssh, err := configServer.Regenerate(configServerVariable("brats-ssh"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(deployedVariables()).To(Equal(before))
+		Expect(authorizedKeys()).To(ContainSubstring(oldKey))
+
+		By("redeploying")
+		deployConfigServerDeployment(0)
+
+		after := deployedVariables()
+		Expect(after).To(HaveKeyWithValue(configServerVariable("brats-password"), password.ID))
+		Expect(after).To(HaveKeyWithValue(configServerVariable("brats-ssh"), ssh.ID))
+		Expect(after).To(HaveKeyWithValue(configServerVariable("brats-ca"), before[configServerVariable("brats-ca")]))
+		Expect(after).To(HaveKeyWithValue(configServerVariable("brats-certificate"), before[configServerVariable("brats-certificate")]))
+
+		keys := authorizedKeys()
+		Expect(keys).To(ContainSubstring(ssh.StringValue("public_key")))
+		Expect(keys).ToNot(ContainSubstring(oldKey))
+	})
+
+	It("fails deploys, but keeps what is deployed, while the config server is unreachable", func() {
+		before := deployedVariables()
+		instances, err := bratsutils.Director().Instances(configServerDeployment)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(configServer.Stop()).To(Succeed())
+
+		By("failing the redeploy on getting a token")
+		deployConfigServerDeployment(1)
+
+		tasks, err := bratsutils.Director().Tasks(director.TasksFilter{Deployment: configServerDeployment, Limit: 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tasks).To(HaveLen(1))
+		Expect(tasks[0].State).To(Equal("error"))
+		// The director's UAA client gives up on the refused connection.
+		Expect(strings.ToLower(tasks[0].Result)).To(Or(
+			ContainSubstring("failed to obtain valid token from uaa"),
+			ContainSubstring("connection refused"),
+		))
+
+		By("leaving the instances and the variables they use alone")
+		Expect(bratsutils.Director().Instances(configServerDeployment)).To(Equal(instances))
+		Expect(deployedVariables()).To(Equal(before))
+
+		By("deploying again once the config server is back")
+		Expect(configServer.Start()).To(Succeed())
+		deployConfigServerDeployment(0)
+		Expect(deployedVariables()).To(Equal(before))
+	})
+})
@@ -0,0 +1,254 @@
+package brats_test
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	eventsDeployment = "os-conf-deployment"
+
+	// Well above what a single spec records, so that the cleanup, which
+	// runs every few seconds, never prunes the events a spec looks at.
+	eventsMaxEvents = 100
+)
+
+// lastEventID returns the ID of the newest event, so that a spec can tell
+// the events an action records from the ones before.
+func lastEventID() int {
+	events, err := bratsutils.Director().Events(director.EventsFilter{})
+	Expect(err).ToNot(HaveOccurred())
+	if len(events) == 0 {
+		return 0
+	}
+	return events[0].IDNumber()
+}
+
+func eventsAfter(id int, filter director.EventsFilter) []director.Event {
+	filter.AfterID = id
+	events, err := bratsutils.Director().Events(filter)
+	Expect(err).ToNot(HaveOccurred())
+	return events
+}
+
+// expectEventPair finds the event recorded when an action on an object
+// started and the one recorded when it ended, and checks they are linked,
+// belong to the same task, and are attributed to the same user.
+func expectEventPair(events []director.Event, action, objectType, user string) (director.Event, director.Event) {
+	var starts []director.Event
+	ends := map[string]director.Event{}
+	for _, event := range events {
+		if event.Action != action || event.ObjectType != objectType {
+			continue
+		}
+		if event.ParentID == "" {
+			starts = append(starts, event)
+		} else {
+			ends[event.ParentID] = event
+		}
+	}
+	Expect(starts).To(HaveLen(1), "events starting '%s %s' in %#v", action, objectType, events)
+
+	start := starts[0]
+	end, found := ends[start.ID]
+	Expect(found).To(BeTrue(), "no event ending '%s %s' with parent %s in %#v", action, objectType, start.ID, events)
+
+	Expect(start.User).To(Equal(user))
+	Expect(end.User).To(Equal(user))
+	Expect(start.Task).ToNot(BeEmpty())
+	Expect(end.Task).To(Equal(start.Task))
+	Expect(end.IDNumber()).To(BeNumerically(">", start.IDNumber()))
+	Expect(end.Timestamp).To(BeNumerically(">=", start.Timestamp))
+	Expect(end.Error).To(BeEmpty())
+
+	return start, end
+}
+
+var _ = Describe("Director events", func() {
+	var user string
+
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+		bratsutils.StartInnerBosh(
+			"-o", bratsutils.AssetPath("ops-record-events.yml"),
+			"-v", fmt.Sprintf("max-events=%d", eventsMaxEvents),
+		)
+
+		creds, err := bratsutils.InnerBoshDirector().Credentials()
+		Expect(err).ToNot(HaveOccurred())
+		user = creds.Client
+	})
+
+	Context("with a deployment", func() {
+		var deployedAfter int
+
+		BeforeEach(func() {
+			bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+			bratsutils.UploadRelease(bratsutils.ResolveArtifact("os-conf@12"))
+
+			deployedAfter = lastEventID()
+			session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("os-conf-manifest.yml"),
+				"-d", eventsDeployment,
+				"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+			)
+			bratsutils.ExpectDeployExit(session, eventsDeployment, 10*time.Minute, 0)
+		})
+
+		It("records the deploy, and the VM it created within it", func() {
+			events := eventsAfter(deployedAfter, director.EventsFilter{Deployment: eventsDeployment})
+
+			start, end := expectEventPair(events, "create", "deployment", user)
+			Expect(start.ObjectName).To(Equal(eventsDeployment))
+			Expect(end.ObjectName).To(Equal(eventsDeployment))
+			Expect(end.Context).To(HaveKeyWithValue("after", HaveKeyWithValue("releases", ConsistOf("os-conf/12"))))
+
+			instances, err := bratsutils.Director().Instances(eventsDeployment)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instances).To(HaveLen(1))
+
+			// Compilation VMs come and go within the same task.
+			instance := "test-brats/" + instances[0].ID
+			vmStart, vmEnd := expectEventPair(eventsAfter(deployedAfter, director.EventsFilter{Instance: instance}), "create", "vm", user)
+			Expect(vmStart.Task).To(Equal(start.Task))
+			Expect(vmEnd.ObjectName).To(Equal(instances[0].CID))
+
+			By("finding the same events when filtering by task")
+			task, err := strconv.Atoi(start.Task)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(eventsAfter(deployedAfter, director.EventsFilter{Task: task})).To(ContainElement(vmEnd))
+		})
+
+		It("records setting up and cleaning up ssh access", func() {
+			instances, err := bratsutils.Director().Instances(eventsDeployment)
+			Expect(err).ToNot(HaveOccurred())
+			instance := "test-brats/" + instances[0].ID
+
+			sshAfter := lastEventID()
+			session := bratsutils.Bosh("-d", eventsDeployment, "ssh", instance, "-c", "true")
+			Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+
+			events := eventsAfter(sshAfter, director.EventsFilter{ObjectType: "instance", Instance: instance})
+			var actions []string
+			for _, event := range events {
+				actions = append(actions, event.Action)
+
+				Expect(event.ParentID).To(BeEmpty())
+				Expect(event.User).To(Equal(user))
+				Expect(event.ObjectName).To(Equal(instance))
+				Expect(event.Deployment).To(Equal(eventsDeployment))
+				Expect(event.Context).To(HaveKeyWithValue("user", HavePrefix("bosh_")))
+			}
+			Expect(actions).To(Equal([]string{"cleanup ssh", "setup ssh"}))
+			Expect(events[0].Task).ToNot(Equal(events[1].Task))
+		})
+
+		It("records cloud check recreating a missing VM", func() {
+			instances, err := bratsutils.Director().Instances(eventsDeployment)
+			Expect(err).ToNot(HaveOccurred())
+			instance := "test-brats/" + instances[0].ID
+
+			deletedAfter := lastEventID()
+			session := bratsutils.Bosh("-n", "-d", eventsDeployment, "delete-vm", instances[0].CID)
+			Eventually(session, 5*time.Minute).Should(gexec.Exit(0))
+
+			_, deleted := expectEventPair(eventsAfter(deletedAfter, director.EventsFilter{ObjectType: "vm"}), "delete", "vm", user)
+			Expect(deleted.ObjectName).To(Equal(instances[0].CID))
+			Expect(deleted.Instance).To(Equal(instance))
+
+			resolvedAfter := lastEventID()
+			session = bratsutils.Bosh("-n", "-d", eventsDeployment, "cck", "--auto")
+			Eventually(session, 10*time.Minute).Should(gexec.Exit(0))
+
+			instances, err = bratsutils.Director().Instances(eventsDeployment)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instances[0].CID).ToNot(BeEmpty())
+
+			events := eventsAfter(resolvedAfter, director.EventsFilter{Deployment: eventsDeployment})
+			_, created := expectEventPair(events, "create", "vm", user)
+			Expect(created.ObjectName).To(Equal(instances[0].CID))
+			Expect(created.Instance).To(Equal(instance))
+			Expect(created.Task).ToNot(Equal(deleted.Task))
+		})
+
+		It("records deleting the deployment, its instance and its VM", func() {
+			instances, err := bratsutils.Director().Instances(eventsDeployment)
+			Expect(err).ToNot(HaveOccurred())
+
+			deletedAfter := lastEventID()
+			session := bratsutils.Bosh("-n", "delete-deployment", "-d", eventsDeployment)
+			Eventually(session, 10*time.Minute).Should(gexec.Exit(0))
+
+			events := eventsAfter(deletedAfter, director.EventsFilter{Deployment: eventsDeployment})
+
+			start, end := expectEventPair(events, "delete", "deployment", user)
+			Expect(end.ObjectName).To(Equal(eventsDeployment))
+
+			instanceStart, _ := expectEventPair(events, "delete", "instance", user)
+			Expect(instanceStart.ObjectName).To(Equal("test-brats/" + instances[0].ID))
+			Expect(instanceStart.Task).To(Equal(start.Task))
+
+			vmStart, _ := expectEventPair(events, "delete", "vm", user)
+			Expect(vmStart.ObjectName).To(Equal(instances[0].CID))
+			Expect(vmStart.Task).To(Equal(start.Task))
+		})
+	})
+
+	It("records config updates that change the content", func() {
+		updatedAfter := lastEventID()
+
+		_, err := bratsutils.Director().UpdateConfig("brats-events", "audit", "content: 1")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = bratsutils.Director().UpdateConfig("brats-events", "audit", "content: 1")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = bratsutils.Director().UpdateConfig("brats-events", "audit", "content: 2")
+		Expect(err).ToNot(HaveOccurred())
+
+		events := eventsAfter(updatedAfter, director.EventsFilter{ObjectType: "config/brats-events"})
+		Expect(events).To(HaveLen(2))
+		for _, event := range events {
+			Expect(event.Action).To(Equal("create"))
+			Expect(event.ObjectName).To(Equal("audit"))
+			Expect(event.User).To(Equal(user))
+			Expect(event.ParentID).To(BeEmpty())
+			Expect(event.Task).To(BeEmpty())
+		}
+	})
+
+	It("prunes the oldest events beyond max_events", func() {
+		var first, last int
+		for i := 0; i < 2*eventsMaxEvents; i++ {
+			Expect(bratsutils.Director().CreateEvent(director.NewEvent{
+				Action:     "prune",
+				ObjectType: "brats",
+				ObjectName: fmt.Sprintf("event-%d", i),
+			})).To(Succeed())
+			if i == 0 {
+				first = lastEventID()
+			}
+		}
+		last = lastEventID()
+
+		Eventually(func() bool {
+			_, found, err := bratsutils.Director().Event(first)
+			Expect(err).ToNot(HaveOccurred())
+			return found
+		}, time.Minute, 5*time.Second).Should(BeFalse())
+
+		events, err := bratsutils.Director().Events(director.EventsFilter{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(events)).To(BeNumerically("<=", eventsMaxEvents))
+		Expect(events[len(events)-1].IDNumber()).To(BeNumerically(">", first))
+
+		_, found, err := bratsutils.Director().Event(last)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+	})
+})
@@ -3,23 +3,46 @@ package brats_test
 import (
 	"os"
 
-	"io/ioutil"
-
 	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
-	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Director external database TLS connections", func() {
+	var (
+		dbConfig         *bratsutils.ExternalDBConfig
+		tmpCertDir       string
+		innerBoshStarted bool
+	)
+
+	BeforeEach(func() {
+		dbConfig = nil
+		tmpCertDir = ""
+		innerBoshStarted = false
+	})
+
+	// Teardown happens here rather than deferred in the spec, so that a
+	// failure is reported, and its artifacts collected, first.
+	AfterEach(func() {
+		if innerBoshStarted {
+			bratsutils.StopInnerBosh()
+		}
+		if dbConfig != nil {
+			bratsutils.DeleteDB(dbConfig)
+		}
+		if tmpCertDir != "" {
+			os.RemoveAll(tmpCertDir)
+		}
+	})
+
 	testDBConnectionOverTLS := func(databaseType string, mutualTLSEnabled bool, useIncorrectCA bool) {
-		tmpCertDir, err := ioutil.TempDir("", "db_tls")
-		Expect(err).ToNot(HaveOccurred())
-		dbConfig := bratsutils.LoadExternalDBConfig(databaseType, mutualTLSEnabled, tmpCertDir)
-		bratsutils.CreateDB(dbConfig)
-		defer os.RemoveAll(tmpCertDir)
-		defer bratsutils.DeleteDB(dbConfig)
+		bratsutils.SkipUnlessConfigured(bratsutils.ExternalDBConfigFields(databaseType, mutualTLSEnabled)...)
+
+		tmpCertDir = bratsutils.TempDir("db_tls")
+		config := bratsutils.LoadExternalDBConfig(databaseType, mutualTLSEnabled, tmpCertDir)
+		bratsutils.CreateDB(config)
+		dbConfig = config
 
 		realCACertPath := dbConfig.CACertPath
 		if useIncorrectCA {
@@ -32,7 +55,7 @@ var _ = Describe("Director external database TLS connections", func() {
 			bratsutils.StartInnerBoshWithExpectation(true, "Error: 'bosh/[0-9a-f]{8}-[0-9a-f-]{27} \\(0\\)' is not running after update", startInnerBoshArgs...)
 			dbConfig.CACertPath = realCACertPath
 		} else {
-			defer bratsutils.StopInnerBosh()
+			innerBoshStarted = true
 			bratsutils.StartInnerBosh(startInnerBoshArgs...)
 		}
 	}
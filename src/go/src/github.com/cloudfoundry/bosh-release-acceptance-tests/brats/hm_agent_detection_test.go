@@ -0,0 +1,232 @@
+package brats_test
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	hmDetectionDeployment = "os-conf-deployment"
+
+	hmDetectionNATSPort     = 4222
+	hmDetectionNATSUser     = "brats-nats"
+	hmDetectionNATSPassword = "brats-nats-password"
+
+	hmDetectionPollDirector     = 10 * time.Second
+	hmDetectionAnalyzeAgents    = 10 * time.Second
+	hmDetectionAgentTimeout     = 45 * time.Second
+	hmDetectionRogueAgentAlert  = 30 * time.Second
+	hmDetectionAnalyzeInstances = 10 * time.Second
+
+	// Covers the clocks of this host and the director's VM drifting apart,
+	// and the recorder's round trip.
+	hmDetectionSlack = 15 * time.Second
+
+	rogueHeartbeatInterval = 5 * time.Second
+)
+
+// detectedHeartbeats returns the heartbeats the recorder got since a time
+// from the agents of the deployment, oldest first.
+func detectedHeartbeats(since time.Time) func() []bratsutils.HMHeartbeat {
+	return func() []bratsutils.HMHeartbeat {
+		var heartbeats []bratsutils.HMHeartbeat
+		for _, record := range bratsutils.HMJSONPluginRecords() {
+			if record.Kind() != "heartbeat" || record.ReceivedAt.Before(since) {
+				continue
+			}
+			heartbeat, err := record.Heartbeat()
+			Expect(err).ToNot(HaveOccurred())
+			if heartbeat.Deployment == hmDetectionDeployment {
+				heartbeats = append(heartbeats, heartbeat)
+			}
+		}
+		return heartbeats
+	}
+}
+
+// alertsTitled returns the alerts the recorder got since a time with the
+// given title.
+func alertsTitled(title string, since time.Time) func() []bratsutils.HMAlert {
+	return func() []bratsutils.HMAlert {
+		var alerts []bratsutils.HMAlert
+		for _, alert := range recordedAlerts(since) {
+			if alert.Title == title {
+				alerts = append(alerts, alert)
+			}
+		}
+		return alerts
+	}
+}
+
+// expectRaisedWithin checks the alert was raised within a window after
+// start, give or take the slack.
+func expectRaisedWithin(alert bratsutils.HMAlert, start time.Time, earliest, latest time.Duration) {
+	raisedAfter := time.Unix(alert.CreatedAt, 0).Sub(start)
+	Expect(raisedAfter).To(BeNumerically(">=", earliest-hmDetectionSlack), "alert '%s'", alert.Title)
+	Expect(raisedAfter).To(BeNumerically("<=", latest+hmDetectionSlack), "alert '%s'", alert.Title)
+}
+
+// publishRogueHeartbeats publishes heartbeats for an agent no deployment
+// knows about until the returned function is called.
+func publishRogueHeartbeats(agentID string) func() {
+	publisher, err := bratsutils.NewNATSPublisher(
+		net.JoinHostPort(bratsutils.InnerDirectorIP(), fmt.Sprint(hmDetectionNATSPort)),
+		hmDetectionNATSUser, hmDetectionNATSPassword)
+	Expect(err).ToNot(HaveOccurred())
+
+	heartbeat := []byte(`{"job":null,"index":null,"job_state":"running","vitals":{"load":["0.01","0.02","0.03"]}}`)
+	Expect(publisher.Publish("hm.agent.heartbeat."+agentID, heartbeat)).To(Succeed())
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer GinkgoRecover()
+		defer wg.Done()
+		defer publisher.Close()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(rogueHeartbeatInterval):
+				Expect(publisher.Publish("hm.agent.heartbeat."+agentID, heartbeat)).To(Succeed())
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+var _ = Describe("Health Monitor agent detection", func() {
+	var (
+		since      time.Time
+		heartbeats func() []bratsutils.HMHeartbeat
+	)
+
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+		bratsutils.BuildHMJSONRecorder()
+		bratsutils.StartInnerBosh(
+			"-o", bratsutils.AssetPath("ops-hm-json-plugin-recorder-job.yml"),
+			"-v", fmt.Sprintf("hm-json-recorder-release-path=%s", bratsutils.AssetPath("hm-json-recorder-release")),
+			"-v", fmt.Sprintf("hm-http-port=%d", bratsutils.DefaultHealthMonitorHTTPPort),
+			"-o", bratsutils.AssetPath("ops-hm-intervals.yml"),
+			"-v", fmt.Sprintf("hm-poll-director-interval=%d", int(hmDetectionPollDirector.Seconds())),
+			"-v", fmt.Sprintf("hm-analyze-agents-interval=%d", int(hmDetectionAnalyzeAgents.Seconds())),
+			"-v", fmt.Sprintf("hm-agent-timeout=%d", int(hmDetectionAgentTimeout.Seconds())),
+			"-v", fmt.Sprintf("hm-rogue-agent-alert-interval=%d", int(hmDetectionRogueAgentAlert.Seconds())),
+			"-v", fmt.Sprintf("hm-analyze-instances-interval=%d", int(hmDetectionAnalyzeInstances.Seconds())),
+			"-o", bratsutils.AssetPath("ops-hm-rogue-agents.yml"),
+			"-v", fmt.Sprintf("hm-nats-user=%s", hmDetectionNATSUser),
+			"-v", fmt.Sprintf("hm-nats-password=%s", hmDetectionNATSPassword),
+		)
+
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		bratsutils.UploadRelease(bratsutils.ResolveArtifact("os-conf@12"))
+
+		session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("os-conf-manifest.yml"),
+			"-d", hmDetectionDeployment,
+			"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+		)
+		bratsutils.ExpectDeployExit(session, hmDetectionDeployment, 10*time.Minute, 0)
+
+		since = time.Now()
+		heartbeats = detectedHeartbeats(since)
+	})
+
+	It("alerts about a rogue agent after the rogue agent interval, and forgets it once it times out", func() {
+		agentID := fmt.Sprintf("brats-rogue-%d", time.Now().UnixNano())
+		rogue := alertsTitled(agentID+" is not a part of any deployment", since)
+
+		started := time.Now()
+		stopPublishing := publishRogueHeartbeats(agentID)
+
+		Eventually(rogue, hmDetectionRogueAgentAlert+hmDetectionAnalyzeAgents+time.Minute, 5*time.Second).ShouldNot(BeEmpty())
+		stopped := time.Now()
+		stopPublishing()
+
+		alert := rogue()[0]
+		Expect(alert.Severity).To(Equal(2))
+		Expect(alert.Source).To(Equal(fmt.Sprintf("agent %s []", agentID)))
+		Expect(alert.Deployment).To(BeEmpty())
+		expectRaisedWithin(alert, started, hmDetectionRogueAgentAlert, hmDetectionRogueAgentAlert+hmDetectionAnalyzeAgents)
+
+		By("forgetting the agent without a timeout alert once it goes quiet")
+		time.Sleep(hmDetectionAgentTimeout + 2*hmDetectionAnalyzeAgents - time.Since(stopped))
+		alerted := len(rogue())
+		Consistently(func() int { return len(rogue()) }, 3*hmDetectionAnalyzeAgents, 10*time.Second).Should(Equal(alerted))
+		Expect(alertsTitled(agentID+" has timed out", since)()).To(BeEmpty())
+	})
+
+	It("alerts about a paused agent after the agent timeout, and stops once it resumes", func() {
+		Eventually(heartbeats, 3*time.Minute, 10*time.Second).ShouldNot(BeEmpty())
+		instanceID := heartbeats()[0].InstanceID
+		agentID := heartbeats()[0].AgentID
+		timedOut := alertsTitled(agentID+" has timed out", since)
+
+		pause := hmDetectionAgentTimeout + 3*hmDetectionAnalyzeAgents
+		bratsutils.PauseAgent(hmDetectionDeployment, "test-brats/"+instanceID, pause)
+
+		Eventually(timedOut, pause+time.Minute, 5*time.Second).ShouldNot(BeEmpty())
+
+		alert := timedOut()[0]
+		Expect(alert.Severity).To(Equal(2))
+		Expect(alert.Deployment).To(Equal(hmDetectionDeployment))
+		Expect(alert.Job()).To(Equal("test-brats"))
+
+		var lastHeartbeat int64
+		for _, heartbeat := range heartbeats() {
+			if heartbeat.AgentID == agentID && heartbeat.Timestamp < alert.CreatedAt && heartbeat.Timestamp > lastHeartbeat {
+				lastHeartbeat = heartbeat.Timestamp
+			}
+		}
+		expectRaisedWithin(alert, time.Unix(lastHeartbeat, 0), hmDetectionAgentTimeout, hmDetectionAgentTimeout+hmDetectionAnalyzeAgents)
+
+		By("hearing from the agent again once it resumes")
+		Eventually(func() []int64 {
+			var resumed []int64
+			for _, heartbeat := range heartbeats() {
+				if heartbeat.AgentID == agentID && heartbeat.Timestamp > alert.CreatedAt {
+					resumed = append(resumed, heartbeat.Timestamp)
+				}
+			}
+			return resumed
+		}, pause+time.Minute, 10*time.Second).ShouldNot(BeEmpty())
+
+		alerted := len(timedOut())
+		Consistently(func() int { return len(timedOut()) }, 3*hmDetectionAnalyzeAgents, 10*time.Second).Should(Equal(alerted))
+	})
+
+	It("alerts about an instance whose VM is gone after polling the director", func() {
+		instances, err := bratsutils.Director().Instances(hmDetectionDeployment)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(instances).To(HaveLen(1))
+		noVM := alertsTitled(instances[0].ID+" has no VM", since)
+
+		session := bratsutils.Bosh("-n", "-d", hmDetectionDeployment, "delete-vm", instances[0].CID)
+		Eventually(session, 5*time.Minute).Should(gexec.Exit(0))
+		deleted := time.Now()
+
+		Eventually(noVM, hmDetectionPollDirector+hmDetectionAnalyzeInstances+time.Minute, 5*time.Second).ShouldNot(BeEmpty())
+
+		alert := noVM()[0]
+		Expect(alert.Severity).To(Equal(2))
+		Expect(alert.Deployment).To(Equal(hmDetectionDeployment))
+		expectRaisedWithin(alert, deleted, 0, hmDetectionPollDirector+hmDetectionAnalyzeInstances)
+
+		By("raising it again on every analysis")
+		Eventually(func() int { return len(noVM()) }, 3*hmDetectionAnalyzeInstances+hmDetectionSlack, 5*time.Second).Should(BeNumerically(">=", 2))
+	})
+})
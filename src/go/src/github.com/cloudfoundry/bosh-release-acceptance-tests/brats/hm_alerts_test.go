@@ -0,0 +1,151 @@
+package brats_test
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	hmAlertsDeployment        = "syslog-deployment"
+	hmAlertsJob               = "syslog_storer"
+	hmPagerDutyServiceName    = "pagerduty-brats"
+	hmAlertSeverityAlert      = 1
+	hmAlertsConsistentlyFor   = 30 * time.Second
+	hmAlertsEventuallyTimeout = 3 * time.Minute
+)
+
+// Like the metric receivers, these outlive each spec so the inner director
+// is reused.
+var (
+	pagerDutyReceiver *bratsutils.PagerDutyReceiver
+	datadogReceiver   *bratsutils.DatadogReceiver
+)
+
+func startAlertReceivers() {
+	var err error
+
+	if pagerDutyReceiver == nil {
+		pagerDutyReceiver, err = bratsutils.NewPagerDutyReceiver("0.0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+	}
+	if datadogReceiver == nil {
+		datadogReceiver, err = bratsutils.NewDatadogReceiver("0.0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	pagerDutyReceiver.Reset()
+	datadogReceiver.Reset()
+}
+
+// The health monitor also forwards the director's own alerts, e.g. about
+// deploys, so only alerts about the stopped job count.
+func pagerDutyJobAlerts() []bratsutils.PagerDutyEvent {
+	var alerts []bratsutils.PagerDutyEvent
+	for _, event := range pagerDutyReceiver.Events() {
+		if event.Details.Deployment == hmAlertsDeployment && event.Details.Job() == hmAlertsJob {
+			alerts = append(alerts, event)
+		}
+	}
+	return alerts
+}
+
+func datadogJobAlerts() []bratsutils.DatadogEvent {
+	var alerts []bratsutils.DatadogEvent
+	for _, event := range datadogReceiver.Events() {
+		for _, tag := range event.Tags {
+			if strings.HasPrefix(tag, fmt.Sprintf("source:%s: %s(", hmAlertsDeployment, hmAlertsJob)) {
+				alerts = append(alerts, event)
+				break
+			}
+		}
+	}
+	return alerts
+}
+
+var _ = Describe("Health Monitor alert delivery", func() {
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+		startAlertReceivers()
+
+		host := bratsutils.InnerBoshDirector().HostAddress()
+		bratsutils.StartInnerBosh(
+			"-o", bratsutils.AssetPath("ops-hm-alert-forwarders.yml"),
+			"-v", "hm-pagerduty-service-key=brats-service-key",
+			"-v", fmt.Sprintf("hm-pagerduty-api-uri=%s", pagerDutyReceiver.EventsURL(host)),
+			"-v", "hm-datadog-api-key=brats-api-key",
+			"-v", "hm-datadog-application-key=brats-application-key",
+			"-v", fmt.Sprintf("hm-datadog-api-host=%s", datadogReceiver.URL(host)),
+			"-v", fmt.Sprintf("hm-datadog-pagerduty-service-name=%s", hmPagerDutyServiceName),
+		)
+
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		bratsutils.UploadRelease(bratsutils.ResolveArtifact("syslog@11"))
+
+		session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("syslog-manifest.yml"),
+			"-d", hmAlertsDeployment,
+			"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+		)
+		bratsutils.ExpectDeployExit(session, hmAlertsDeployment, 10*time.Minute, 0)
+	})
+
+	It("sends exactly one alert to PagerDuty and Datadog when a job stops", func() {
+		By("killing the job's process behind monit's back")
+		session := bratsutils.Bosh("-d", hmAlertsDeployment, "ssh", hmAlertsJob+"/0", "-c",
+			fmt.Sprintf(`sudo kill -9 $(sudo /var/vcap/bosh/bin/monit status %s | awk '$1 == "pid" { print $2 }')`, hmAlertsJob))
+		Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+
+		By("delivering the alert to PagerDuty")
+		Eventually(pagerDutyJobAlerts, hmAlertsEventuallyTimeout, 5*time.Second).ShouldNot(BeEmpty())
+		Consistently(pagerDutyJobAlerts, hmAlertsConsistentlyFor, 5*time.Second).Should(HaveLen(1))
+
+		alert := pagerDutyJobAlerts()[0]
+		Expect(alert.ServiceKey).To(Equal("brats-service-key"))
+		Expect(alert.EventType).To(Equal("trigger"))
+		Expect(alert.IncidentKey).To(Equal(alert.Details.ID))
+		Expect(alert.Details.Severity).To(Equal(hmAlertSeverityAlert))
+		Expect(alert.Details.Kind).To(Equal("alert"))
+
+		By("delivering the same alert to Datadog, paging the PagerDuty service")
+		Eventually(datadogJobAlerts, hmAlertsEventuallyTimeout, 5*time.Second).ShouldNot(BeEmpty())
+		Consistently(datadogJobAlerts, hmAlertsConsistentlyFor, 5*time.Second).Should(HaveLen(1))
+
+		event := datadogJobAlerts()[0]
+		Expect(event.Title).To(Equal(alert.Details.Title))
+		Expect(event.Text).To(HaveSuffix("@" + hmPagerDutyServiceName))
+		Expect(event.Priority).To(Equal("normal"))
+		Expect(event.AlertType).To(Equal("error"))
+		Expect(event.Tags).To(ContainElement("deployment:" + hmAlertsDeployment))
+		Expect(event.Tags).To(ContainElement("env:brats"))
+		Expect(event.Tags).To(ContainElement("suite:hm-alerts"))
+
+		for _, request := range datadogReceiver.Requests() {
+			Expect(request.Query.Get("api_key")).To(Equal("brats-api-key"))
+		}
+	})
+
+	It("tags the job's heartbeat metrics in Datadog with the custom tags", func() {
+		Eventually(func() []bratsutils.DatadogSeries {
+			var healthy []bratsutils.DatadogSeries
+			for _, series := range datadogReceiver.Series() {
+				if series.Metric == "bosh.healthmonitor.system.healthy" {
+					healthy = append(healthy, series)
+				}
+			}
+			return healthy
+		}, hmAlertsEventuallyTimeout, 5*time.Second).Should(ContainElement(
+			WithTransform(func(s bratsutils.DatadogSeries) []string { return s.Tags }, SatisfyAll(
+				ContainElement("job:"+hmAlertsJob),
+				ContainElement("deployment:"+hmAlertsDeployment),
+				ContainElement("env:brats"),
+				ContainElement("suite:hm-alerts"),
+			)),
+		))
+	})
+})
@@ -0,0 +1,252 @@
+package brats_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	hmAPIDeployment = "os-conf-deployment"
+
+	// Not the default, to check the health monitor picks up hm.http.port.
+	hmAPIHTTPPort = 25924
+
+	hmAPIAnalyzeAgentsInterval = 10 * time.Second
+	hmAPIAgentTimeout          = 60 * time.Second
+)
+
+// recordedHeartbeats returns the heartbeats the recorder got since a time
+// from the agents of the deployment, oldest first. The recorder's file
+// outlives the specs, as does the director.
+func recordedHeartbeats(since time.Time) func() []bratsutils.HMHeartbeat {
+	return func() []bratsutils.HMHeartbeat {
+		var heartbeats []bratsutils.HMHeartbeat
+		for _, record := range bratsutils.HMJSONPluginRecords() {
+			if record.Kind() != "heartbeat" || record.ReceivedAt.Before(since) {
+				continue
+			}
+			heartbeat, err := record.Heartbeat()
+			Expect(err).ToNot(HaveOccurred())
+			if heartbeat.Deployment == hmAPIDeployment {
+				heartbeats = append(heartbeats, heartbeat)
+			}
+		}
+		return heartbeats
+	}
+}
+
+func recordedAlerts(since time.Time) []bratsutils.HMAlert {
+	var alerts []bratsutils.HMAlert
+	for _, record := range bratsutils.HMJSONPluginRecords() {
+		if record.Kind() != "alert" || record.ReceivedAt.Before(since) {
+			continue
+		}
+		alert, err := record.Alert()
+		Expect(err).ToNot(HaveOccurred())
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+var _ = Describe("Health Monitor API", func() {
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+		bratsutils.BuildHMJSONRecorder()
+		bratsutils.StartInnerBosh(
+			"-o", bratsutils.AssetPath("ops-hm-json-plugin-recorder-job.yml"),
+			"-v", fmt.Sprintf("hm-json-recorder-release-path=%s", bratsutils.AssetPath("hm-json-recorder-release")),
+			"-v", fmt.Sprintf("hm-http-port=%d", hmAPIHTTPPort),
+			"-v", fmt.Sprintf("hm-analyze-agents-interval=%d", int(hmAPIAnalyzeAgentsInterval.Seconds())),
+			"-v", fmt.Sprintf("hm-agent-timeout=%d", int(hmAPIAgentTimeout.Seconds())),
+		)
+
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		bratsutils.UploadRelease(bratsutils.ResolveArtifact("os-conf@12"))
+
+		session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("os-conf-manifest.yml"),
+			"-d", hmAPIDeployment,
+			"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+		)
+		bratsutils.ExpectDeployExit(session, hmAPIDeployment, 10*time.Minute, 0)
+	})
+
+	Context("over HTTP", func() {
+		var (
+			client     *bratsutils.HealthMonitorClient
+			stopTunnel func()
+		)
+
+		BeforeEach(func() {
+			client, stopTunnel = bratsutils.TunnelToHealthMonitor(hmAPIHTTPPort)
+		})
+
+		AfterEach(func() {
+			stopTunnel()
+		})
+
+		It("reports a recent pulse of its event loop on the configured port", func() {
+			healthz, err := client.Healthz()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(healthz.StatusCode).To(Equal(200))
+			Expect(healthz.LastPulse).To(BeNumerically("<", 5*time.Second))
+		})
+
+		It("serves nothing but healthz", func() {
+			// Agents and alerts only reach the outside through plugins.
+			for _, path := range []string{"/", "/agents", "/alerts", "/events"} {
+				status, _, err := client.Get(path)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(status).To(Equal(404), "GET %s", path)
+			}
+		})
+	})
+
+	Context("through a JSON plugin", func() {
+		var (
+			since      time.Time
+			heartbeats func() []bratsutils.HMHeartbeat
+		)
+
+		BeforeEach(func() {
+			since = time.Now()
+			heartbeats = recordedHeartbeats(since)
+		})
+
+		It("sends heartbeats following the event schema", func() {
+			Eventually(heartbeats, 3*time.Minute, 10*time.Second).ShouldNot(BeEmpty())
+
+			for _, heartbeat := range heartbeats() {
+				Expect(heartbeat.Kind).To(Equal("heartbeat"))
+				Expect(heartbeat.ID).ToNot(BeEmpty())
+				Expect(heartbeat.Timestamp).To(BeNumerically(">", 0))
+				Expect(heartbeat.AgentID).ToNot(BeEmpty())
+				Expect(heartbeat.Job).To(Equal("test-brats"))
+				Expect(heartbeat.Index).To(Equal("0"))
+				Expect(heartbeat.InstanceID).ToNot(BeEmpty())
+				Expect(heartbeat.JobState).To(Equal("running"))
+				Expect(heartbeat.Vitals).To(HaveKey("cpu"))
+				Expect(heartbeat.Vitals).To(HaveKey("disk"))
+				Expect(heartbeat.Vitals).To(HaveKey("load"))
+				Expect(heartbeat.Vitals).To(HaveKey("mem"))
+
+				var names []string
+				for _, metric := range heartbeat.Metrics {
+					names = append(names, metric.Name)
+					Expect(metric.Timestamp).To(Equal(heartbeat.Timestamp))
+					Expect(metric.Tags).To(Equal(map[string]string{
+						"job":   heartbeat.Job,
+						"index": heartbeat.Index,
+						"id":    heartbeat.InstanceID,
+					}))
+				}
+				Expect(names).To(ContainElement("system.load.1m"))
+				Expect(names).To(ContainElement("system.cpu.user"))
+				Expect(names).To(ContainElement("system.mem.percent"))
+				Expect(names).To(ContainElement("system.healthy"))
+			}
+		})
+
+		It("sends every agent's heartbeats more often than the agent timeout", func() {
+			Eventually(func() int { return len(heartbeats()) }, 5*time.Minute, 15*time.Second).Should(BeNumerically(">=", 4))
+
+			timestamps := map[string][]int64{}
+			for _, heartbeat := range heartbeats() {
+				timestamps[heartbeat.AgentID] = append(timestamps[heartbeat.AgentID], heartbeat.Timestamp)
+			}
+
+			for agentID, agentTimestamps := range timestamps {
+				sort.Slice(agentTimestamps, func(i, j int) bool { return agentTimestamps[i] < agentTimestamps[j] })
+				for i := 1; i < len(agentTimestamps); i++ {
+					gap := time.Duration(agentTimestamps[i]-agentTimestamps[i-1]) * time.Second
+					Expect(gap).To(BeNumerically(">", 0), "agent %s", agentID)
+					Expect(gap).To(BeNumerically("<", hmAPIAgentTimeout), "agent %s", agentID)
+				}
+			}
+
+			for _, alert := range recordedAlerts(since) {
+				Expect(alert.Title).ToNot(HaveSuffix("has timed out"))
+			}
+		})
+
+		It("sends an alert once an agent misses the agent timeout", func() {
+			Eventually(heartbeats, 3*time.Minute, 10*time.Second).ShouldNot(BeEmpty())
+			instanceID := heartbeats()[0].InstanceID
+			agentID := heartbeats()[0].AgentID
+
+			bratsutils.StopAgent(hmAPIDeployment, "test-brats/"+instanceID)
+
+			timedOut := func() []bratsutils.HMAlert {
+				var timedOut []bratsutils.HMAlert
+				for _, alert := range recordedAlerts(since) {
+					if alert.Title == agentID+" has timed out" {
+						timedOut = append(timedOut, alert)
+					}
+				}
+				return timedOut
+			}
+			Eventually(timedOut, hmAPIAgentTimeout+3*time.Minute, 15*time.Second).ShouldNot(BeEmpty())
+
+			alert := timedOut()[0]
+			Expect(alert.Severity).To(Equal(2))
+			Expect(alert.Deployment).To(Equal(hmAPIDeployment))
+			Expect(alert.Job()).To(Equal("test-brats"))
+
+			var lastHeartbeat int64
+			for _, heartbeat := range heartbeats() {
+				if heartbeat.AgentID == agentID && heartbeat.Timestamp > lastHeartbeat {
+					lastHeartbeat = heartbeat.Timestamp
+				}
+			}
+			silence := time.Duration(alert.CreatedAt-lastHeartbeat) * time.Second
+			Expect(silence).To(BeNumerically(">=", hmAPIAgentTimeout))
+			Expect(silence).To(BeNumerically("<=", hmAPIAgentTimeout+hmAPIAnalyzeAgentsInterval+15*time.Second))
+		})
+
+		It("restarts the plugin after it crashes", func() {
+			Eventually(heartbeats, 3*time.Minute, 10*time.Second).ShouldNot(BeEmpty())
+
+			crashed := map[int]bool{}
+			for _, record := range bratsutils.HMJSONPluginRecords() {
+				crashed[record.PID] = true
+			}
+
+			session := bratsutils.OuterBosh("-d", bratsutils.InnerBoshDirectorName(), "ssh", "bosh", "-c",
+				"sudo pkill -9 -x hm-json-recorder")
+			Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+
+			restarted := func() []bratsutils.HMJSONPluginRecord {
+				var records []bratsutils.HMJSONPluginRecord
+				for _, record := range bratsutils.HMJSONPluginRecords() {
+					if !crashed[record.PID] {
+						records = append(records, record)
+					}
+				}
+				return records
+			}
+
+			Eventually(restarted, time.Minute, 5*time.Second).ShouldNot(BeEmpty())
+			Expect(restarted()[0].Started).To(BeTrue())
+
+			By("receiving events in the restarted process")
+			Eventually(func() []string {
+				var kinds []string
+				for _, record := range restarted() {
+					kinds = append(kinds, record.Kind())
+				}
+				return kinds
+			}, 3*time.Minute, 10*time.Second).Should(ContainElement("heartbeat"))
+
+			for _, record := range bratsutils.HMJSONPluginRecords() {
+				Expect(strings.TrimSpace(record.Invalid)).To(BeEmpty())
+			}
+		})
+	})
+})
@@ -0,0 +1,189 @@
+package brats_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	hmConsulDeployment = "syslog-deployment"
+	hmConsulNamespace  = "brats-"
+	hmConsulACLToken   = "brats-acl-token"
+	hmConsulTTL        = "120s"
+	hmConsulTTLNote    = "Registered by BRATS"
+
+	// Consul rejects event payloads from 512 bytes on.
+	consulMaxEventPayload = 512
+)
+
+// Kept across specs so the director is reused, and with it the checks the
+// health monitor registered.
+var consulReceiver *bratsutils.ConsulReceiver
+
+func startConsulReceiver() {
+	if consulReceiver == nil {
+		var err error
+		consulReceiver, err = bratsutils.NewConsulReceiver("0.0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	consulReceiver.Reset()
+}
+
+// consulHeartbeatPayload is what the plugin boils a heartbeat down to so it
+// fits into a Consul event.
+type consulHeartbeatPayload struct {
+	Agent string `json:"agent"`
+	Name  string `json:"name"`
+	ID    string `json:"id"`
+	State string `json:"state"`
+	Data  struct {
+		CPU  []string `json:"cpu"`
+		Disk struct {
+			Ephemeral []string `json:"eph"`
+			System    []string `json:"sys"`
+		} `json:"dsk"`
+		Load   []string `json:"ld"`
+		Memory []string `json:"mem"`
+		Swap   []string `json:"swp"`
+	} `json:"data"`
+}
+
+var _ = Describe("Health Monitor consul event forwarding", func() {
+	instanceLabel := regexp.MustCompile(fmt.Sprintf(`^%s(syslog_storer|syslog_forwarder)_([0-9a-f-]{36})$`, regexp.QuoteMeta(hmConsulNamespace)))
+
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+		startConsulReceiver()
+
+		bratsutils.StartInnerBosh(
+			"-o", bratsutils.AssetPath("ops-hm-consul-event-forwarder.yml"),
+			"-v", fmt.Sprintf("hm-receiver-host=%s", bratsutils.InnerBoshDirector().HostAddress()),
+			"-v", fmt.Sprintf("hm-consul-port=%d", consulReceiver.Port()),
+			"-v", fmt.Sprintf("hm-consul-acl-token=%s", hmConsulACLToken),
+			"-v", fmt.Sprintf("hm-consul-namespace=%s", hmConsulNamespace),
+			"-v", fmt.Sprintf("hm-consul-ttl=%s", hmConsulTTL),
+			"-v", fmt.Sprintf("hm-consul-ttl-note=%s", hmConsulTTLNote),
+		)
+
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		bratsutils.UploadRelease(bratsutils.ResolveArtifact("syslog@11"))
+
+		session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("syslog-manifest.yml"),
+			"-d", hmConsulDeployment,
+			"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+		)
+		bratsutils.ExpectDeployExit(session, hmConsulDeployment, 10*time.Minute, 0)
+	})
+
+	It("registers a namespaced TTL check per instance and passes it while the jobs run", func() {
+		// Reset keeps the checks, so those of earlier specs' instances are
+		// still around on a reused director.
+		instances, err := bratsutils.Director().Instances(hmConsulDeployment)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(instances).To(HaveLen(2))
+		deployed := map[string]bool{}
+		for _, instance := range instances {
+			deployed[instance.ID] = true
+		}
+
+		checks := func() []bratsutils.ConsulCheck {
+			var current []bratsutils.ConsulCheck
+			for _, check := range consulReceiver.Checks() {
+				if label := instanceLabel.FindStringSubmatch(check.ID); label != nil && deployed[label[2]] {
+					current = append(current, check)
+				}
+			}
+			return current
+		}
+
+		Eventually(func() []bratsutils.ConsulCheck {
+			var passing []bratsutils.ConsulCheck
+			for _, check := range checks() {
+				if check.Status == "passing" {
+					passing = append(passing, check)
+				}
+			}
+			return passing
+		}, 3*time.Minute, 5*time.Second).Should(HaveLen(2))
+
+		for _, check := range checks() {
+			Expect(check.Name).To(Equal(check.ID))
+			Expect(check.Notes).To(Equal(hmConsulTTLNote))
+			Expect(check.TTL).To(Equal(hmConsulTTL))
+		}
+
+		for _, request := range consulReceiver.Requests() {
+			Expect(request.Query.Get("token")).To(Equal(hmConsulACLToken), "request to %s", request.Path)
+		}
+	})
+
+	It("fires heartbeats as events named after the instance, with a trimmed payload", func() {
+		Eventually(func() []bratsutils.ConsulEvent {
+			var heartbeats []bratsutils.ConsulEvent
+			for _, event := range consulReceiver.Events() {
+				if instanceLabel.MatchString(event.Name) {
+					heartbeats = append(heartbeats, event)
+				}
+			}
+			return heartbeats
+		}, 3*time.Minute, 5*time.Second).ShouldNot(BeEmpty())
+
+		for _, event := range consulReceiver.Events() {
+			label := instanceLabel.FindStringSubmatch(event.Name)
+			if label == nil {
+				continue
+			}
+
+			Expect(len(event.Payload)).To(BeNumerically("<", consulMaxEventPayload))
+
+			var payload consulHeartbeatPayload
+			Expect(json.Unmarshal(event.Payload, &payload)).To(Succeed())
+			Expect(payload.Name).To(Equal(label[1] + "/" + label[2]))
+			Expect(payload.ID).To(Equal(label[2]))
+			Expect(payload.Agent).ToNot(BeEmpty())
+			Expect(payload.State).To(Equal("running"))
+			Expect(payload.Data.CPU).ToNot(BeEmpty())
+			Expect(payload.Data.Disk.System).ToNot(BeEmpty())
+			Expect(payload.Data.Load).To(HaveLen(3))
+			Expect(payload.Data.Memory).To(HaveLen(2))
+		}
+	})
+
+	It("fires alerts as events named after their title, with the whole alert as payload", func() {
+		By("killing the job's process behind monit's back")
+		session := bratsutils.Bosh("-d", hmConsulDeployment, "ssh", "syslog_storer/0", "-c",
+			`sudo kill -9 $(sudo /var/vcap/bosh/bin/monit status syslog_storer | awk '$1 == "pid" { print $2 }')`)
+		Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+
+		alerts := func() []bratsutils.HMAlert {
+			var alerts []bratsutils.HMAlert
+			for _, event := range consulReceiver.Events() {
+				var alert bratsutils.HMAlert
+				if json.Unmarshal(event.Payload, &alert) != nil || alert.Kind != "alert" || alert.Job() != "syslog_storer" {
+					continue
+				}
+
+				// "syslog_storer (10.245.0.3) - Does not exist - restart"
+				// becomes "brats-syslog_storer_(10.245.0.3)_-_does_not_exist_-_restart".
+				Expect(event.Name).To(Equal(hmConsulNamespace + strings.Replace(strings.ToLower(alert.Title), " ", "_", -1)))
+				alerts = append(alerts, alert)
+			}
+			return alerts
+		}
+
+		Eventually(alerts, 3*time.Minute, 5*time.Second).Should(ContainElement(SatisfyAll(
+			WithTransform(func(a bratsutils.HMAlert) int { return a.Severity }, Equal(1)),
+			WithTransform(func(a bratsutils.HMAlert) string { return a.Deployment }, Equal(hmConsulDeployment)),
+		)))
+	})
+})
@@ -0,0 +1,157 @@
+package brats_test
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	hmEmailDeployment = "syslog-deployment"
+	hmEmailInterval   = 30 * time.Second
+	hmEmailUser       = "brats-hm"
+)
+
+var (
+	hmEmailRecipients = []string{"ops@brats.test", "oncall@brats.test"}
+	hmEmailSubject    = regexp.MustCompile(`^(\d+) alerts? from BOSH Health Monitor$`)
+
+	// One sink per mode, kept across specs so the director is reused.
+	smtpSinks = map[bool]*bratsutils.SMTPSink{}
+)
+
+func startSMTPSink(startTLS bool) *bratsutils.SMTPSink {
+	if smtpSinks[startTLS] == nil {
+		sink, err := bratsutils.NewSMTPSink("0.0.0.0", startTLS)
+		Expect(err).ToNot(HaveOccurred())
+		smtpSinks[startTLS] = sink
+	}
+
+	smtpSinks[startTLS].Reset()
+	return smtpSinks[startTLS]
+}
+
+// mailedAlerts returns the body of every alert mailed so far. The plugin
+// separates alerts with an empty line.
+func mailedAlerts(sink *bratsutils.SMTPSink) []string {
+	var alerts []string
+	for _, message := range sink.Messages() {
+		for _, alert := range strings.Split(message.Body, "\n\n") {
+			if strings.TrimSpace(alert) != "" {
+				alerts = append(alerts, alert)
+			}
+		}
+	}
+	return alerts
+}
+
+func alertsAbout(sink *bratsutils.SMTPSink, substrings ...string) func() []string {
+	return func() []string {
+		var matching []string
+		for _, alert := range mailedAlerts(sink) {
+			matches := true
+			for _, substring := range substrings {
+				matches = matches && strings.Contains(alert, substring)
+			}
+			if matches {
+				matching = append(matching, alert)
+			}
+		}
+		return matching
+	}
+}
+
+func describeHMEmailNotifications(startTLS bool) {
+	var sink *bratsutils.SMTPSink
+
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+		sink = startSMTPSink(startTLS)
+
+		bratsutils.StartInnerBosh(
+			"-o", bratsutils.AssetPath("ops-hm-email.yml"),
+			"-v", fmt.Sprintf("hm-receiver-host=%s", bratsutils.InnerBoshDirector().HostAddress()),
+			"-v", fmt.Sprintf("hm-smtp-port=%d", sink.Port()),
+			"-v", fmt.Sprintf("hm-smtp-tls=%t", startTLS),
+			"-v", fmt.Sprintf("hm-smtp-user=%s", hmEmailUser),
+			"-v", "hm-smtp-password=brats-password",
+			"-v", fmt.Sprintf("hm-email-interval=%d", int(hmEmailInterval.Seconds())),
+		)
+
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		bratsutils.UploadRelease(bratsutils.ResolveArtifact("syslog@11"))
+
+		session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("syslog-manifest.yml"),
+			"-d", hmEmailDeployment,
+			"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+		)
+		bratsutils.ExpectDeployExit(session, hmEmailDeployment, 10*time.Minute, 0)
+
+		By("waiting for the deploy's own alerts to go out")
+		Eventually(alertsAbout(sink, "director - finish update deployment"), 3*hmEmailInterval, 5*time.Second).ShouldNot(BeEmpty())
+		sink.Reset()
+	})
+
+	It("mails process-failing alerts to the recipients, batched per interval", func() {
+		By("killing the monitored processes of every instance behind monit's back")
+		session := bratsutils.Bosh("-d", hmEmailDeployment, "ssh", "-c",
+			`for pid in $(sudo /var/vcap/bosh/bin/monit status | awk '$1 == "pid" { print $2 }'); do sudo kill -9 $pid; done`)
+		Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+
+		Eventually(alertsAbout(sink, hmEmailDeployment+": syslog_storer(", "Severity: 1"), 3*time.Minute, 5*time.Second).ShouldNot(BeEmpty())
+		Eventually(alertsAbout(sink, hmEmailDeployment+": syslog_forwarder(", "Severity: 1"), 3*time.Minute, 5*time.Second).ShouldNot(BeEmpty())
+
+		messages := sink.Messages()
+		for i, message := range messages {
+			Expect(message.From).To(Equal("bosh-hm@brats.test"))
+			Expect(message.Recipients).To(ConsistOf(hmEmailRecipients))
+			Expect(message.Header.Get("To")).To(Equal(strings.Join(hmEmailRecipients, ", ")))
+			Expect(message.TLS).To(Equal(startTLS))
+			Expect(message.Username).To(Equal(hmEmailUser))
+
+			// Every alert of a batch counts towards its subject.
+			subject := hmEmailSubject.FindStringSubmatch(message.Subject())
+			Expect(subject).ToNot(BeNil(), "unexpected subject '%s'", message.Subject())
+			count, err := strconv.Atoi(subject[1])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Count(message.Body, "\nSeverity: ")).To(Equal(count))
+
+			// At most one mail goes out per interval.
+			if i > 0 {
+				Expect(message.ReceivedAt.Sub(messages[i-1].ReceivedAt)).To(BeNumerically(">", hmEmailInterval-5*time.Second))
+			}
+		}
+	})
+
+	It("mails an alert when an agent stops responding", func() {
+		By("stopping the agent once the ssh session is cleaned up")
+		session := bratsutils.Bosh("-d", hmEmailDeployment, "ssh", "syslog_forwarder/0", "-c",
+			`sudo nohup sh -c 'sleep 10; sv stop agent' >/dev/null 2>&1 &`)
+		Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+
+		Eventually(alertsAbout(sink, hmEmailDeployment+": syslog_forwarder(", "has timed out", "Severity: 2"), 5*time.Minute, 5*time.Second).ShouldNot(BeEmpty())
+
+		for _, message := range sink.Messages() {
+			Expect(message.Recipients).To(ConsistOf(hmEmailRecipients))
+			Expect(message.Subject()).To(MatchRegexp(hmEmailSubject.String()))
+		}
+	})
+}
+
+var _ = Describe("Health Monitor email notifications", func() {
+	Context("over plain SMTP", func() {
+		describeHMEmailNotifications(false)
+	})
+
+	Context("over STARTTLS", func() {
+		describeHMEmailNotifications(true)
+	})
+})
@@ -0,0 +1,129 @@
+package brats_test
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	hmMetricsDeployment = "os-conf-deployment"
+	hmGraphitePrefix    = "brats"
+)
+
+// The receivers outlive each spec so that their ports, and with them the
+// inner director's configuration, stay the same and the director is reused.
+var (
+	graphiteReceiver *bratsutils.GraphiteReceiver
+	tsdbReceiver     *bratsutils.TSDBReceiver
+	riemannReceiver  *bratsutils.RiemannReceiver
+)
+
+func startMetricReceivers() {
+	var err error
+
+	if graphiteReceiver == nil {
+		graphiteReceiver, err = bratsutils.NewGraphiteReceiver("0.0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+	}
+	if tsdbReceiver == nil {
+		tsdbReceiver, err = bratsutils.NewTSDBReceiver("0.0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+	}
+	if riemannReceiver == nil {
+		riemannReceiver, err = bratsutils.NewRiemannReceiver("0.0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	graphiteReceiver.Reset()
+	tsdbReceiver.Reset()
+	riemannReceiver.Reset()
+}
+
+var _ = Describe("Health Monitor metric forwarding", func() {
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+		startMetricReceivers()
+
+		bratsutils.StartInnerBosh(
+			"-o", bratsutils.AssetPath("ops-hm-metric-forwarders.yml"),
+			"-v", fmt.Sprintf("hm-receiver-host=%s", bratsutils.InnerBoshDirector().HostAddress()),
+			"-v", fmt.Sprintf("hm-graphite-port=%d", graphiteReceiver.Port()),
+			"-v", fmt.Sprintf("hm-graphite-prefix=%s", hmGraphitePrefix),
+			"-v", fmt.Sprintf("hm-tsdb-port=%d", tsdbReceiver.Port()),
+			"-v", fmt.Sprintf("hm-riemann-port=%d", riemannReceiver.Port()),
+		)
+
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		bratsutils.UploadRelease(bratsutils.ResolveArtifact("os-conf@12"))
+
+		session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("os-conf-manifest.yml"),
+			"-d", hmMetricsDeployment,
+			"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+		)
+		bratsutils.ExpectDeployExit(session, hmMetricsDeployment, 10*time.Minute, 0)
+	})
+
+	It("forwards heartbeat metrics to Graphite under the prefix", func() {
+		// prefix.deployment.job.instance_id.agent_id.metric, with dots in the
+		// metric name replaced.
+		name := regexp.MustCompile(fmt.Sprintf(`^%s\.%s\.test-brats\.[0-9a-f-]{36}\.[0-9a-f-]{36}\.system_healthy$`,
+			regexp.QuoteMeta(hmGraphitePrefix), regexp.QuoteMeta(hmMetricsDeployment)))
+
+		Eventually(func() []string {
+			var healthy []string
+			for _, metric := range graphiteReceiver.Metrics() {
+				if name.MatchString(metric.Name) {
+					healthy = append(healthy, metric.Value)
+				}
+			}
+			return healthy
+		}, 3*time.Minute, 5*time.Second).Should(ContainElement("1"))
+	})
+
+	It("forwards heartbeat metrics to OpenTSDB with instance tags", func() {
+		Eventually(func() []bratsutils.TSDBMetric {
+			var healthy []bratsutils.TSDBMetric
+			for _, metric := range tsdbReceiver.Metrics() {
+				if metric.Name == "system.healthy" {
+					healthy = append(healthy, metric)
+				}
+			}
+			return healthy
+		}, 3*time.Minute, 5*time.Second).Should(ContainElement(SatisfyAll(
+			WithTransform(func(m bratsutils.TSDBMetric) string { return m.Value }, Equal("1")),
+			WithTransform(func(m bratsutils.TSDBMetric) map[string]string { return m.Tags }, SatisfyAll(
+				HaveKeyWithValue("deployment", hmMetricsDeployment),
+				HaveKeyWithValue("job", "test-brats"),
+				HaveKeyWithValue("index", "0"),
+				HaveKey("id"),
+			)),
+		)))
+	})
+
+	It("forwards heartbeat metrics to Riemann as bosh.hm events", func() {
+		Eventually(func() []bratsutils.RiemannEvent {
+			var healthy []bratsutils.RiemannEvent
+			for _, event := range riemannReceiver.Events() {
+				if event.Attributes["name"] == "system.healthy" {
+					healthy = append(healthy, event)
+				}
+			}
+			return healthy
+		}, 3*time.Minute, 5*time.Second).Should(ContainElement(SatisfyAll(
+			WithTransform(func(e bratsutils.RiemannEvent) string { return e.Service }, Equal("bosh.hm")),
+			WithTransform(func(e bratsutils.RiemannEvent) float64 { return e.Metric }, Equal(1.0)),
+			WithTransform(func(e bratsutils.RiemannEvent) map[string]string { return e.Attributes }, SatisfyAll(
+				HaveKeyWithValue("deployment", hmMetricsDeployment),
+				HaveKeyWithValue("job", "test-brats"),
+				HaveKeyWithValue("kind", "heartbeat"),
+				HaveKey("agent_id"),
+			)),
+		)))
+	})
+})
@@ -0,0 +1,127 @@
+package brats_test
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	hmSyslogDeployment = "os-conf-deployment"
+
+	// The syslog release tags every line it forwards with where it came from.
+	syslogInstanceSDID = "instance@47450"
+)
+
+// Kept across specs so the director is reused.
+var syslogReceiver *bratsutils.SyslogReceiver
+
+func startSyslogReceiver() {
+	if syslogReceiver == nil {
+		var err error
+		syslogReceiver, err = bratsutils.NewSyslogReceiver("0.0.0.0")
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	syslogReceiver.Reset()
+}
+
+// healthMonitorLogLines returns the health monitor's log lines forwarded so
+// far that contain substring.
+func healthMonitorLogLines(substring string) func() []bratsutils.SyslogMessage {
+	return func() []bratsutils.SyslogMessage {
+		var lines []bratsutils.SyslogMessage
+		for _, message := range syslogReceiver.Messages() {
+			if message.AppName == "health_monitor" && strings.Contains(message.Message, substring) {
+				lines = append(lines, message)
+			}
+		}
+		return lines
+	}
+}
+
+var heartbeatsReceivedPattern = regexp.MustCompile(`Agent heartbeats received = (\d+)`)
+
+// heartbeatsReceived reads the count from a health monitor stats line.
+func heartbeatsReceived(message bratsutils.SyslogMessage) int {
+	match := heartbeatsReceivedPattern.FindStringSubmatch(message.Message)
+	if match == nil {
+		return 0
+	}
+	count, err := strconv.Atoi(match[1])
+	Expect(err).ToNot(HaveOccurred())
+	return count
+}
+
+func describeHMSyslogForwarding(transport string) {
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+		startSyslogReceiver()
+
+		bratsutils.StartInnerBosh(
+			"-o", bratsutils.AssetPath("ops-hm-syslog-forwarder.yml"),
+			"-v", fmt.Sprintf("syslog-release-url=%s", bratsutils.ResolveArtifactURL("syslog@11")),
+			"-v", fmt.Sprintf("hm-receiver-host=%s", bratsutils.InnerBoshDirector().HostAddress()),
+			"-v", fmt.Sprintf("hm-syslog-port=%d", syslogReceiver.Port()),
+			"-v", fmt.Sprintf("hm-syslog-transport=%s", transport),
+		)
+
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		bratsutils.UploadRelease(bratsutils.ResolveArtifact("os-conf@12"))
+
+		session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("os-conf-manifest.yml"),
+			"-d", hmSyslogDeployment,
+			"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+		)
+		bratsutils.ExpectDeployExit(session, hmSyslogDeployment, 10*time.Minute, 0)
+	})
+
+	It("forwards alerts and heartbeat stats as structured RFC5424 records", func() {
+		// The logger plugin only subscribes to alerts, so heartbeats reach
+		// the health monitor's log through the stats it logs periodically.
+		alerts := healthMonitorLogLines("[ALERT] Alert @ ")
+		heartbeats := healthMonitorLogLines("Agent heartbeats received = ")
+
+		Eventually(alerts, 3*time.Minute, 5*time.Second).Should(ContainElement(
+			WithTransform(func(m bratsutils.SyslogMessage) string { return m.Message }, ContainSubstring(hmSyslogDeployment)),
+		))
+		Eventually(heartbeats, 3*time.Minute, 5*time.Second).Should(ContainElement(
+			WithTransform(heartbeatsReceived, BeNumerically(">", 0)),
+		))
+
+		for _, message := range append(alerts(), heartbeats()...) {
+			Expect(message.Format).To(Equal(bratsutils.SyslogRFC5424), "message '%s'", message.Message)
+			Expect(message.Timestamp).ToNot(BeZero())
+			Expect(message.Hostname).ToNot(BeEmpty())
+
+			Expect(message.StructuredData).To(HaveKey(syslogInstanceSDID))
+			instance := message.StructuredData[syslogInstanceSDID]
+			Expect(instance).To(HaveKeyWithValue("group", "bosh"))
+			Expect(instance["deployment"]).ToNot(BeEmpty())
+			Expect(instance["id"]).ToNot(BeEmpty())
+		}
+	})
+}
+
+var _ = Describe("Health Monitor syslog forwarding", func() {
+	It("refuses the removed syslog event forwarder", func() {
+		bratsutils.StartInnerBoshWithExpectation(true, "property hm.syslog_event_forwarder_enabled has been removed",
+			"-o", bratsutils.AssetPath("ops-hm-syslog-event-forwarder.yml"),
+		)
+	})
+
+	Context("with the syslog forwarder co-located over TCP", func() {
+		describeHMSyslogForwarding("tcp")
+	})
+
+	Context("with the syslog forwarder co-located over UDP", func() {
+		describeHMSyslogForwarding("udp")
+	})
+})
@@ -0,0 +1,289 @@
+package brats_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	linksProviderDeployment = "links-provider"
+	linksConsumerDeployment = "links-consumer"
+)
+
+// linkedProviderIPs returns the IPs of the shared provider's instances in
+// the given AZs.
+func linkedProviderIPs(azs ...string) []string {
+	instances, err := bratsutils.Director().Instances(linksProviderDeployment)
+	Expect(err).ToNot(HaveOccurred())
+
+	var ips []string
+	for _, instance := range instances {
+		if instance.Job == "provider" && containsAZ(azs, instance.AZ) {
+			ips = append(ips, instance.IPs...)
+		}
+	}
+	Expect(ips).ToNot(BeEmpty())
+	return ips
+}
+
+func containsAZ(azs []string, az string) bool {
+	for _, candidate := range azs {
+		if candidate == az {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveFromConsumer asks the consumer's bosh-dns for the address, like
+// the query-* jobs do, and returns the IPs it answers with.
+func resolveFromConsumer(address string) []string {
+	session := bratsutils.Bosh("-d", linksConsumerDeployment, "ssh", "test-agent/0", "-r", "--json",
+		"-c", fmt.Sprintf("dig +short %s", address))
+	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+
+	var output struct {
+		Tables []struct {
+			Rows []struct {
+				Stdout string `json:"stdout"`
+			}
+		}
+	}
+	Expect(json.Unmarshal(session.Out.Contents(), &output)).To(Succeed())
+	Expect(output.Tables).To(HaveLen(1))
+	Expect(output.Tables[0].Rows).To(HaveLen(1))
+
+	return strings.Fields(output.Tables[0].Rows[0].Stdout)
+}
+
+func linkProvider(deployment, name string) director.LinkProvider {
+	providers, err := bratsutils.Director().LinkProviders(deployment)
+	Expect(err).ToNot(HaveOccurred())
+
+	for _, provider := range providers {
+		if provider.Name == name {
+			return provider
+		}
+	}
+	Fail(fmt.Sprintf("deployment '%s' provides no link '%s'", deployment, name))
+	return director.LinkProvider{}
+}
+
+// consumerLinks returns the links of the deployment's consumers by the name
+// of the job or external consumer owning them.
+func consumerLinks(deployment string) map[string]director.Link {
+	consumers, err := bratsutils.Director().LinkConsumers(deployment)
+	Expect(err).ToNot(HaveOccurred())
+	links, err := bratsutils.Director().Links(deployment)
+	Expect(err).ToNot(HaveOccurred())
+
+	owners := map[string]string{}
+	for _, consumer := range consumers {
+		owners[consumer.ID] = consumer.Owner.Name
+	}
+
+	byOwner := map[string]director.Link{}
+	for _, link := range links {
+		Expect(owners).To(HaveKey(link.ConsumerID))
+		byOwner[owners[link.ConsumerID]] = link
+	}
+	return byOwner
+}
+
+func linkAddress(linkID string, filter director.LinkAddressFilter) string {
+	address, err := bratsutils.Director().LinkAddress(linkID, filter)
+	Expect(err).ToNot(HaveOccurred())
+	return address
+}
+
+func expectLinkError(err error, statusCode, code int) {
+	Expect(err).To(BeAssignableToTypeOf(director.Error{}))
+	directorErr := err.(director.Error)
+	Expect(directorErr.StatusCode).To(Equal(statusCode), directorErr.Description)
+	Expect(directorErr.Code).To(Equal(code), directorErr.Description)
+}
+
+var _ = Describe("Links API", func() {
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(
+			bratsutils.ConfigCandidateStemcellTarballPath,
+			bratsutils.ConfigDNSReleasePath,
+			bratsutils.ConfigBoshDNSAddonOpsFilePath,
+		)
+
+		bratsutils.StartInnerBosh()
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+
+		linkedTemplateReleasePath := filepath.Join(bratsutils.AssetPath("linked-templates-release"), "release.tgz")
+
+		session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("links-provider-manifest.yml"),
+			"-d", linksProviderDeployment,
+			"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+			"-v", fmt.Sprintf("linked-template-release-path=%s", linkedTemplateReleasePath),
+		)
+		bratsutils.ExpectDeployExit(session, linksProviderDeployment, 10*time.Minute, 0)
+
+		session = bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("links-consumer-manifest.yml"),
+			"-d", linksConsumerDeployment,
+			"-o", boshDNSAddonOpsFilePath,
+			"-v", fmt.Sprintf("dns-release-path=%s", dnsReleasePath),
+			"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+			"-v", fmt.Sprintf("linked-template-release-path=%s", linkedTemplateReleasePath),
+			"--vars-store", filepath.Join(bratsutils.TempDir("links"), "creds.yml"),
+		)
+		bratsutils.ExpectDeployExit(session, linksConsumerDeployment, 20*time.Minute, 0)
+	})
+
+	It("lists both ends of the links another deployment consumes from a shared provider", func() {
+		shared := linkProvider(linksProviderDeployment, "some-service")
+		Expect(shared.Shared).To(BeTrue())
+		Expect(shared.Deployment).To(Equal(linksProviderDeployment))
+		Expect(shared.Definition).To(Equal(director.LinkDefinition{Name: "some-service", Type: "whatever"}))
+		Expect(shared.Owner).To(Equal(director.LinkOwner{
+			Type: "job", Name: "link-provider", Info: director.LinkOwnerInfo{InstanceGroup: "provider"},
+		}))
+
+		private := linkProvider(linksProviderDeployment, "private-service")
+		Expect(private.Shared).To(BeFalse())
+		Expect(private.Definition.Name).To(Equal("some-service"))
+		Expect(private.Owner.Info.InstanceGroup).To(Equal("private-provider"))
+
+		consumers, err := bratsutils.Director().LinkConsumers(linksConsumerDeployment)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(consumers).To(HaveLen(3))
+		for _, consumer := range consumers {
+			Expect(consumer.Name).To(Equal("some-service"))
+			Expect(consumer.Deployment).To(Equal(linksConsumerDeployment))
+			Expect(consumer.Definition).To(Equal(director.LinkDefinition{Name: "some-service", Type: "whatever"}))
+			Expect(consumer.Owner.Type).To(Equal("job"))
+			Expect(consumer.Owner.Info.InstanceGroup).To(Equal("test-agent"))
+		}
+
+		links := consumerLinks(linksConsumerDeployment)
+		Expect(links).To(HaveLen(3))
+		Expect(links).To(HaveKey("query-all"))
+		Expect(links).To(HaveKey("query-with-az-filter"))
+		Expect(links).To(HaveKey("query-individual-instance"))
+		for _, link := range links {
+			Expect(link.Name).To(Equal("some-service"))
+			Expect(link.ProviderID).To(Equal(shared.ID))
+		}
+
+		By("keeping the links in the consuming deployment")
+		Expect(consumerLinks(linksProviderDeployment)).To(BeEmpty())
+	})
+
+	It("returns the addresses the query errands resolve", func() {
+		links := consumerLinks(linksConsumerDeployment)
+
+		By("matching query-all to the unfiltered address")
+		address := linkAddress(links["query-all"].ID, director.LinkAddressFilter{})
+
+		session := bratsutils.Bosh("-d", linksConsumerDeployment, "run-errand", "query-all")
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("ANSWER: 3"))
+		output := string(session.Out.Contents())
+		Expect(output).To(ContainSubstring(address + "."))
+		for _, ip := range linkedProviderIPs("z1", "z2") {
+			Expect(output).To(ContainSubstring(ip))
+		}
+
+		By("matching query-with-az-filter to the address filtered by the consumer's AZ")
+		z1Address := linkAddress(links["query-with-az-filter"].ID, director.LinkAddressFilter{AZs: []string{"z1"}})
+		Expect(z1Address).ToNot(Equal(address))
+
+		session = bratsutils.Bosh("-d", linksConsumerDeployment, "run-errand", "query-with-az-filter")
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("ANSWER: 2"))
+		output = string(session.Out.Contents())
+		Expect(output).To(ContainSubstring(z1Address + "."))
+		for _, ip := range linkedProviderIPs("z1") {
+			Expect(output).To(ContainSubstring(ip))
+		}
+
+		By("resolving the addresses of other AZs and health filters alike")
+		z2Address := linkAddress(links["query-all"].ID, director.LinkAddressFilter{AZs: []string{"z2"}})
+		Expect(resolveFromConsumer(z2Address)).To(ConsistOf(linkedProviderIPs("z2")))
+
+		bothAZs := linkAddress(links["query-all"].ID, director.LinkAddressFilter{AZs: []string{"z1", "z2"}})
+		Expect(resolveFromConsumer(bothAZs)).To(ConsistOf(linkedProviderIPs("z1", "z2")))
+
+		healthy := linkAddress(links["query-all"].ID, director.LinkAddressFilter{Status: director.LinkAddressStatusHealthy})
+		all := linkAddress(links["query-all"].ID, director.LinkAddressFilter{Status: director.LinkAddressStatusAll})
+		Expect([]string{healthy, all}).ToNot(ContainElement(address))
+		Expect(healthy).ToNot(Equal(all))
+		Expect(resolveFromConsumer(healthy)).To(ConsistOf(linkedProviderIPs("z1", "z2")))
+		Expect(resolveFromConsumer(all)).To(ConsistOf(linkedProviderIPs("z1", "z2")))
+
+		By("rejecting filters the director can't encode")
+		_, err := bratsutils.Director().LinkAddress(links["query-all"].ID, director.LinkAddressFilter{Status: "sick"})
+		expectLinkError(err, http.StatusBadRequest, 810007)
+
+		_, err = bratsutils.Director().LinkAddress(links["query-all"].ID, director.LinkAddressFilter{AZs: []string{"z9"}})
+		expectLinkError(err, http.StatusBadRequest, 810008)
+	})
+
+	It("creates external links to shared providers only and deletes them", func() {
+		shared := linkProvider(linksProviderDeployment, "some-service")
+		consumingLinks := consumerLinks(linksConsumerDeployment)
+
+		link, err := bratsutils.Director().CreateLink(director.NewLink{
+			ProviderID: shared.ID, Consumer: "brats-external", Network: "default",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(link.Name).To(Equal("some-service"))
+		Expect(link.ProviderID).To(Equal(shared.ID))
+
+		By("adding an external consumer to the provider's deployment")
+		externalLinks := consumerLinks(linksProviderDeployment)
+		Expect(externalLinks).To(Equal(map[string]director.Link{"brats-external": link}))
+
+		consumers, err := bratsutils.Director().LinkConsumers(linksProviderDeployment)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(consumers).To(HaveLen(1))
+		Expect(consumers[0].Owner).To(Equal(director.LinkOwner{Type: "external", Name: "brats-external"}))
+
+		By("addressing the same instances as the deployed consumers")
+		Expect(resolveFromConsumer(linkAddress(link.ID, director.LinkAddressFilter{}))).To(ConsistOf(linkedProviderIPs("z1", "z2")))
+		Expect(resolveFromConsumer(linkAddress(link.ID, director.LinkAddressFilter{AZs: []string{"z2"}}))).To(ConsistOf(linkedProviderIPs("z2")))
+
+		By("refusing links to providers that aren't shared or networks they aren't on")
+		_, err = bratsutils.Director().CreateLink(director.NewLink{
+			ProviderID: linkProvider(linksProviderDeployment, "private-service").ID, Consumer: "brats-external",
+		})
+		expectLinkError(err, http.StatusForbidden, 810009)
+
+		_, err = bratsutils.Director().CreateLink(director.NewLink{
+			ProviderID: shared.ID, Consumer: "brats-external", Network: "missing",
+		})
+		expectLinkError(err, http.StatusBadRequest, 810003)
+
+		By("refusing to delete the links of jobs")
+		expectLinkError(bratsutils.Director().DeleteLink(consumingLinks["query-all"].ID), http.StatusBadRequest, 810005)
+
+		By("deleting the external link and its consumer")
+		Expect(bratsutils.Director().DeleteLink(link.ID)).To(Succeed())
+
+		Expect(consumerLinks(linksProviderDeployment)).To(BeEmpty())
+		consumers, err = bratsutils.Director().LinkConsumers(linksProviderDeployment)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(consumers).To(BeEmpty())
+
+		_, err = bratsutils.Director().LinkAddress(link.ID, director.LinkAddressFilter{})
+		expectLinkError(err, http.StatusNotFound, 810000)
+		expectLinkError(bratsutils.Director().DeleteLink(link.ID), http.StatusNotFound, 810000)
+
+		Expect(consumerLinks(linksConsumerDeployment)).To(Equal(consumingLinks))
+	})
+})
@@ -7,7 +7,6 @@ import (
 
 	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
 	. "github.com/onsi/ginkgo"
-	"github.com/onsi/ginkgo/config"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
 )
@@ -16,7 +15,7 @@ var _ = Describe("logging", func() {
 	var cpiConfigName string
 
 	BeforeEach(func() {
-		cpiConfigName = fmt.Sprintf("%s-logging-test-fake-cpi-config-%d", time.Now().Format("2006-01-02"), config.GinkgoConfig.ParallelNode)
+		cpiConfigName = bratsutils.LeaseResources().Name(fmt.Sprintf("%s-logging-test-fake-cpi-config", time.Now().Format("2006-01-02")))
 		bratsutils.StartInnerBosh()
 	})
 
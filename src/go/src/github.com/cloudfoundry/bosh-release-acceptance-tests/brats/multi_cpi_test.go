@@ -0,0 +1,222 @@
+package brats_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/manifest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	multiCPIConfig     = "brats-multi-cpi"
+	multiCPIDeployment = "multi-cpi"
+
+	cpiA = "brats-cpi-a"
+	cpiB = "brats-cpi-b"
+	cpiC = "brats-cpi-c"
+)
+
+// multiCPIEntry is a CPI config entry for the director's own CPI. Its only
+// property is named after the entry: the director passes CPI properties to
+// every call in the request context and redacts only their values, so the
+// key tells which entry a logged request went through.
+func multiCPIEntry(name string, migratedFrom ...string) map[string]interface{} {
+	cpi := bratsutils.InnerBoshDirector().CPI()
+	entry := map[string]interface{}{
+		"name":       name,
+		"type":       cpi.Type,
+		"exec_path":  cpi.ExecPath,
+		"properties": map[string]interface{}{name: true},
+	}
+
+	var from []map[string]string
+	for _, m := range migratedFrom {
+		from = append(from, map[string]string{"name": m})
+	}
+	if len(from) > 0 {
+		entry["migrated_from"] = from
+	}
+	return entry
+}
+
+func updateCPIConfig(entries ...map[string]interface{}) {
+	content, err := yaml.Marshal(map[string]interface{}{"cpis": entries})
+	Expect(err).ToNot(HaveOccurred())
+
+	_, err = bratsutils.Director().UpdateConfig("cpi", multiCPIConfig, string(content))
+	Expect(err).ToNot(HaveOccurred())
+}
+
+// assignAZCPIs updates the default cloud config to route each AZ to a CPI.
+// Once a CPI config exists the director needs a CPI for every AZ, not just
+// the ones deployed to. Resetting the director restores the original.
+func assignAZCPIs(original string, cpis map[string]string) {
+	var cloudConfig map[string]interface{}
+	Expect(yaml.Unmarshal([]byte(original), &cloudConfig)).To(Succeed())
+
+	azs, ok := cloudConfig["azs"].([]interface{})
+	Expect(ok).To(BeTrue(), "the cloud config has no azs")
+	for _, az := range azs {
+		az := az.(map[interface{}]interface{})
+		cpi, ok := cpis[az["name"].(string)]
+		Expect(ok).To(BeTrue(), "no CPI for AZ '%s'", az["name"])
+		az["cpi"] = cpi
+	}
+
+	content, err := yaml.Marshal(cloudConfig)
+	Expect(err).ToNot(HaveOccurred())
+	_, err = bratsutils.Director().UpdateConfig("cloud", "default", string(content))
+	Expect(err).ToNot(HaveOccurred())
+}
+
+func deployAcrossAZs(releaseVersion, stemcellVersion string, opts director.DeployOptions) int {
+	contents, err := manifest.New(multiCPIDeployment).
+		WithRelease(manifest.Release{Name: addonsRelease, Version: releaseVersion}).
+		WithStemcell(manifest.Stemcell{Alias: manifest.Default, OS: bratsutils.StemcellOS(), Version: stemcellVersion}).
+		WithInstanceGroup(manifest.NewInstanceGroup("web").
+			WithInstances(2).
+			InAZs("z1", "z2").
+			WithJob(manifest.NewJob("workload-web", addonsRelease))).
+		YAML()
+	Expect(err).ToNot(HaveOccurred())
+
+	taskID, err := bratsutils.Director().Deploy(contents, opts)
+	Expect(err).ToNot(HaveOccurred())
+	result := bratsutils.TrackTask(taskID, 10*time.Minute)
+	Expect(result.Succeeded()).To(BeTrue(), result.String())
+	return taskID
+}
+
+var cpiRequestPattern = regexp.MustCompile(`request: (\{.*\}) with command: `)
+
+// createdVMCPIs reads the create_vm calls of a task from its debug log and
+// returns the CPI entry each agent's VM was created through, by agent id.
+func createdVMCPIs(taskID int, cpis ...string) map[string]string {
+	debugLog, err := bratsutils.Director().TaskOutput(taskID, director.TaskOutputDebug)
+	Expect(err).ToNot(HaveOccurred())
+
+	created := map[string]string{}
+	for _, match := range cpiRequestPattern.FindAllStringSubmatch(debugLog, -1) {
+		var request struct {
+			Method    string                 `json:"method"`
+			Arguments []interface{}          `json:"arguments"`
+			Context   map[string]interface{} `json:"context"`
+		}
+		Expect(json.Unmarshal([]byte(match[1]), &request)).To(Succeed(), match[1])
+		if request.Method != "create_vm" {
+			continue
+		}
+
+		agentID := request.Arguments[0].(string)
+		for _, cpi := range cpis {
+			if _, ok := request.Context[cpi]; ok {
+				created[agentID] = cpi
+			}
+		}
+		Expect(created).To(HaveKey(agentID), "create_vm request went through none of %v: %s", cpis, match[1])
+	}
+	return created
+}
+
+func multiCPIVMs() []director.VM {
+	vms, err := bratsutils.Director().VMs(multiCPIDeployment)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(vms).To(HaveLen(2))
+	return vms
+}
+
+// expectVMsCreatedBy checks the task created every VM of the deployment
+// through the CPI its AZ routes to.
+func expectVMsCreatedBy(taskID int, azCPIs map[string]string) {
+	var cpis []string
+	for _, cpi := range azCPIs {
+		cpis = append(cpis, cpi)
+	}
+	created := createdVMCPIs(taskID, cpis...)
+
+	for _, vm := range multiCPIVMs() {
+		Expect(created).To(HaveKeyWithValue(vm.AgentID, azCPIs[vm.AZ]), "VM %s in %s", vm.CID, vm.AZ)
+	}
+}
+
+var _ = Describe("Multiple CPIs", func() {
+	var (
+		originalCloudConfig             string
+		releaseVersion, stemcellVersion string
+	)
+
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+		bratsutils.StartInnerBosh()
+
+		configs, err := bratsutils.Director().Configs(director.ConfigsFilter{Type: "cloud", Name: "default"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(configs).To(HaveLen(1))
+		originalCloudConfig = configs[0].Content
+
+		updateCPIConfig(multiCPIEntry(cpiA), multiCPIEntry(cpiB))
+		assignAZCPIs(originalCloudConfig, map[string]string{"z1": cpiA, "z2": cpiB, "z3": cpiA})
+
+		// With a CPI config the director uploads the stemcell through each
+		// of its CPIs.
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		releaseVersion = createAddonsRelease()
+		stemcellVersion = uploadedStemcellVersion()
+	})
+
+	It("uploads the stemcell once per CPI", func() {
+		stemcells, err := bratsutils.Director().Stemcells()
+		Expect(err).ToNot(HaveOccurred())
+
+		var cpis []string
+		for _, stemcell := range stemcells {
+			cpis = append(cpis, stemcell.CPI)
+		}
+		Expect(cpis).To(ConsistOf(cpiA, cpiB))
+	})
+
+	It("creates the VMs of each AZ through the CPI the AZ routes to", func() {
+		taskID := deployAcrossAZs(releaseVersion, stemcellVersion, director.DeployOptions{})
+		expectVMsCreatedBy(taskID, map[string]string{"z1": cpiA, "z2": cpiB})
+
+		debugLog, err := bratsutils.Director().TaskOutput(taskID, director.TaskOutputDebug)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(debugLog).To(ContainSubstring("for CPI " + cpiA))
+		Expect(debugLog).To(ContainSubstring("for CPI " + cpiB))
+	})
+
+	It("moves the VMs of an AZ to a CPI migrated from its previous one", func() {
+		deployAcrossAZs(releaseVersion, stemcellVersion, director.DeployOptions{})
+		before := multiCPIVMs()
+
+		updateCPIConfig(multiCPIEntry(cpiA), multiCPIEntry(cpiC, cpiB))
+		assignAZCPIs(originalCloudConfig, map[string]string{"z1": cpiA, "z2": cpiC, "z3": cpiA})
+
+		// Existing VMs keep running and only change hands; the stemcell
+		// uploaded through the old CPI still serves the new one.
+		taskID := deployAcrossAZs(releaseVersion, stemcellVersion, director.DeployOptions{})
+		Expect(multiCPIVMs()).To(ConsistOf(before))
+		Expect(createdVMCPIs(taskID, cpiA, cpiC)).To(BeEmpty())
+
+		debugLog, err := bratsutils.Director().TaskOutput(taskID, director.TaskOutputDebug)
+		Expect(err).ToNot(HaveOccurred())
+		for _, vm := range before {
+			change := fmt.Sprintf("Changing CPI name for instance %s/%s (%d)", vm.Job, vm.ID, vm.Index)
+			if vm.AZ == "z2" {
+				Expect(debugLog).To(ContainSubstring(fmt.Sprintf("%s from %s to %s", change, cpiB, cpiC)))
+			} else {
+				Expect(debugLog).ToNot(ContainSubstring(change), "VM %s in %s", vm.CID, vm.AZ)
+			}
+		}
+
+		taskID = deployAcrossAZs(releaseVersion, stemcellVersion, director.DeployOptions{Recreate: true})
+		expectVMsCreatedBy(taskID, map[string]string{"z1": cpiA, "z2": cpiC})
+	})
+})
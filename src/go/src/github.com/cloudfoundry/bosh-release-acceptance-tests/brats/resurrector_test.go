@@ -0,0 +1,181 @@
+package brats_test
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	resurrectorDeployment = "resurrector-deployment"
+	resurrectorInstances  = 4
+
+	// An agent times out after a minute and the health monitor looks for
+	// timed out agents every minute, so alerts take up to two.
+	resurrectorAlertTimeout = 5 * time.Minute
+)
+
+func deployForResurrection(minimumDownJobs int, percentThreshold float64) {
+	bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+	bratsutils.StartInnerBosh(
+		"-o", bratsutils.AssetPath("ops-hm-resurrector.yml"),
+		"-v", fmt.Sprintf("hm-resurrector-minimum-down-jobs=%d", minimumDownJobs),
+		"-v", fmt.Sprintf("hm-resurrector-percent-threshold=%g", percentThreshold),
+		"-v", "hm-resurrector-time-threshold=600",
+	)
+
+	bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+	bratsutils.UploadRelease(bratsutils.ResolveArtifact("os-conf@12"))
+
+	session := bratsutils.Bosh("-n", "deploy", bratsutils.AssetPath("resurrector-manifest.yml"),
+		"-d", resurrectorDeployment,
+		"-v", fmt.Sprintf("deployment-name=%s", resurrectorDeployment),
+		"-v", fmt.Sprintf("instances=%d", resurrectorInstances),
+		"-v", fmt.Sprintf("stemcell-os=%s", bratsutils.StemcellOS()),
+	)
+	bratsutils.ExpectDeployExit(session, resurrectorDeployment, 10*time.Minute, 0)
+}
+
+// instanceVMs maps the ID of every instance of the deployment to the CID of
+// its VM.
+func instanceVMs() map[string]string {
+	instances, err := bratsutils.Director().Instances(resurrectorDeployment)
+	Expect(err).ToNot(HaveOccurred())
+
+	vms := map[string]string{}
+	for _, instance := range instances {
+		vms[instance.ID] = instance.CID
+	}
+	return vms
+}
+
+// scanAndFixTasks needs all tasks, the director hides scan-and-fix ones by
+// default.
+func scanAndFixTasks() []director.Task {
+	tasks, err := bratsutils.Director().Tasks(director.TasksFilter{Deployment: resurrectorDeployment, Limit: 100, All: true})
+	Expect(err).ToNot(HaveOccurred())
+
+	var scanAndFix []director.Task
+	for _, task := range tasks {
+		if task.Description == "scan and fix" {
+			scanAndFix = append(scanAndFix, task)
+		}
+	}
+	return scanAndFix
+}
+
+// stopAgents stops the agents of count instances and returns their IDs.
+func stopAgents(vms map[string]string, count int) []string {
+	var stopped []string
+	for id := range vms {
+		if len(stopped) == count {
+			break
+		}
+		bratsutils.StopAgent(resurrectorDeployment, "test-brats/"+id)
+		stopped = append(stopped, id)
+	}
+	return stopped
+}
+
+// resurrectorAlertTitles returns the titles of the alerts about the
+// deployment, from the events the health monitor's event logger records for
+// them: "<title>. <alert>".
+func resurrectorAlertTitles() []string {
+	events, err := bratsutils.Director().Events(director.EventsFilter{Deployment: resurrectorDeployment, ObjectType: "alert"})
+	Expect(err).ToNot(HaveOccurred())
+
+	var titles []string
+	for _, event := range events {
+		if message, ok := event.Context["message"].(string); ok {
+			titles = append(titles, strings.SplitN(message, ". Alert @ ", 2)[0])
+		}
+	}
+	return titles
+}
+
+// resurrectorAlert matches the summary the resurrector gives an alert about
+// an instance, as the health monitor's logger plugin writes it.
+func resurrectorAlert(summary, instanceID string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`\[ALERT\] Alert @ .*: %s: 'test-brats/%s'; deployment: '%s'`,
+		regexp.QuoteMeta(summary), instanceID, resurrectorDeployment))
+}
+
+var _ = Describe("Resurrector", func() {
+	Context("below the meltdown thresholds", func() {
+		BeforeEach(func() {
+			deployForResurrection(2, 0.5)
+		})
+
+		It("queues a scan-and-fix task that recreates the unresponsive VM", func() {
+			vms := instanceVMs()
+			stopped := stopAgents(vms, 1)[0]
+
+			Eventually(func() []string {
+				var states []string
+				for _, task := range scanAndFixTasks() {
+					states = append(states, task.State)
+				}
+				return states
+			}, resurrectorAlertTimeout+5*time.Minute, 10*time.Second).Should(ContainElement("done"))
+
+			Eventually(func() string { return instanceVMs()[stopped] }, 5*time.Minute, 10*time.Second).ShouldNot(Equal(vms[stopped]))
+			for id, cid := range instanceVMs() {
+				if id != stopped {
+					Expect(cid).To(Equal(vms[id]), "instance %s was recreated", id)
+				}
+			}
+
+			Expect(bratsutils.HealthMonitorLog()).To(MatchRegexp(resurrectorAlert("Notifying Director to recreate instance", stopped).String()))
+		})
+	})
+
+	Context("above the meltdown thresholds", func() {
+		BeforeEach(func() {
+			// One unhealthy instance out of four is already a meltdown.
+			deployForResurrection(1, 0.25)
+		})
+
+		It("suppresses resurrection and alerts about the meltdown", func() {
+			vms := instanceVMs()
+			stopped := stopAgents(vms, 2)
+
+			for _, id := range stopped {
+				Eventually(bratsutils.HealthMonitorLog, resurrectorAlertTimeout, 30*time.Second).Should(
+					MatchRegexp(resurrectorAlert("Skipping resurrection for instance", id).String()))
+			}
+
+			Eventually(resurrectorAlertTitles, time.Minute, 10*time.Second).Should(ContainElement("We are in meltdown"))
+			Expect(scanAndFixTasks()).To(BeEmpty())
+			Expect(instanceVMs()).To(Equal(vms))
+		})
+	})
+
+	Context("with resurrection turned off", func() {
+		BeforeEach(func() {
+			deployForResurrection(2, 0.5)
+
+			session := bratsutils.Bosh("-n", "update-resurrection", "off")
+			Eventually(session, time.Minute).Should(gexec.Exit(0))
+		})
+
+		It("doesn't queue scan-and-fix tasks for the health monitor", func() {
+			vms := instanceVMs()
+			stopped := stopAgents(vms, 1)[0]
+
+			// The health monitor still asks, the director ignores it.
+			Eventually(bratsutils.HealthMonitorLog, resurrectorAlertTimeout, 30*time.Second).Should(
+				MatchRegexp(resurrectorAlert("Notifying Director to recreate instance", stopped).String()))
+
+			Consistently(scanAndFixTasks, time.Minute, 10*time.Second).Should(BeEmpty())
+			Expect(instanceVMs()).To(Equal(vms))
+		})
+	})
+})
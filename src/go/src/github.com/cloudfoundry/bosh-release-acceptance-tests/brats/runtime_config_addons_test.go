@@ -0,0 +1,371 @@
+package brats_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/manifest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	addonsRelease = "brats-addons"
+
+	// addonsNetwork is a second name for the default network, for the
+	// network rules to tell instance groups apart by.
+	addonsNetwork = "addons-secondary"
+
+	addonsCloudConfig = "brats-addons"
+	addonsOtherOS     = "brats-unknown-os"
+)
+
+// addonPlacementGroup is an instance group with a single instance running
+// one of the release's workload jobs.
+type addonPlacementGroup struct {
+	Name    string
+	AZ      string
+	Network string
+	Job     string
+}
+
+type addonPlacementDeployment struct {
+	Name   string
+	Groups []addonPlacementGroup
+
+	// Team deploys it as the team's admin, which gives it the team.
+	// Admins deploy the others.
+	Team string
+}
+
+// addonPlacementConfig is a runtime config of its own name with a single
+// addon, which places the job addon-<name> of the release.
+type addonPlacementConfig struct {
+	Name    string
+	Include manifest.Properties
+	Exclude manifest.Properties
+
+	// PlacedOn lists the instance groups the addon lands on, as
+	// deployment/instance-group.
+	PlacedOn []string
+}
+
+func (c addonPlacementConfig) Job() string {
+	return "addon-" + c.Name
+}
+
+// createAddonsRelease uploads a dev release of assets/addons-release and
+// returns its version, which runtime configs have to name.
+func createAddonsRelease() string {
+	tarball := filepath.Join(bratsutils.TempDir("addons"), "brats-addons.tgz")
+	session := bratsutils.Bosh("create-release", "--dir", bratsutils.AssetPath("addons-release"),
+		"--tarball", tarball, "--force")
+	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+	bratsutils.UploadRelease(tarball)
+
+	releases, err := bratsutils.Director().Releases()
+	Expect(err).ToNot(HaveOccurred())
+	for _, release := range releases {
+		if release.Name == addonsRelease {
+			Expect(release.Versions).To(HaveLen(1))
+			return release.Versions[0].Version
+		}
+	}
+	Fail("release '" + addonsRelease + "' was not uploaded")
+	return ""
+}
+
+func uploadedStemcellVersion() string {
+	stemcells, err := bratsutils.Director().Stemcells()
+	Expect(err).ToNot(HaveOccurred())
+	for _, stemcell := range stemcells {
+		if stemcell.OperatingSystem == bratsutils.StemcellOS() {
+			return stemcell.Version
+		}
+	}
+	Fail("no " + bratsutils.StemcellOS() + " stemcell was uploaded")
+	return ""
+}
+
+// addAddonsNetwork adds a named cloud config with a copy of the default
+// network under another name. The director hands out IPs across networks,
+// so instances on either don't clash.
+func addAddonsNetwork() {
+	configs, err := bratsutils.Director().Configs(director.ConfigsFilter{Type: "cloud", Name: "default"})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(configs).To(HaveLen(1))
+
+	var cloudConfig struct {
+		Networks []map[string]interface{} `yaml:"networks"`
+	}
+	Expect(yaml.Unmarshal([]byte(configs[0].Content), &cloudConfig)).To(Succeed())
+
+	for _, network := range cloudConfig.Networks {
+		if network["name"] == manifest.Default {
+			network["name"] = addonsNetwork
+			content, err := yaml.Marshal(map[string]interface{}{"networks": []interface{}{network}})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = bratsutils.Director().UpdateConfig("cloud", addonsCloudConfig, string(content))
+			Expect(err).ToNot(HaveOccurred())
+			return
+		}
+	}
+	Fail("the cloud config has no default network")
+}
+
+// applyRuntimeConfigs adds every runtime config the way operators do.
+func applyRuntimeConfigs(configs []addonPlacementConfig, releaseVersion string) {
+	dir := bratsutils.TempDir("runtime-configs")
+
+	for _, config := range configs {
+		path := filepath.Join(dir, config.Name+".yml")
+		Expect(manifest.NewRuntimeConfig().
+			WithRelease(manifest.Release{Name: addonsRelease, Version: releaseVersion}).
+			WithAddon(manifest.Addon{
+				Name:    config.Name,
+				Jobs:    []*manifest.Job{manifest.NewJob(config.Job(), addonsRelease)},
+				Include: config.Include,
+				Exclude: config.Exclude,
+			}).
+			Write(path)).To(Succeed())
+
+		session := bratsutils.Bosh("-n", "update-config", "--type", "runtime", "--name", config.Name, path)
+		Eventually(session, time.Minute).Should(gexec.Exit(0))
+	}
+
+	runtimeConfigs, err := bratsutils.Director().Configs(director.ConfigsFilter{Type: "runtime"})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(runtimeConfigs).To(HaveLen(len(configs)))
+}
+
+// startInnerBoshWithTeams starts a director that gets its users from the
+// fake UAA, since only UAA users belong to teams. It shares the key of the
+// UAA suite, so that either suite reuses the director of the other.
+func startInnerBoshWithTeams() {
+	if uaaRSASigningKey.ID == "" {
+		var err error
+		uaaRSASigningKey, err = bratsutils.NewUAASigningKey("brats-rsa")
+		Expect(err).ToNot(HaveOccurred())
+
+		uaaPublicKeyPath = filepath.Join(bratsutils.TempDir("uaa"), "public-key.pem")
+		Expect(ioutil.WriteFile(uaaPublicKeyPath, []byte(uaaRSASigningKey.PublicKeyPEM()), 0644)).To(Succeed())
+	}
+	startFakeUAA(uaaRSASigningKey)
+
+	bratsutils.StartInnerBosh(
+		"-o", bratsutils.AssetPath("ops-uaa-user-management.yml"),
+		"-v", fmt.Sprintf("uaa-url=%s", fakeUAA.URL()),
+		fmt.Sprintf("--var-file=uaa-public-key=%s", uaaPublicKeyPath),
+	)
+}
+
+// deployAddonPlacements deploys with exact versions, since the director
+// only resolves `latest` for the CLI.
+func deployAddonPlacements(deployments []addonPlacementDeployment, releaseVersion, stemcellVersion string) {
+	for _, deployment := range deployments {
+		m := manifest.New(deployment.Name).
+			WithRelease(manifest.Release{Name: addonsRelease, Version: releaseVersion}).
+			WithStemcell(manifest.Stemcell{Alias: manifest.Default, OS: bratsutils.StemcellOS(), Version: stemcellVersion})
+		for _, group := range deployment.Groups {
+			m.WithInstanceGroup(manifest.NewInstanceGroup(group.Name).
+				InAZs(group.AZ).
+				OnNetworks(manifest.Network{Name: group.Network}).
+				WithJob(manifest.NewJob(group.Job, addonsRelease)))
+		}
+		contents, err := m.YAML()
+		Expect(err).ToNot(HaveOccurred())
+
+		client := bratsutils.Director()
+		if deployment.Team != "" {
+			client = uaaDirectorClient("brats-addons-"+deployment.Team, "bosh.teams."+deployment.Team+".admin")
+		}
+
+		taskID, err := client.Deploy(contents, director.DeployOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		result := bratsutils.TrackTask(taskID, 10*time.Minute)
+		Expect(result.Succeeded()).To(BeTrue(), result.String())
+	}
+}
+
+var deployedJobPattern = regexp.MustCompile(`^([^/\s]+)/[0-9a-f-]+: stdout \| (\S+)\s*$`)
+
+// deployedJobs lists /var/vcap/jobs on every instance of the deployment, by
+// instance group.
+func deployedJobs(deployment string) map[string][]string {
+	session := bratsutils.Bosh("-d", deployment, "ssh", "-c", "ls -1 /var/vcap/jobs")
+	Eventually(session, 2*time.Minute).Should(gexec.Exit(0))
+
+	jobs := map[string][]string{}
+	for _, line := range strings.Split(string(session.Out.Contents()), "\n") {
+		if match := deployedJobPattern.FindStringSubmatch(line); match != nil {
+			jobs[match[1]] = append(jobs[match[1]], match[2])
+		}
+	}
+	for _, groupJobs := range jobs {
+		sort.Strings(groupJobs)
+	}
+	return jobs
+}
+
+// expectAddonPlacements checks each instance runs its workload job and the
+// jobs of exactly the addons placed on its instance group.
+func expectAddonPlacements(deployments []addonPlacementDeployment, configs []addonPlacementConfig) {
+	for _, deployment := range deployments {
+		expected := map[string][]string{}
+		for _, group := range deployment.Groups {
+			jobs := []string{group.Job}
+			for _, config := range configs {
+				for _, placement := range config.PlacedOn {
+					if placement == deployment.Name+"/"+group.Name {
+						jobs = append(jobs, config.Job())
+					}
+				}
+			}
+			sort.Strings(jobs)
+			expected[group.Name] = jobs
+		}
+
+		Expect(deployedJobs(deployment.Name)).To(Equal(expected), "jobs of deployment '%s'", deployment.Name)
+	}
+}
+
+var _ = Describe("Runtime config addon placement", func() {
+	var releaseVersion, stemcellVersion string
+
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+	})
+
+	uploadAddonsArtifacts := func() {
+		bratsutils.UploadStemcell(candidateWardenLinuxStemcellPath)
+		releaseVersion = createAddonsRelease()
+		stemcellVersion = uploadedStemcellVersion()
+	}
+
+	Context("with include and exclude rules on deployments, jobs, instance groups, networks, stemcells and AZs", func() {
+		deployments := []addonPlacementDeployment{
+			{Name: "addons-alpha", Groups: []addonPlacementGroup{
+				{Name: "web", AZ: "z1", Network: manifest.Default, Job: "workload-web"},
+				{Name: "worker", AZ: "z2", Network: addonsNetwork, Job: "workload-worker"},
+			}},
+			{Name: "addons-beta", Groups: []addonPlacementGroup{
+				{Name: "web", AZ: "z1", Network: manifest.Default, Job: "workload-web"},
+				{Name: "db", AZ: "z3", Network: addonsNetwork, Job: "workload-worker"},
+			}},
+		}
+
+		// Built once the stemcell's OS is known.
+		configs := func() []addonPlacementConfig {
+			os := bratsutils.StemcellOS()
+			return []addonPlacementConfig{
+				{
+					Name:     "everywhere",
+					PlacedOn: []string{"addons-alpha/web", "addons-alpha/worker", "addons-beta/web", "addons-beta/db"},
+				},
+				{
+					Name:     "by-deployment",
+					Include:  manifest.Properties{"deployments": []string{"addons-alpha"}},
+					PlacedOn: []string{"addons-alpha/web", "addons-alpha/worker"},
+				},
+				{
+					Name:     "by-job",
+					Include:  manifest.Properties{"jobs": []manifest.Properties{manifest.JobFilter("workload-worker", addonsRelease)}},
+					PlacedOn: []string{"addons-alpha/worker", "addons-beta/db"},
+				},
+				{
+					Name:     "by-instance-group",
+					Include:  manifest.Properties{"instance_groups": []string{"web"}},
+					Exclude:  manifest.Properties{"deployments": []string{"addons-beta"}},
+					PlacedOn: []string{"addons-alpha/web"},
+				},
+				{
+					Name:     "by-network",
+					Include:  manifest.Properties{"networks": []string{addonsNetwork}},
+					Exclude:  manifest.Properties{"instance_groups": []string{"db"}},
+					PlacedOn: []string{"addons-alpha/worker"},
+				},
+				{
+					Name:     "by-stemcell",
+					Include:  manifest.Properties{"stemcell": []manifest.Properties{manifest.StemcellFilter(os)}},
+					Exclude:  manifest.Properties{"networks": []string{addonsNetwork}},
+					PlacedOn: []string{"addons-alpha/web", "addons-beta/web"},
+				},
+				{
+					Name:    "other-stemcell",
+					Include: manifest.Properties{"stemcell": []manifest.Properties{manifest.StemcellFilter(addonsOtherOS)}},
+				},
+				{
+					Name:     "by-az",
+					Include:  manifest.Properties{"azs": []string{"z2", "z3"}},
+					Exclude:  manifest.Properties{"deployments": []string{"addons-alpha"}},
+					PlacedOn: []string{"addons-beta/db"},
+				},
+				{
+					Name:    "excluded-stemcell",
+					Exclude: manifest.Properties{"stemcell": []manifest.Properties{manifest.StemcellFilter(os)}},
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			bratsutils.StartInnerBosh()
+			uploadAddonsArtifacts()
+			addAddonsNetwork()
+		})
+
+		It("places each addon on exactly the instance groups its rules match", func() {
+			applyRuntimeConfigs(configs(), releaseVersion)
+			deployAddonPlacements(deployments, releaseVersion, stemcellVersion)
+			expectAddonPlacements(deployments, configs())
+		})
+	})
+
+	Context("with include and exclude rules on teams", func() {
+		deployments := []addonPlacementDeployment{
+			{Name: "addons-team-a", Team: uaaTeamA, Groups: []addonPlacementGroup{
+				{Name: "web", AZ: "z1", Network: manifest.Default, Job: "workload-web"},
+			}},
+			{Name: "addons-team-b", Team: uaaTeamB, Groups: []addonPlacementGroup{
+				{Name: "web", AZ: "z1", Network: manifest.Default, Job: "workload-web"},
+			}},
+			{Name: "addons-no-team", Groups: []addonPlacementGroup{
+				{Name: "web", AZ: "z1", Network: manifest.Default, Job: "workload-web"},
+			}},
+		}
+
+		configs := []addonPlacementConfig{
+			{
+				Name:     "by-team",
+				Include:  manifest.Properties{"teams": []string{uaaTeamA}},
+				PlacedOn: []string{"addons-team-a/web"},
+			},
+			{
+				Name:     "not-team",
+				Exclude:  manifest.Properties{"teams": []string{uaaTeamA}},
+				PlacedOn: []string{"addons-team-b/web", "addons-no-team/web"},
+			},
+		}
+
+		BeforeEach(func() {
+			// Deployments belong to the teams of the user deploying them.
+			startInnerBoshWithTeams()
+			uploadAddonsArtifacts()
+		})
+
+		It("places addons by the teams of the deployment", func() {
+			applyRuntimeConfigs(configs, releaseVersion)
+			deployAddonPlacements(deployments, releaseVersion, stemcellVersion)
+			expectAddonPlacements(deployments, configs)
+		})
+	})
+})
@@ -0,0 +1,393 @@
+package brats_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	bratsutils "github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils"
+	"github.com/cloudfoundry/bosh-release-acceptance-tests/brats-utils/director"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	uaaTeamA = "brats-a"
+	uaaTeamB = "brats-b"
+
+	uaaAdminDeployment = "uaa-admin-deployment"
+	uaaTeamADeployment = "uaa-team-a-deployment"
+	uaaTeamBDeployment = "uaa-team-b-deployment"
+
+	uaaSymmetricKey = "brats-uaa-symmetric-key"
+
+	uaaUnreachableStemcell = "https://127.0.0.1:1/brats-stemcell.tgz"
+	uaaUnreachableRelease  = "https://127.0.0.1:1/brats-release.tgz"
+)
+
+// Kept across specs, like their keys, so the director is reused. The
+// director fingerprint includes the path of the public key file, so it is
+// written only once too.
+var (
+	fakeUAA          *bratsutils.FakeUAA
+	uaaRSASigningKey bratsutils.UAASigningKey
+	uaaPublicKeyPath string
+)
+
+func startFakeUAA(key bratsutils.UAASigningKey) {
+	if fakeUAA == nil {
+		var err error
+		fakeUAA, err = bratsutils.NewFakeUAA("0.0.0.0", bratsutils.InnerBoshDirector().HostAddress(), key,
+			bratsutils.InnerBoshDirector().Credentials)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	fakeUAA.SetSigningKey(key)
+	fakeUAA.Reset()
+}
+
+// uaaDirectorClient adds a client with the given scopes to the fake UAA and
+// returns a director client that gets its tokens there.
+func uaaDirectorClient(id string, scopes ...string) *director.Client {
+	fakeUAA.AddClient(id, id+"-secret", scopes...)
+
+	creds, err := bratsutils.InnerBoshDirector().Credentials()
+	Expect(err).ToNot(HaveOccurred())
+
+	client, err := director.NewClient(director.ClientConfig{
+		URL:          creds.URL,
+		CACert:       creds.CACert,
+		Client:       id,
+		ClientSecret: id + "-secret",
+	})
+	Expect(err).ToNot(HaveOccurred())
+	return client
+}
+
+// emptyDeploymentManifest has no instance groups, so deploying it needs
+// neither releases nor stemcells and is quick.
+func emptyDeploymentManifest(name string) []byte {
+	return []byte(fmt.Sprintf(`---
+name: %s
+releases: []
+stemcells: []
+instance_groups: []
+update:
+  canaries: 1
+  max_in_flight: 1
+  canary_watch_time: 1000
+  update_watch_time: 1000
+`, name))
+}
+
+func expectTaskSucceeded(taskID int, err error) {
+	Expect(err).ToNot(HaveOccurred())
+	result := bratsutils.TrackTask(taskID, 2*time.Minute)
+	Expect(result.Succeeded()).To(BeTrue(), result.String())
+}
+
+// expectRequiresScope checks the director turned a request down for the
+// token's scopes rather than for the token itself.
+func expectRequiresScope(err error, scope string) {
+	Expect(err).To(BeAssignableToTypeOf(director.Error{}))
+	directorErr := err.(director.Error)
+	Expect(directorErr.StatusCode).To(Equal(http.StatusUnauthorized))
+	Expect(directorErr.Code).To(Equal(600000))
+	Expect(directorErr.Description).To(ContainSubstring("Require one of the scopes:"))
+	Expect(directorErr.Description).To(ContainSubstring(scope))
+}
+
+func deploymentNames(deployments []director.Deployment) []string {
+	var names []string
+	for _, deployment := range deployments {
+		names = append(names, deployment.Name)
+	}
+	return names
+}
+
+// directorStatusWithToken sends a token the suite signed itself, which no
+// client could get from the fake UAA.
+func directorStatusWithToken(token, path string) (int, string) {
+	creds, err := bratsutils.InnerBoshDirector().Credentials()
+	Expect(err).ToNot(HaveOccurred())
+
+	caCerts := x509.NewCertPool()
+	Expect(caCerts.AppendCertsFromPEM([]byte(creds.CACert))).To(BeTrue())
+	client := &http.Client{
+		Timeout:   time.Minute,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: caCerts}},
+	}
+
+	req, err := http.NewRequest("GET", creds.URL+path, nil)
+	Expect(err).ToNot(HaveOccurred())
+	req.Header.Set("Authorization", "bearer "+token)
+
+	resp, err := client.Do(req)
+	Expect(err).ToNot(HaveOccurred())
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	Expect(err).ToNot(HaveOccurred())
+	return resp.StatusCode, string(body)
+}
+
+var _ = Describe("UAA user management", func() {
+	BeforeEach(func() {
+		bratsutils.SkipUnlessConfigured(bratsutils.ConfigCandidateStemcellTarballPath)
+
+		if uaaRSASigningKey.ID == "" {
+			var err error
+			uaaRSASigningKey, err = bratsutils.NewUAASigningKey("brats-rsa")
+			Expect(err).ToNot(HaveOccurred())
+
+			uaaPublicKeyPath = filepath.Join(bratsutils.TempDir("uaa"), "public-key.pem")
+			Expect(ioutil.WriteFile(uaaPublicKeyPath, []byte(uaaRSASigningKey.PublicKeyPEM()), 0644)).To(Succeed())
+		}
+	})
+
+	Context("with tokens signed with an RSA key", func() {
+		var (
+			admin *director.Client
+			info  director.Info
+		)
+
+		BeforeEach(func() {
+			startFakeUAA(uaaRSASigningKey)
+
+			bratsutils.StartInnerBosh(
+				"-o", bratsutils.AssetPath("ops-uaa-user-management.yml"),
+				"-v", fmt.Sprintf("uaa-url=%s", fakeUAA.URL()),
+				fmt.Sprintf("--var-file=uaa-public-key=%s", uaaPublicKeyPath),
+			)
+
+			admin = bratsutils.Director()
+
+			var err error
+			info, err = admin.Info()
+			Expect(err).ToNot(HaveOccurred())
+
+			By("deploying as an admin, and as the admins of two teams")
+			expectTaskSucceeded(admin.Deploy(emptyDeploymentManifest(uaaAdminDeployment), director.DeployOptions{}))
+			teamA := uaaDirectorClient("brats-team-a", "bosh.teams."+uaaTeamA+".admin")
+			expectTaskSucceeded(teamA.Deploy(emptyDeploymentManifest(uaaTeamADeployment), director.DeployOptions{}))
+			teamB := uaaDirectorClient("brats-team-b", "bosh.teams."+uaaTeamB+".admin")
+			expectTaskSucceeded(teamB.Deploy(emptyDeploymentManifest(uaaTeamBDeployment), director.DeployOptions{}))
+		})
+
+		It("sends the CLI to the fake UAA for the admin's tokens", func() {
+			Expect(info.UserAuthentication.Type).To(Equal("uaa"))
+			Expect(info.UserAuthentication.Options.URL).To(Equal(fakeUAA.URL()))
+
+			session := bratsutils.Bosh("deployments", "--json")
+			Eventually(session, time.Minute).Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(ContainSubstring(uaaTeamADeployment))
+
+			creds, err := bratsutils.InnerBoshDirector().Credentials()
+			Expect(err).ToNot(HaveOccurred())
+			session = bratsutils.Bosh("env", "--json")
+			Eventually(session, time.Minute).Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(ContainSubstring(fmt.Sprintf(`"user": "%s"`, creds.Client)))
+		})
+
+		It("lets bosh.admin and the director's own admin scope do anything, unlike another director's", func() {
+			for _, client := range []*director.Client{
+				uaaDirectorClient("brats-admin", "bosh.admin"),
+				uaaDirectorClient("brats-director-admin", fmt.Sprintf("bosh.%s.admin", info.UUID)),
+			} {
+				deployments, err := client.Deployments()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(deploymentNames(deployments)).To(ConsistOf(uaaAdminDeployment, uaaTeamADeployment, uaaTeamBDeployment))
+
+				_, err = client.UpdateConfig("brats-uaa", "brats-uaa", "content: 1")
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			other := uaaDirectorClient("brats-other-director-admin", "bosh.00000000-0000-0000-0000-000000000000.admin")
+			_, err := other.Deployments()
+			expectRequiresScope(err, fmt.Sprintf("bosh.%s.admin", info.UUID))
+		})
+
+		It("lets bosh.read see everything and change nothing", func() {
+			reader := uaaDirectorClient("brats-read", "bosh.read")
+
+			deployments, err := reader.Deployments()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deploymentNames(deployments)).To(ConsistOf(uaaAdminDeployment, uaaTeamADeployment, uaaTeamBDeployment))
+
+			_, err = reader.DeploymentManifest(uaaTeamBDeployment)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = reader.Stemcells()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = reader.Releases()
+			Expect(err).ToNot(HaveOccurred())
+			tasks, err := reader.Tasks(director.TasksFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tasks).ToNot(BeEmpty())
+
+			_, err = reader.Deploy(emptyDeploymentManifest("uaa-read-deployment"), director.DeployOptions{})
+			expectRequiresScope(err, "bosh.admin")
+			_, err = reader.DeleteDeployment(uaaTeamADeployment, director.DeleteDeploymentOptions{})
+			expectRequiresScope(err, "bosh.admin")
+			_, err = reader.UpdateConfig("brats-uaa", "brats-uaa", "content: 1")
+			expectRequiresScope(err, "bosh.admin")
+			_, err = reader.UploadStemcellURL(uaaUnreachableStemcell, director.UploadOptions{})
+			expectRequiresScope(err, "bosh.stemcells.upload")
+			_, err = reader.UploadReleaseURL(uaaUnreachableRelease, director.UploadOptions{})
+			expectRequiresScope(err, "bosh.releases.upload")
+		})
+
+		It("limits team admins to their teams' deployments, tasks and configs", func() {
+			teamA := uaaDirectorClient("brats-team-a", "bosh.teams."+uaaTeamA+".admin")
+			teamB := uaaDirectorClient("brats-team-b", "bosh.teams."+uaaTeamB+".admin")
+
+			By("listing only the team's deployments")
+			deployments, err := teamA.Deployments()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deployments).To(HaveLen(1))
+			Expect(deployments[0].Name).To(Equal(uaaTeamADeployment))
+			Expect(deployments[0].Teams).To(ConsistOf(uaaTeamA))
+
+			By("turning away requests for other deployments")
+			_, err = teamA.DeploymentManifest(uaaTeamBDeployment)
+			expectRequiresScope(err, "bosh.teams."+uaaTeamB+".admin")
+			_, err = teamA.DeploymentManifest(uaaAdminDeployment)
+			expectRequiresScope(err, "bosh.admin")
+			_, err = teamA.DeleteDeployment(uaaTeamBDeployment, director.DeleteDeploymentOptions{})
+			expectRequiresScope(err, "bosh.teams."+uaaTeamB+".admin")
+
+			By("listing only the team's tasks")
+			tasks, err := teamA.Tasks(director.TasksFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tasks).ToNot(BeEmpty())
+			for _, task := range tasks {
+				Expect(task.Deployment).To(Equal(uaaTeamADeployment))
+			}
+
+			By("sharing stemcells and releases, but not uploads")
+			_, err = teamA.Stemcells()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = teamA.Releases()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = teamA.UploadStemcellURL(uaaUnreachableStemcell, director.UploadOptions{})
+			expectRequiresScope(err, "bosh.stemcells.upload")
+
+			By("owning the configs the team updates")
+			config, err := teamA.UpdateConfig("brats-uaa", "brats-uaa-team", "content: 1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.Team).To(Equal(uaaTeamA))
+			configs, err := teamB.Configs(director.ConfigsFilter{Name: "brats-uaa-team"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configs).To(BeEmpty())
+			_, err = teamB.UpdateConfig("brats-uaa", "brats-uaa-team", "content: 2")
+			expectRequiresScope(err, "bosh.teams."+uaaTeamA+".admin")
+
+			By("deleting the team's own deployment")
+			expectTaskSucceeded(teamA.DeleteDeployment(uaaTeamADeployment, director.DeleteDeploymentOptions{}))
+		})
+
+		It("lets the upload scopes upload and nothing else", func() {
+			stemcellUploader := uaaDirectorClient("brats-stemcells", "bosh.stemcells.upload")
+			releaseUploader := uaaDirectorClient("brats-releases", "bosh.releases.upload")
+
+			// The director only fetches the location once the task runs, so
+			// getting a task means the upload was allowed. Nothing listens on
+			// the location, so the task fails straight away.
+			taskID, err := stemcellUploader.UploadStemcellURL(uaaUnreachableStemcell, director.UploadOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bratsutils.TrackTask(taskID, 2*time.Minute).Succeeded()).To(BeFalse())
+			_, err = stemcellUploader.UploadReleaseURL(uaaUnreachableRelease, director.UploadOptions{})
+			expectRequiresScope(err, "bosh.releases.upload")
+
+			taskID, err = releaseUploader.UploadReleaseURL(uaaUnreachableRelease, director.UploadOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bratsutils.TrackTask(taskID, 2*time.Minute).Succeeded()).To(BeFalse())
+			_, err = releaseUploader.UploadStemcellURL(uaaUnreachableStemcell, director.UploadOptions{})
+			expectRequiresScope(err, "bosh.stemcells.upload")
+
+			for _, client := range []*director.Client{stemcellUploader, releaseUploader} {
+				_, err = client.Stemcells()
+				expectRequiresScope(err, "bosh.read")
+				_, err = client.Deployments()
+				expectRequiresScope(err, "bosh.read")
+			}
+		})
+
+		It("turns away tokens it cannot verify, that expired, or without bosh scopes", func() {
+			status, _ := directorStatusWithToken("not-a-jwt", "/deployments")
+			Expect(status).To(Equal(http.StatusUnauthorized))
+
+			By("signing a token with another key")
+			otherKey, err := bratsutils.NewUAASigningKey("brats-rsa")
+			Expect(err).ToNot(HaveOccurred())
+			fakeUAA.SetSigningKey(otherKey)
+			forged, err := fakeUAA.Token("brats-forger", time.Hour, "bosh.admin")
+			fakeUAA.SetSigningKey(uaaRSASigningKey)
+			Expect(err).ToNot(HaveOccurred())
+
+			status, body := directorStatusWithToken(forged, "/deployments")
+			Expect(status).To(Equal(http.StatusUnauthorized))
+			Expect(body).To(ContainSubstring("Not authorized: '/deployments'"))
+
+			expired, err := fakeUAA.Token("brats-admin", -time.Minute, "bosh.admin")
+			Expect(err).ToNot(HaveOccurred())
+			status, body = directorStatusWithToken(expired, "/deployments")
+			Expect(status).To(Equal(http.StatusUnauthorized))
+			Expect(body).To(ContainSubstring("Not authorized: '/deployments'"))
+
+			By("accepting a token without bosh scopes as someone who may do nothing")
+			unscoped, err := fakeUAA.Token("brats-openid", time.Hour, "openid")
+			Expect(err).ToNot(HaveOccurred())
+			status, body = directorStatusWithToken(unscoped, "/deployments")
+			Expect(status).To(Equal(http.StatusUnauthorized))
+			Expect(body).To(ContainSubstring("Require one of the scopes:"))
+
+			status, body = directorStatusWithToken(unscoped, "/info")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(ContainSubstring(`"user":"brats-openid"`))
+		})
+	})
+
+	Context("with tokens signed with a symmetric key", func() {
+		BeforeEach(func() {
+			startFakeUAA(bratsutils.NewSymmetricUAASigningKey("brats-symmetric", uaaSymmetricKey))
+
+			bratsutils.StartInnerBosh(
+				"-o", bratsutils.AssetPath("ops-uaa-user-management.yml"),
+				"-o", bratsutils.AssetPath("ops-uaa-symmetric-key.yml"),
+				"-v", fmt.Sprintf("uaa-url=%s", fakeUAA.URL()),
+				"-v", fmt.Sprintf("uaa-symmetric-key=%s", uaaSymmetricKey),
+			)
+		})
+
+		It("accepts tokens signed with the key only", func() {
+			teamA := uaaDirectorClient("brats-team-a", "bosh.teams."+uaaTeamA+".admin")
+			expectTaskSucceeded(teamA.Deploy(emptyDeploymentManifest(uaaTeamADeployment), director.DeployOptions{}))
+
+			deployments, err := bratsutils.Director().Deployments()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deploymentNames(deployments)).To(ConsistOf(uaaTeamADeployment))
+
+			fakeUAA.SetSigningKey(bratsutils.NewSymmetricUAASigningKey("brats-symmetric", "another-key"))
+			forged, err := fakeUAA.Token("brats-forger", time.Hour, "bosh.admin")
+			fakeUAA.SetSigningKey(bratsutils.NewSymmetricUAASigningKey("brats-symmetric", uaaSymmetricKey))
+			Expect(err).ToNot(HaveOccurred())
+
+			status, _ := directorStatusWithToken(forged, "/deployments")
+			Expect(status).To(Equal(http.StatusUnauthorized))
+
+			By("turning away tokens signed with an RSA key too")
+			fakeUAA.SetSigningKey(uaaRSASigningKey)
+			forged, err = fakeUAA.Token("brats-forger", time.Hour, "bosh.admin")
+			fakeUAA.SetSigningKey(bratsutils.NewSymmetricUAASigningKey("brats-symmetric", uaaSymmetricKey))
+			Expect(err).ToNot(HaveOccurred())
+
+			status, _ = directorStatusWithToken(forged, "/deployments")
+			Expect(status).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})